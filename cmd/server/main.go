@@ -1,18 +1,35 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/rmntim/ozon-task/graph"
 	"github.com/rmntim/ozon-task/graph/resolver"
 	"github.com/rmntim/ozon-task/internal/config"
 	"github.com/rmntim/ozon-task/internal/lib/auth"
+	"github.com/rmntim/ozon-task/internal/lib/graph/presenter"
+	"github.com/rmntim/ozon-task/internal/lib/loaders"
 	"github.com/rmntim/ozon-task/internal/lib/logger/sl"
+	"github.com/rmntim/ozon-task/internal/lib/metrics"
+	"github.com/rmntim/ozon-task/internal/lib/pubsub"
+	"github.com/rmntim/ozon-task/internal/lib/tracing"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server/health"
 	loggerMw "github.com/rmntim/ozon-task/internal/server/middleware/logger"
+	"github.com/rmntim/ozon-task/internal/server/middleware/requestid"
 	"github.com/rmntim/ozon-task/internal/storage"
+	"github.com/rmntim/ozon-task/internal/storage/inmemory"
+	"github.com/rmntim/ozon-task/internal/storage/instrumented"
+	"github.com/rmntim/ozon-task/internal/storage/postgres"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 const (
@@ -27,20 +44,76 @@ func main() {
 	log.Info("starting server", slog.String("env", cfg.Env))
 	log.Debug("debug messages are enabled")
 
-	db, err := storage.New(cfg.Storage, dbCfg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Tracing goes first, so that storage picks up the tracer provider.
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing)
+	if err != nil {
+		log.Error("failed to init tracing", sl.Err(err))
+		os.Exit(1)
+	}
+
+	db, err := storage.New(cfg, dbCfg)
 	if err != nil {
 		log.Error("failed to init storage", sl.Err(err))
 		os.Exit(1)
 	}
+	if mem, ok := db.(*inmemory.Storage); ok {
+		go mem.Run(ctx, log)
+	}
+
+	m := metrics.New()
+	if pg, ok := db.(*postgres.Storage); ok {
+		m.RegisterDB(pg.Stats)
+	}
+	// Requests go through the instrumented storage, while background
+	// jobs and probes use the plain one.
+	idb := instrumented.New(db, m)
+
+	sessions := auth.NewSessions(idb, cfg.Auth.Secret, cfg.Auth.SessionTTL)
+	tokens, err := auth.NewTokens(idb, cfg.Auth.JWT, cfg.Auth.Secret)
+	if err != nil {
+		log.Error("failed to init tokens", sl.Err(err))
+		os.Exit(1)
+	}
+
+	policy, err := pubsub.ParsePolicy(cfg.Subscriptions.SlowSubscriberPolicy)
+	if err != nil {
+		log.Error("failed to init subscriptions", sl.Err(err))
+		os.Exit(1)
+	}
+	posts := pubsub.New[*models.Post](cfg.Subscriptions.BufferSize, policy)
+	comments := pubsub.New[*models.Comment](cfg.Subscriptions.BufferSize, policy)
+	m.RegisterBroker("posts", posts)
+	m.RegisterBroker("comments", comments)
+	if err := setupEventBus(ctx, cfg.Subscriptions.Bus, db, log, posts, comments); err != nil {
+		log.Error("failed to init event bus", sl.Err(err))
+		os.Exit(1)
+	}
+
+	gqlHandler := handler.NewDefaultServer(graph.NewExecutableSchema(resolver.New(idb, log, tokens, posts, comments)))
+	gqlHandler.SetErrorPresenter(presenter.ErrorPresenter)
+	gqlHandler.SetRecoverFunc(presenter.Recover(log))
+	gqlHandler.Use(m.GraphQL())
+	gqlHandler.Use(tracing.GraphQL())
+
+	checks := health.New(db)
 
-	gqlHandler := handler.NewDefaultServer(graph.NewExecutableSchema(resolver.New(db, log)))
+	app := http.NewServeMux()
+	app.Handle("/", playground.Handler("Ozon Task", "/query"))
+	app.Handle("/query", gqlHandler)
 
+	// Probes and metrics bypass auth and loaders, so that a stray
+	// Authorization header can't fail them.
 	mux := http.NewServeMux()
-	mux.Handle("/", playground.Handler("Ozon Task", "/query"))
-	mux.Handle("/query", gqlHandler)
+	mux.HandleFunc("/healthz", checks.Live)
+	mux.HandleFunc("/readyz", checks.Ready)
+	mux.Handle("/metrics", m.Handler())
+	mux.Handle("/", auth.Middleware(idb, sessions, tokens)(loaders.Middleware(idb)(app)))
 
 	// TODO: maybe switch to go-chi cause it has better mw support
-	handlerWithMw := loggerMw.New(log)(auth.Middleware(db)(mux))
+	handlerWithMw := tracing.Middleware(requestid.New()(loggerMw.New(log)(mux)))
 	srv := &http.Server{
 		Addr:         cfg.Server.Address,
 		Handler:      handlerWithMw,
@@ -48,14 +121,98 @@ func main() {
 		ReadTimeout:  cfg.Server.Timeout,
 		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
-	if err := srv.ListenAndServe(); err != nil {
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
 		log.Error("failed to start server", sl.Err(err))
 		os.Exit(1)
+	case <-ctx.Done():
+	}
+	// Let the second signal kill the server if shutdown hangs.
+	stop()
+
+	log.Info("stopping server")
+	// Keep serving while the orchestrator sees the instance isn't ready
+	// and stops routing traffic to it.
+	checks.Shutdown()
+	time.Sleep(cfg.Server.DrainDelay)
+	if err := shutdown(srv, db, shutdownTracing, cfg.Server.ShutdownTimeout, posts, comments); err != nil {
+		log.Error("failed to stop server gracefully", sl.Err(err))
+		os.Exit(1)
 	}
 
 	log.Info("server stopped")
 }
 
+// shutdown ends subscriptions, waits for requests in flight to finish
+// and closes the storage, which flushes in-memory snapshot. Spans of
+// the last requests are exported at the very end.
+func shutdown(
+	srv *http.Server,
+	db storage.Storage,
+	shutdownTracing func(context.Context) error,
+	timeout time.Duration,
+	posts *pubsub.Broker[*models.Post],
+	comments *pubsub.Broker[*models.Comment],
+) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Shutdown doesn't wait for websockets, as they are hijacked.
+	// Closed channels make gqlgen send `complete` to subscribers.
+	posts.Close()
+	comments.Close()
+
+	srvErr := srv.Shutdown(ctx)
+	dbErr := db.Close()
+	return errors.Join(srvErr, dbErr, shutdownTracing(ctx))
+}
+
+// setupEventBus makes brokers deliver events to all instances if the
+// bus is shared. In-memory bus needs no setup.
+func setupEventBus(
+	ctx context.Context,
+	bus string,
+	db storage.Storage,
+	log *slog.Logger,
+	posts *pubsub.Broker[*models.Post],
+	comments *pubsub.Broker[*models.Comment],
+) error {
+	switch bus {
+	case "memory":
+		return nil
+	case "postgres":
+		pg, ok := db.(*postgres.Storage)
+		if !ok {
+			return errors.New("postgres event bus requires postgres storage")
+		}
+
+		relay := pg.NewRelay(log)
+		if err := postgres.Forward(relay, "post_events", posts,
+			func(p *models.Post) uint { return p.ID }, db.GetPostById); err != nil {
+			return err
+		}
+		if err := postgres.Forward(relay, "comment_events", comments,
+			func(c *models.Comment) uint { return c.ID }, db.GetCommentById); err != nil {
+			return err
+		}
+
+		go func() {
+			relay.Run(ctx)
+			if err := relay.Close(); err != nil {
+				log.Error("failed to close event relay", sl.Err(err))
+			}
+		}()
+		return nil
+	}
+	return fmt.Errorf("unknown event bus: %s", bus)
+}
+
 func setupLogger(env string) *slog.Logger {
 	var logger *slog.Logger
 
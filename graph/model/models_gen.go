@@ -2,11 +2,189 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/rmntim/ozon-task/internal/models"
+)
+
+type AuthPayload struct {
+	User                 *models.User `json:"user"`
+	AccessToken          string       `json:"accessToken"`
+	AccessTokenExpiresAt time.Time    `json:"accessTokenExpiresAt"`
+	RefreshToken         string       `json:"refreshToken"`
+}
+
+type CommentConnection struct {
+	Edges    []*CommentEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+}
+
+type CommentEdge struct {
+	Cursor string          `json:"cursor"`
+	Node   *models.Comment `json:"node"`
+}
+
+type CommentTree struct {
+	Nodes      []*CommentTreeNode `json:"nodes"`
+	HasMore    bool               `json:"hasMore"`
+	MoreCursor *string            `json:"moreCursor,omitempty"`
+}
+
+type CommentTreeNode struct {
+	Comment           *models.Comment `json:"comment"`
+	Depth             int             `json:"depth"`
+	ChildCount        int             `json:"childCount"`
+	HasMoreReplies    bool            `json:"hasMoreReplies"`
+	MoreRepliesCursor *string         `json:"moreRepliesCursor,omitempty"`
+}
+
 type Mutation struct {
 }
 
+type PageInfo struct {
+	HasNextPage     bool    `json:"hasNextPage"`
+	HasPreviousPage bool    `json:"hasPreviousPage"`
+	StartCursor     *string `json:"startCursor,omitempty"`
+	EndCursor       *string `json:"endCursor,omitempty"`
+}
+
+type PostConnection struct {
+	Edges    []*PostEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+}
+
+type PostEdge struct {
+	Cursor string       `json:"cursor"`
+	Node   *models.Post `json:"node"`
+}
+
 type Query struct {
 }
 
+type SearchConnection struct {
+	Edges    []*SearchEdge `json:"edges"`
+	PageInfo *PageInfo     `json:"pageInfo"`
+}
+
+type SearchEdge struct {
+	Cursor string     `json:"cursor"`
+	Node   *SearchHit `json:"node"`
+}
+
+type SearchHit struct {
+	Type    SearchType      `json:"type"`
+	Post    *models.Post    `json:"post,omitempty"`
+	Comment *models.Comment `json:"comment,omitempty"`
+	User    *models.User    `json:"user,omitempty"`
+	Snippet string          `json:"snippet"`
+	Rank    float64         `json:"rank"`
+}
+
 type Subscription struct {
 }
+
+type UserConnection struct {
+	Edges    []*UserEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+}
+
+type UserEdge struct {
+	Cursor string       `json:"cursor"`
+	Node   *models.User `json:"node"`
+}
+
+type Order string
+
+const (
+	OrderOld           Order = "OLD"
+	OrderNew           Order = "NEW"
+	OrderTop           Order = "TOP"
+	OrderHot           Order = "HOT"
+	OrderControversial Order = "CONTROVERSIAL"
+	OrderBest          Order = "BEST"
+)
+
+var AllOrder = []Order{
+	OrderOld,
+	OrderNew,
+	OrderTop,
+	OrderHot,
+	OrderControversial,
+	OrderBest,
+}
+
+func (e Order) IsValid() bool {
+	switch e {
+	case OrderOld, OrderNew, OrderTop, OrderHot, OrderControversial, OrderBest:
+		return true
+	}
+	return false
+}
+
+func (e Order) String() string {
+	return string(e)
+}
+
+func (e *Order) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Order(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Order", str)
+	}
+	return nil
+}
+
+func (e Order) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SearchType string
+
+const (
+	SearchTypePost    SearchType = "POST"
+	SearchTypeComment SearchType = "COMMENT"
+	SearchTypeUser    SearchType = "USER"
+)
+
+var AllSearchType = []SearchType{
+	SearchTypePost,
+	SearchTypeComment,
+	SearchTypeUser,
+}
+
+func (e SearchType) IsValid() bool {
+	switch e {
+	case SearchTypePost, SearchTypeComment, SearchTypeUser:
+		return true
+	}
+	return false
+}
+
+func (e SearchType) String() string {
+	return string(e)
+}
+
+func (e *SearchType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SearchType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SearchType", str)
+	}
+	return nil
+}
+
+func (e SearchType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,32 @@
+package resolver
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/rmntim/ozon-task/internal/lib/graph/presenter"
+	"github.com/rmntim/ozon-task/internal/lib/validation"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// invalidInput reports every invalid field as a separate error naming
+// the argument in extensions.field. All but the last one are added to
+// the response right away, and the last one is returned.
+func invalidInput(ctx context.Context, errs validation.Errors) error {
+	var last error
+	for i, fieldErr := range errs {
+		err := &gqlerror.Error{
+			Message: fieldErr.Error(),
+			Path:    graphql.GetPath(ctx),
+			Extensions: map[string]any{
+				"code":  presenter.CodeBadUserInput,
+				"field": fieldErr.Field,
+			},
+		}
+		if i == len(errs)-1 {
+			last = err
+			break
+		}
+		graphql.AddError(ctx, err)
+	}
+	return last
+}
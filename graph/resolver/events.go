@@ -0,0 +1,20 @@
+package resolver
+
+import (
+	"strconv"
+)
+
+// Topics of subscription events. Comment topics are per post, so that
+// subscribers only get events they asked for.
+const (
+	topicPostCreated = "post.created"
+	topicPostEdited  = "post.edited"
+)
+
+func topicCommentAdded(postID uint) string {
+	return "comment.added." + strconv.FormatUint(uint64(postID), 10)
+}
+
+func topicCommentEdited(postID uint) string {
+	return "comment.edited." + strconv.FormatUint(uint64(postID), 10)
+}
@@ -0,0 +1,120 @@
+package resolver
+
+import (
+	"github.com/rmntim/ozon-task/graph/model"
+	"github.com/rmntim/ozon-task/internal/lib/graph/cursor"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 100
+)
+
+// orders maps GraphQL orders to storage ones.
+var orders = map[model.Order]models.Order{
+	model.OrderOld:           models.OrderOld,
+	model.OrderNew:           models.OrderNew,
+	model.OrderTop:           models.OrderTop,
+	model.OrderHot:           models.OrderHot,
+	model.OrderControversial: models.OrderControversial,
+	model.OrderBest:          models.OrderBest,
+}
+
+// pageFromArgs translates Relay connection arguments into a storage page
+// and the requested page size. The page fetches one extra item, which
+// tells whether there are more items beyond the requested ones.
+func pageFromArgs(first *int, after *string, last *int, before *string) (models.Page, int, error) {
+	if first != nil && last != nil {
+		return models.Page{}, 0, server.ErrInvalidPage
+	}
+
+	size := defaultPageSize
+	page := models.Page{}
+	switch {
+	case first != nil:
+		size = *first
+	case last != nil:
+		size = *last
+		page.FromEnd = true
+	}
+	if size < 0 || size > maxPageSize {
+		return models.Page{}, 0, server.ErrInvalidPage
+	}
+	page.Limit = size + 1
+
+	if after != nil {
+		id, err := cursor.Decode(*after)
+		if err != nil {
+			return models.Page{}, 0, server.ErrInvalidCursor
+		}
+		page.After = models.Cursor{ID: id, Valid: true}
+	}
+
+	if before != nil {
+		id, err := cursor.Decode(*before)
+		if err != nil {
+			return models.Page{}, 0, server.ErrInvalidCursor
+		}
+		page.Before = models.Cursor{ID: id, Valid: true}
+	}
+
+	return page, size, nil
+}
+
+// paginate trims items fetched for page down to size
+// and describes the result.
+func paginate[T any](items []T, page models.Page, size int, id func(T) uint) ([]T, *model.PageInfo) {
+	info := &model.PageInfo{}
+
+	if len(items) > size {
+		if page.FromEnd {
+			items = items[len(items)-size:]
+			info.HasPreviousPage = true
+		} else {
+			items = items[:size]
+			info.HasNextPage = true
+		}
+	}
+
+	if len(items) > 0 {
+		start, end := cursor.Encode(id(items[0])), cursor.Encode(id(items[len(items)-1]))
+		info.StartCursor, info.EndCursor = &start, &end
+	}
+
+	return items, info
+}
+
+func userConnection(users []*models.User, page models.Page, size int) *model.UserConnection {
+	users, info := paginate(users, page, size, func(u *models.User) uint { return u.ID })
+
+	edges := make([]*model.UserEdge, len(users))
+	for i, u := range users {
+		edges[i] = &model.UserEdge{Cursor: cursor.Encode(u.ID), Node: u}
+	}
+
+	return &model.UserConnection{Edges: edges, PageInfo: info}
+}
+
+func postConnection(posts []*models.Post, page models.Page, size int) *model.PostConnection {
+	posts, info := paginate(posts, page, size, func(p *models.Post) uint { return p.ID })
+
+	edges := make([]*model.PostEdge, len(posts))
+	for i, p := range posts {
+		edges[i] = &model.PostEdge{Cursor: cursor.Encode(p.ID), Node: p}
+	}
+
+	return &model.PostConnection{Edges: edges, PageInfo: info}
+}
+
+func commentConnection(comments []*models.Comment, page models.Page, size int) *model.CommentConnection {
+	comments, info := paginate(comments, page, size, func(c *models.Comment) uint { return c.ID })
+
+	edges := make([]*model.CommentEdge, len(comments))
+	for i, c := range comments {
+		edges[i] = &model.CommentEdge{Cursor: cursor.Encode(c.ID), Node: c}
+	}
+
+	return &model.CommentConnection{Edges: edges, PageInfo: info}
+}
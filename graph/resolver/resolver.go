@@ -1,7 +1,13 @@
 package resolver
 
 import (
+	"context"
 	"github.com/rmntim/ozon-task/graph"
+	"github.com/rmntim/ozon-task/internal/lib/auth"
+	"github.com/rmntim/ozon-task/internal/lib/loaders"
+	"github.com/rmntim/ozon-task/internal/lib/pubsub"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
 	"github.com/rmntim/ozon-task/internal/storage"
 	"log/slog"
 )
@@ -10,15 +16,31 @@ import (
 //
 // It serves as dependency injection for your app, add any dependencies you require here.
 
+// deletedPlaceholder replaces text of deleted posts and comments.
+const deletedPlaceholder = "[deleted]"
+
 type Resolver struct {
-	db  storage.Storage
-	log *slog.Logger
+	db     storage.Storage
+	log    *slog.Logger
+	tokens *auth.Tokens
+
+	posts    *pubsub.Broker[*models.Post]
+	comments *pubsub.Broker[*models.Comment]
 }
 
-func New(db storage.Storage, log *slog.Logger) graph.Config {
+func New(
+	db storage.Storage,
+	log *slog.Logger,
+	tokens *auth.Tokens,
+	posts *pubsub.Broker[*models.Post],
+	comments *pubsub.Broker[*models.Comment],
+) graph.Config {
 	res := &Resolver{
-		db:  db,
-		log: log,
+		db:       db,
+		log:      log,
+		tokens:   tokens,
+		posts:    posts,
+		comments: comments,
 	}
 
 	cfg := graph.Config{
@@ -27,3 +49,28 @@ func New(db storage.Storage, log *slog.Logger) graph.Config {
 
 	return cfg
 }
+
+// loadersFor returns request-scoped loaders, falling back to fresh ones
+// for contexts the loaders middleware didn't handle (e.g. subscriptions).
+func (r *Resolver) loadersFor(ctx context.Context) *loaders.Loaders {
+	if l := loaders.For(ctx); l != nil {
+		return l
+	}
+	return loaders.New(r.db)
+}
+
+// authorFor returns the ID of the user to create content on behalf of.
+// It's the current user, unless an admin explicitly asks for another one.
+func authorFor(ctx context.Context, authorID *uint) (uint, error) {
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return 0, server.ErrUnauthenticated
+	}
+	if authorID == nil || *authorID == user.ID {
+		return user.ID, nil
+	}
+	if !user.IsAdmin() {
+		return 0, server.ErrUnauthorized
+	}
+	return *authorID, nil
+}
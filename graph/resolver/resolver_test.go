@@ -0,0 +1,660 @@
+package resolver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/rmntim/ozon-task/graph"
+	"github.com/rmntim/ozon-task/graph/model"
+	"github.com/rmntim/ozon-task/graph/resolver"
+	"github.com/rmntim/ozon-task/internal/config"
+	"github.com/rmntim/ozon-task/internal/lib/auth"
+	"github.com/rmntim/ozon-task/internal/lib/pubsub"
+	"github.com/rmntim/ozon-task/internal/lib/random"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"github.com/rmntim/ozon-task/internal/storage/inmemory"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCreatePostAuthorship(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		mutation := newResolver(db).Mutation()
+		user, other := createUser(t, db), createUser(t, db)
+
+		if _, err := mutation.CreatePost(ctx, "title", "content", &user.ID, nil); !errors.Is(err, server.ErrUnauthenticated) {
+			t.Error("anonymous user should not create posts")
+		}
+
+		post, err := mutation.CreatePost(auth.WithUser(ctx, user), "title", "content", nil, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+		if post.AuthorID != user.ID {
+			t.Error("post author should be the current user")
+		}
+
+		if _, err := mutation.CreatePost(auth.WithUser(ctx, user), "title", "content", &other.ID, nil); !errors.Is(err, server.ErrUnauthorized) {
+			t.Error("user should not create posts on behalf of others")
+		}
+
+		admin := createAdmin(t, db)
+		post, err = mutation.CreatePost(auth.WithUser(ctx, admin), "title", "content", &other.ID, nil)
+		if err != nil {
+			t.Fatal("admin should create posts on behalf of others")
+		}
+		if post.AuthorID != other.ID {
+			t.Error("post author should be the requested user")
+		}
+	})
+}
+
+func TestCreateCommentAuthorship(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		mutation := newResolver(db).Mutation()
+		user, other := createUser(t, db), createUser(t, db)
+
+		post, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+
+		if _, err := mutation.CreateComment(ctx, "content", &user.ID, post.ID, nil); !errors.Is(err, server.ErrUnauthenticated) {
+			t.Error("anonymous user should not create comments")
+		}
+
+		comment, err := mutation.CreateComment(auth.WithUser(ctx, user), "content", nil, post.ID, nil)
+		if err != nil {
+			t.Fatal("comment should be created")
+		}
+		if comment.AuthorID != user.ID {
+			t.Error("comment author should be the current user")
+		}
+
+		if _, err := mutation.CreateComment(auth.WithUser(ctx, user), "content", &other.ID, post.ID, nil); !errors.Is(err, server.ErrUnauthorized) {
+			t.Error("user should not create comments on behalf of others")
+		}
+
+		admin := createAdmin(t, db)
+		comment, err = mutation.CreateComment(auth.WithUser(ctx, admin), "content", &other.ID, post.ID, &comment.ID)
+		if err != nil {
+			t.Fatal("admin should create comments on behalf of others")
+		}
+		if comment.AuthorID != other.ID {
+			t.Error("comment author should be the requested user")
+		}
+	})
+}
+
+// forEachStorage runs the test against in-memory storage and, if
+// TEST_DATABASE_ADDRESS is set, against postgres storage.
+func forEachStorage(t *testing.T, test func(t *testing.T, db storage.Storage)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, inmemory.New())
+	})
+
+	t.Run("postgres", func(t *testing.T) {
+		address := os.Getenv("TEST_DATABASE_ADDRESS")
+		if address == "" {
+			t.Skip("TEST_DATABASE_ADDRESS is not set")
+		}
+
+		// Migrations are looked up relative to the project root.
+		wd, err := os.Getwd()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chdir("../.."); err != nil {
+			t.Fatal(err)
+		}
+		db, err := storage.New(&config.Config{Storage: "postgres"}, &config.DBConfig{
+			Username: os.Getenv("TEST_DATABASE_USER"),
+			Password: os.Getenv("TEST_DATABASE_PASSWORD"),
+			Database: os.Getenv("TEST_DATABASE_NAME"),
+			Address:  address,
+		})
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+		if err != nil {
+			t.Fatal("postgres storage should be created:", err)
+		}
+
+		test(t, db)
+	})
+}
+
+func newResolver(db storage.Storage) graph.ResolverRoot {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	posts := pubsub.New[*models.Post](1, pubsub.Drop)
+	comments := pubsub.New[*models.Comment](1, pubsub.Drop)
+	return resolver.New(db, log, nil, posts, comments).Resolvers
+}
+
+func createUser(t *testing.T, db storage.Storage) *models.User {
+	t.Helper()
+	// Usernames are random, so tests can run against a non-empty database.
+	name := random.NewRandomString(16)
+	user, err := db.CreateUser(context.Background(), name, name+"@example.com", "password")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+	return user
+}
+
+func createAdmin(t *testing.T, db storage.Storage) *models.User {
+	t.Helper()
+	admin := createUser(t, db)
+	if err := db.SetUserRole(context.Background(), admin.ID, models.RoleAdmin); err != nil {
+		t.Fatal("admin role should be set")
+	}
+	admin.Role = models.RoleAdmin
+	return admin
+}
+
+func TestUpdatePostAuthorship(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		res := newResolver(db)
+		user, other := createUser(t, db), createUser(t, db)
+
+		post, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+
+		if _, err := res.Mutation().UpdatePost(ctx, post.ID, "new title", "new content"); !errors.Is(err, server.ErrUnauthenticated) {
+			t.Error("anonymous user should not edit posts")
+		}
+
+		if _, err := res.Mutation().UpdatePost(auth.WithUser(ctx, other), post.ID, "new title", "new content"); !errors.Is(err, server.ErrUnauthorized) {
+			t.Error("user should not edit posts of others")
+		}
+
+		updated, err := res.Mutation().UpdatePost(auth.WithUser(ctx, user), post.ID, "new title", "new content")
+		if err != nil {
+			t.Fatal("author should edit the post")
+		}
+
+		revisions, err := res.Post().Revisions(ctx, updated)
+		if err != nil {
+			t.Fatal("revisions should be loaded")
+		}
+		if len(revisions) != 1 || revisions[0].Title != "title" {
+			t.Error("previous version should be in revisions")
+		}
+	})
+}
+
+func TestUpdateCommentAuthorship(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		res := newResolver(db)
+		user, other := createUser(t, db), createUser(t, db)
+
+		post, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+		comment, err := db.CreateComment(ctx, "content", user.ID, post.ID, nil)
+		if err != nil {
+			t.Fatal("comment should be created")
+		}
+
+		if _, err := res.Mutation().UpdateComment(auth.WithUser(ctx, other), comment.ID, "new content"); !errors.Is(err, server.ErrUnauthorized) {
+			t.Error("user should not edit comments of others")
+		}
+
+		updated, err := res.Mutation().UpdateComment(auth.WithUser(ctx, user), comment.ID, "new content")
+		if err != nil {
+			t.Fatal("author should edit the comment")
+		}
+
+		revisions, err := res.Comment().Revisions(ctx, updated)
+		if err != nil {
+			t.Fatal("revisions should be loaded")
+		}
+		if len(revisions) != 1 || revisions[0].Content != "content" {
+			t.Error("previous version should be in revisions")
+		}
+	})
+}
+
+func TestToggleCommentsPermissions(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		res := newResolver(db)
+		user, other := createUser(t, db), createUser(t, db)
+		post, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+
+		if _, err := res.Mutation().ToggleComments(auth.WithUser(ctx, other), post.ID); !errors.Is(err, server.ErrUnauthorized) {
+			t.Error("other user should not toggle comments")
+		}
+		if _, err := res.Mutation().ToggleComments(auth.WithUser(ctx, user), 1<<30); !errors.Is(err, server.ErrPostNotFound) {
+			t.Error("comments of a missing post should not be toggled")
+		}
+		if enabled, err := res.Mutation().ToggleComments(auth.WithUser(ctx, user), post.ID); err != nil || enabled {
+			t.Error("author should disable comments")
+		}
+	})
+}
+
+func TestDeleteCommentPermissions(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		res := newResolver(db)
+		user, other := createUser(t, db), createUser(t, db)
+
+		post, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+		first, err := db.CreateComment(ctx, "content", user.ID, post.ID, nil)
+		if err != nil {
+			t.Fatal("comment should be created")
+		}
+		second, err := db.CreateComment(ctx, "content", user.ID, post.ID, nil)
+		if err != nil {
+			t.Fatal("comment should be created")
+		}
+
+		if _, err := res.Mutation().DeleteComment(auth.WithUser(ctx, other), first.ID); !errors.Is(err, server.ErrUnauthorized) {
+			t.Error("user should not delete comments of others")
+		}
+
+		if _, err := res.Mutation().DeleteComment(auth.WithUser(ctx, user), first.ID); err != nil {
+			t.Error("author should delete the comment")
+		}
+
+		moderator := createUser(t, db)
+		if err := db.SetUserRole(ctx, moderator.ID, models.RoleModerator); err != nil {
+			t.Fatal("moderator role should be set")
+		}
+		moderator.Role = models.RoleModerator
+
+		if _, err := res.Mutation().DeleteComment(auth.WithUser(ctx, moderator), second.ID); err != nil {
+			t.Error("moderator should delete the comment")
+		}
+
+		deleted, err := db.GetCommentById(ctx, first.ID)
+		if err != nil {
+			t.Fatal("deleted comment should be found")
+		}
+		if content, _ := res.Comment().Content(ctx, deleted); content != "[deleted]" {
+			t.Error("content of deleted comment should be hidden")
+		}
+	})
+}
+
+func TestDeletePostPermissions(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		res := newResolver(db)
+		user, other := createUser(t, db), createUser(t, db)
+
+		post, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+
+		if _, err := res.Mutation().DeletePost(ctx, post.ID); !errors.Is(err, server.ErrUnauthenticated) {
+			t.Error("anonymous user should not delete posts")
+		}
+
+		if _, err := res.Mutation().DeletePost(auth.WithUser(ctx, other), post.ID); !errors.Is(err, server.ErrUnauthorized) {
+			t.Error("user should not delete posts of others")
+		}
+
+		if _, err := res.Mutation().DeletePost(auth.WithUser(ctx, user), post.ID); err != nil {
+			t.Fatal("author should delete the post")
+		}
+
+		deleted, err := db.GetPostById(ctx, post.ID)
+		if err != nil {
+			t.Fatal("deleted post should be found")
+		}
+		if title, _ := res.Post().Title(ctx, deleted); title != "[deleted]" {
+			t.Error("title of deleted post should be hidden")
+		}
+	})
+}
+
+func TestCommentAddedSubscription(t *testing.T) {
+	db := inmemory.New()
+	res := newResolver(db)
+	user := createUser(t, db)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created")
+	}
+	second, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created")
+	}
+
+	events, err := res.Subscription().CommentAdded(ctx, first.ID)
+	if err != nil {
+		t.Fatal("subscription should be created")
+	}
+
+	userCtx := auth.WithUser(ctx, user)
+	if _, err := res.Mutation().CreateComment(userCtx, "other", nil, second.ID, nil); err != nil {
+		t.Fatal("comment should be created")
+	}
+	comment, err := res.Mutation().CreateComment(userCtx, "content", nil, first.ID, nil)
+	if err != nil {
+		t.Fatal("comment should be created")
+	}
+
+	if got := <-events; got.ID != comment.ID {
+		t.Error("subscriber should only get comments of its post")
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Error("subscription should be closed")
+	}
+}
+
+func TestCreateUserValidation(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	posts := pubsub.New[*models.Post](1, pubsub.Drop)
+	comments := pubsub.New[*models.Comment](1, pubsub.Drop)
+	schema := graph.NewExecutableSchema(resolver.New(inmemory.New(), log, nil, posts, comments))
+	c := client.New(handler.NewDefaultServer(schema))
+
+	resp, err := c.RawPost(`mutation { createUser(username: "a b", email: "nope", password: "password") { id } }`)
+	if err != nil {
+		t.Fatal("request should be sent:", err)
+	}
+
+	var errs []struct {
+		Path       []string
+		Extensions struct{ Code, Field string }
+	}
+	if err := json.Unmarshal(resp.Errors, &errs); err != nil {
+		t.Fatal("errors should be returned:", err)
+	}
+	if len(errs) != 2 {
+		t.Fatal("every invalid field should be reported")
+	}
+	for i, field := range []string{"username", "email"} {
+		if errs[i].Extensions.Code != "BAD_USER_INPUT" || errs[i].Extensions.Field != field {
+			t.Errorf("%s should be reported as invalid input", field)
+		}
+		if len(errs[i].Path) != 1 || errs[i].Path[0] != "createUser" {
+			t.Error("error should point at the mutation")
+		}
+	}
+}
+
+func TestCreateCommentValidation(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		user := createUser(t, db)
+		post, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+
+		_, err = newResolver(db).Mutation().CreateComment(auth.WithUser(ctx, user), strings.Repeat("я", 2001), nil, post.ID, nil)
+		var gqlErr *gqlerror.Error
+		if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != "BAD_USER_INPUT" {
+			t.Error("long comment should be rejected as invalid input")
+		}
+	})
+}
+
+func TestVotePost(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		res := newResolver(db)
+		user := createUser(t, db)
+		post, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+
+		if _, err := res.Mutation().VotePost(ctx, post.ID, 1); !errors.Is(err, server.ErrUnauthenticated) {
+			t.Error("anonymous user should not vote")
+		}
+
+		userCtx := auth.WithUser(ctx, user)
+		_, err = res.Mutation().VotePost(userCtx, post.ID, 2)
+		var gqlErr *gqlerror.Error
+		if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != "BAD_USER_INPUT" {
+			t.Error("vote of 2 should be rejected as invalid input")
+		}
+
+		voted, err := res.Mutation().VotePost(userCtx, post.ID, -1)
+		if err != nil {
+			t.Fatal("post should be voted on")
+		}
+		if voted.Downvotes != 1 || voted.Score() != -1 {
+			t.Error("vote should be counted")
+		}
+
+		if vote, err := res.Post().MyVote(userCtx, voted); err != nil || vote != -1 {
+			t.Error("user should see their vote")
+		}
+		if vote, err := res.Post().MyVote(ctx, voted); err != nil || vote != 0 {
+			t.Error("anonymous user should see no vote")
+		}
+	})
+}
+
+func TestCommentsOrderBy(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		res := newResolver(db)
+		user, voter := createUser(t, db), createUser(t, db)
+		post, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+		older, err := db.CreateComment(ctx, "older", user.ID, post.ID, nil)
+		if err != nil {
+			t.Fatal("comment should be created")
+		}
+		newer, err := db.CreateComment(ctx, "newer", user.ID, post.ID, nil)
+		if err != nil {
+			t.Fatal("comment should be created")
+		}
+		if _, err := db.VoteComment(ctx, older.ID, voter.ID, 1); err != nil {
+			t.Fatal("comment should be voted on")
+		}
+
+		first := 1
+		conn, err := res.Post().Comments(ctx, post, &first, nil, nil, nil, true, model.OrderTop)
+		if err != nil {
+			t.Fatal("comments should be found")
+		}
+		if len(conn.Edges) != 1 || conn.Edges[0].Node.ID != older.ID || !conn.PageInfo.HasNextPage {
+			t.Fatal("top comment should come first")
+		}
+
+		conn, err = res.Post().Comments(ctx, post, &first, conn.PageInfo.EndCursor, nil, nil, true, model.OrderTop)
+		if err != nil {
+			t.Fatal("comments should be found")
+		}
+		if len(conn.Edges) != 1 || conn.Edges[0].Node.ID != newer.ID || conn.PageInfo.HasNextPage {
+			t.Error("next page should continue in the same order")
+		}
+
+		conn, err = res.Post().Comments(ctx, post, &first, nil, nil, nil, true, model.OrderNew)
+		if err != nil {
+			t.Fatal("comments should be found")
+		}
+		if len(conn.Edges) != 1 || conn.Edges[0].Node.ID != newer.ID {
+			t.Error("newest comment should come first")
+		}
+	})
+}
+
+func TestSearch(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		res := newResolver(db)
+		user := createUser(t, db)
+		word := "w" + strings.ToLower(user.Username)
+		for i := 0; i < 2; i++ {
+			if _, err := db.CreatePost(ctx, "title", "about "+word, user.ID, nil); err != nil {
+				t.Fatal("post should be created")
+			}
+		}
+
+		first := 1
+		conn, err := res.Query().Search(ctx, word, []model.SearchType{model.SearchTypePost}, &first, nil)
+		if err != nil {
+			t.Fatal("search should succeed")
+		}
+		if len(conn.Edges) != 1 || conn.Edges[0].Node.Post == nil || !conn.PageInfo.HasNextPage {
+			t.Fatal("first post should be found")
+		}
+
+		next, err := res.Query().Search(ctx, word, nil, &first, conn.PageInfo.EndCursor)
+		if err != nil {
+			t.Fatal("search should succeed")
+		}
+		if len(next.Edges) != 1 || next.Edges[0].Node.Post == nil || next.Edges[0].Node.Post.ID == conn.Edges[0].Node.Post.ID ||
+			next.PageInfo.HasNextPage || !next.PageInfo.HasPreviousPage {
+			t.Error("second post should be found on the next page")
+		}
+
+		_, err = res.Query().Search(ctx, " ", nil, nil, nil)
+		var gqlErr *gqlerror.Error
+		if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != "BAD_USER_INPUT" {
+			t.Error("empty query should be rejected as invalid input")
+		}
+	})
+}
+
+func TestHubs(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		res := newResolver(db)
+		user := createUser(t, db)
+		userCtx := auth.WithUser(ctx, user)
+		slug := strings.ToLower(user.Username)
+
+		if _, err := res.Mutation().CreateHub(ctx, slug, "title", ""); !errors.Is(err, server.ErrUnauthenticated) {
+			t.Error("anonymous user should not create hubs")
+		}
+		_, err := res.Mutation().CreateHub(userCtx, "Not a slug", "title", "")
+		var gqlErr *gqlerror.Error
+		if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != "BAD_USER_INPUT" {
+			t.Error("invalid slug should be rejected as invalid input")
+		}
+		hub, err := res.Mutation().CreateHub(userCtx, slug, "title", "")
+		if err != nil {
+			t.Fatal("hub should be created")
+		}
+
+		subscribed, err := res.Mutation().SubscribeHub(userCtx, hub.ID)
+		if err != nil || subscribed.SubscribersCount != 1 {
+			t.Error("user should subscribe to the hub")
+		}
+
+		post, err := res.Mutation().CreatePost(userCtx, "title", "content", nil, []uint{hub.ID})
+		if err != nil {
+			t.Fatal("post should be created in the hub")
+		}
+		if _, err := res.Mutation().CreatePost(userCtx, "title", "content", nil, []uint{1 << 30}); !errors.Is(err, server.ErrHubNotFound) {
+			t.Error("post should not be created in a missing hub")
+		}
+
+		conn, err := res.Query().Posts(ctx, nil, nil, nil, nil, model.OrderNew, &slug)
+		if err != nil {
+			t.Fatal("posts of the hub should be found")
+		}
+		if len(conn.Edges) != 1 || conn.Edges[0].Node.ID != post.ID {
+			t.Error("only the post of the hub should be found")
+		}
+
+		if found, err := res.Query().Hub(ctx, slug); err != nil || found.ID != hub.ID {
+			t.Error("hub should be found by slug")
+		}
+		missing := slug + "-missing"
+		if _, err := res.Query().Posts(ctx, nil, nil, nil, nil, model.OrderNew, &missing); !errors.Is(err, server.ErrHubNotFound) {
+			t.Error("posts of a missing hub should not be found")
+		}
+	})
+}
+
+func TestFollowFeed(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, db storage.Storage) {
+		ctx := context.Background()
+		res := newResolver(db)
+		reader, author := createUser(t, db), createUser(t, db)
+		readerCtx := auth.WithUser(ctx, reader)
+
+		if _, err := res.Mutation().FollowUser(ctx, author.ID); !errors.Is(err, server.ErrUnauthenticated) {
+			t.Error("anonymous user should not follow")
+		}
+		if _, err := res.Mutation().FollowUser(readerCtx, reader.ID); !errors.Is(err, server.ErrSelfFollow) {
+			t.Error("user should not follow themselves")
+		}
+
+		followed, err := res.Mutation().FollowUser(readerCtx, author.ID)
+		if err != nil || followed.FollowersCount != 1 {
+			t.Fatal("user should be followed")
+		}
+		followers, err := res.User().Followers(ctx, followed, nil, nil, nil, nil)
+		if err != nil || len(followers.Edges) != 1 || followers.Edges[0].Node.ID != reader.ID {
+			t.Error("follower should be found")
+		}
+		following, err := res.User().Following(ctx, reader, nil, nil, nil, nil)
+		if err != nil || len(following.Edges) != 1 || following.Edges[0].Node.ID != author.ID {
+			t.Error("followed user should be found")
+		}
+
+		older, err := db.CreatePost(ctx, "title", "content", author.ID, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+		newer, err := db.CreatePost(ctx, "title", "content", author.ID, nil)
+		if err != nil {
+			t.Fatal("post should be created")
+		}
+
+		if _, err := res.Query().Feed(ctx, nil, nil); !errors.Is(err, server.ErrUnauthenticated) {
+			t.Error("anonymous user should have no feed")
+		}
+		first := 1
+		feed, err := res.Query().Feed(readerCtx, &first, nil)
+		if err != nil {
+			t.Fatal("feed should be found")
+		}
+		if len(feed.Edges) != 1 || feed.Edges[0].Node.ID != newer.ID || !feed.PageInfo.HasNextPage {
+			t.Fatal("newest post should come first")
+		}
+		feed, err = res.Query().Feed(readerCtx, &first, feed.PageInfo.EndCursor)
+		if err != nil {
+			t.Fatal("feed should be found")
+		}
+		if len(feed.Edges) != 1 || feed.Edges[0].Node.ID != older.ID || feed.PageInfo.HasNextPage {
+			t.Error("next page should continue with older posts")
+		}
+
+		if unfollowed, err := res.Mutation().UnfollowUser(readerCtx, author.ID); err != nil || unfollowed.FollowersCount != 0 {
+			t.Error("user should be unfollowed")
+		}
+	})
+}
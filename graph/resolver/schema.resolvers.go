@@ -10,27 +10,28 @@ import (
 	"log/slog"
 
 	"github.com/rmntim/ozon-task/graph"
+	"github.com/rmntim/ozon-task/graph/model"
 	"github.com/rmntim/ozon-task/internal/lib/auth"
+	"github.com/rmntim/ozon-task/internal/lib/loaders"
 	"github.com/rmntim/ozon-task/internal/lib/logger/sl"
-	"github.com/rmntim/ozon-task/internal/lib/random"
+	pwd "github.com/rmntim/ozon-task/internal/lib/password"
+	"github.com/rmntim/ozon-task/internal/lib/validation"
 	"github.com/rmntim/ozon-task/internal/models"
 	"github.com/rmntim/ozon-task/internal/server"
 )
 
-var (
-	postCreatedChannels  = make(map[string]chan *models.Post)
-	commentAddedChannels = make(map[string]commentWithPost)
-)
-
-type commentWithPost struct {
-	postID      uint
-	commentChan chan *models.Comment
+// Content is the resolver for the content field.
+func (r *commentResolver) Content(ctx context.Context, obj *models.Comment) (string, error) {
+	if obj.DeletedAt != nil {
+		return deletedPlaceholder, nil
+	}
+	return obj.Content, nil
 }
 
 // Author is the resolver for the author field.
 func (r *commentResolver) Author(ctx context.Context, obj *models.Comment) (*models.User, error) {
 	const op = "resolver.Author"
-	user, err := r.db.GetUserById(ctx, obj.AuthorID)
+	user, err := r.loadersFor(ctx).UserById.Load(ctx, obj.AuthorID)
 	if err != nil {
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
@@ -38,10 +39,39 @@ func (r *commentResolver) Author(ctx context.Context, obj *models.Comment) (*mod
 	return user, nil
 }
 
+// Revisions is the resolver for the revisions field.
+func (r *commentResolver) Revisions(ctx context.Context, obj *models.Comment) ([]*models.CommentRevision, error) {
+	const op = "resolver.Revisions"
+	if obj.DeletedAt != nil {
+		return make([]*models.CommentRevision, 0), nil
+	}
+	revisions, err := r.loadersFor(ctx).CommentRevisionsByCommentId.Load(ctx, obj.ID)
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return revisions, nil
+}
+
+// MyVote is the resolver for the myVote field.
+func (r *commentResolver) MyVote(ctx context.Context, obj *models.Comment) (int, error) {
+	const op = "resolver.MyVote"
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return 0, nil
+	}
+	vote, err := r.loadersFor(ctx).CommentVote.Load(ctx, loaders.VoteKey{UserID: user.ID, ID: obj.ID})
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return 0, server.ErrInternal
+	}
+	return vote, nil
+}
+
 // Post is the resolver for the post field.
 func (r *commentResolver) Post(ctx context.Context, obj *models.Comment) (*models.Post, error) {
 	const op = "resolver.Post"
-	post, err := r.db.GetPostById(ctx, obj.PostID)
+	post, err := r.loadersFor(ctx).PostById.Load(ctx, obj.PostID)
 	if err != nil {
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
@@ -55,7 +85,7 @@ func (r *commentResolver) ParentComment(ctx context.Context, obj *models.Comment
 	if obj.ParentCommentID == nil {
 		return nil, nil
 	}
-	parentComment, err := r.db.GetCommentById(ctx, *obj.ParentCommentID)
+	parentComment, err := r.loadersFor(ctx).CommentById.Load(ctx, *obj.ParentCommentID)
 	if err != nil {
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
@@ -64,21 +94,63 @@ func (r *commentResolver) ParentComment(ctx context.Context, obj *models.Comment
 }
 
 // Replies is the resolver for the replies field.
-func (r *commentResolver) Replies(ctx context.Context, obj *models.Comment) ([]*models.Comment, error) {
+func (r *commentResolver) Replies(ctx context.Context, obj *models.Comment, first *int, after *string, last *int, before *string, includeDeleted bool, orderBy model.Order) (*model.CommentConnection, error) {
 	const op = "resolver.Replies"
-	replies, err := r.db.GetReplies(ctx, obj.ID)
+	page, size, err := pageFromArgs(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	page.Order = orders[orderBy]
+	replies, err := r.loadersFor(ctx).RepliesByCommentId.Load(ctx, loaders.PageKey{ID: obj.ID, Page: page, IncludeDeleted: includeDeleted})
 	if err != nil {
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
 	}
-	return replies, nil
+	return commentConnection(replies, page, size), nil
+}
+
+// ReplyTree is the resolver for the replyTree field.
+func (r *commentResolver) ReplyTree(ctx context.Context, obj *models.Comment, maxDepth int, limitPerLevel int, after *string) (*model.CommentTree, error) {
+	const op = "resolver.ReplyTree"
+	query, err := treeQueryFromArgs(obj.PostID, &obj.ID, maxDepth, limitPerLevel, after)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := r.db.GetCommentTree(ctx, query)
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return commentTree(tree, query), nil
+}
+
+// Posts is the resolver for the posts field.
+func (r *hubResolver) Posts(ctx context.Context, obj *models.Hub, first *int, after *string, last *int, before *string, orderBy model.Order) (*model.PostConnection, error) {
+	const op = "resolver.Posts"
+	page, size, err := pageFromArgs(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	page.Order = orders[orderBy]
+	posts, err := r.db.GetPostsFromHub(ctx, obj.ID, page)
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return postConnection(posts, page, size), nil
 }
 
 // CreateUser is the resolver for the createUser field.
 func (r *mutationResolver) CreateUser(ctx context.Context, username string, email string, password string) (*models.User, error) {
 	const op = "resolver.CreateUser"
+	if errs := validation.User(username, email, password); errs != nil {
+		return nil, invalidInput(ctx, errs)
+	}
 	newUser, err := r.db.CreateUser(ctx, username, email, password)
 	if err != nil {
+		if errors.Is(err, server.ErrUsernameTaken) || errors.Is(err, server.ErrEmailTaken) {
+			return nil, err
+		}
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
 	}
@@ -86,40 +158,246 @@ func (r *mutationResolver) CreateUser(ctx context.Context, username string, emai
 }
 
 // CreatePost is the resolver for the createPost field.
-func (r *mutationResolver) CreatePost(ctx context.Context, title string, content string, authorID uint) (*models.Post, error) {
+func (r *mutationResolver) CreatePost(ctx context.Context, title string, content string, authorID *uint, hubIds []uint) (*models.Post, error) {
 	const op = "resolver.CreatePost"
-	newPost, err := r.db.CreatePost(ctx, title, content, authorID)
+	author, err := authorFor(ctx, authorID)
 	if err != nil {
+		return nil, err
+	}
+	if errs := append(validation.Post(title, content), validation.PostHubs(hubIds)...); errs != nil {
+		return nil, invalidInput(ctx, errs)
+	}
+	newPost, err := r.db.CreatePost(ctx, title, content, author, hubIds)
+	if err != nil {
+		if errors.Is(err, server.ErrUserNotFound) || errors.Is(err, server.ErrHubNotFound) {
+			return nil, err
+		}
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
 	}
 
-	for _, observer := range postCreatedChannels {
-		observer <- newPost
-	}
+	r.posts.Publish(topicPostCreated, newPost)
 
 	return newPost, nil
 }
 
 // CreateComment is the resolver for the createComment field.
-func (r *mutationResolver) CreateComment(ctx context.Context, content string, authorID uint, postID uint, parentCommentID *uint) (*models.Comment, error) {
+func (r *mutationResolver) CreateComment(ctx context.Context, content string, authorID *uint, postID uint, parentCommentID *uint) (*models.Comment, error) {
 	const op = "resolver.CreateComment"
-	newComment, err := r.db.CreateComment(ctx, content, authorID, postID, parentCommentID)
+	author, err := authorFor(ctx, authorID)
 	if err != nil {
-		if errors.Is(err, server.ErrCommentsDisabled) {
-			return nil, server.ErrCommentsDisabled
+		return nil, err
+	}
+	if errs := validation.Comment(content); errs != nil {
+		return nil, invalidInput(ctx, errs)
+	}
+	newComment, err := r.db.CreateComment(ctx, content, author, postID, parentCommentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, server.ErrUserNotFound),
+			errors.Is(err, server.ErrPostNotFound),
+			errors.Is(err, server.ErrCommentNotFound),
+			errors.Is(err, server.ErrCommentsDisabled),
+			errors.Is(err, server.ErrParentCommentMismatch):
+			return nil, err
 		}
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
 	}
 
-	for _, observer := range commentAddedChannels {
-		if postID == observer.postID {
-			observer.commentChan <- newComment
+	r.comments.Publish(topicCommentAdded(postID), newComment)
+
+	return newComment, nil
+}
+
+// UpdatePost is the resolver for the updatePost field.
+func (r *mutationResolver) UpdatePost(ctx context.Context, id uint, title string, content string) (*models.Post, error) {
+	const op = "resolver.UpdatePost"
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return nil, server.ErrUnauthenticated
+	}
+	if errs := validation.Post(title, content); errs != nil {
+		return nil, invalidInput(ctx, errs)
+	}
+	post, err := r.db.UpdatePost(ctx, id, user.ID, title, content)
+	if err != nil {
+		if errors.Is(err, server.ErrPostNotFound) || errors.Is(err, server.ErrUnauthorized) {
+			return nil, err
 		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
 	}
 
-	return newComment, nil
+	r.posts.Publish(topicPostEdited, post)
+
+	return post, nil
+}
+
+// UpdateComment is the resolver for the updateComment field.
+func (r *mutationResolver) UpdateComment(ctx context.Context, id uint, content string) (*models.Comment, error) {
+	const op = "resolver.UpdateComment"
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return nil, server.ErrUnauthenticated
+	}
+	if errs := validation.Comment(content); errs != nil {
+		return nil, invalidInput(ctx, errs)
+	}
+	comment, err := r.db.UpdateComment(ctx, id, user.ID, content)
+	if err != nil {
+		if errors.Is(err, server.ErrCommentNotFound) || errors.Is(err, server.ErrUnauthorized) {
+			return nil, err
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+
+	r.comments.Publish(topicCommentEdited(comment.PostID), comment)
+
+	return comment, nil
+}
+
+// DeletePost is the resolver for the deletePost field.
+func (r *mutationResolver) DeletePost(ctx context.Context, id uint) (bool, error) {
+	const op = "resolver.DeletePost"
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return false, server.ErrUnauthenticated
+	}
+	post, err := r.db.GetPostById(ctx, id)
+	if err != nil {
+		if errors.Is(err, server.ErrPostNotFound) {
+			return false, server.ErrPostNotFound
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return false, server.ErrInternal
+	}
+	if post.AuthorID != user.ID && !user.IsModerator() {
+		return false, server.ErrUnauthorized
+	}
+	if err := r.db.DeletePost(ctx, id); err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return false, server.ErrInternal
+	}
+	return true, nil
+}
+
+// DeleteComment is the resolver for the deleteComment field.
+func (r *mutationResolver) DeleteComment(ctx context.Context, id uint) (bool, error) {
+	const op = "resolver.DeleteComment"
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return false, server.ErrUnauthenticated
+	}
+	comment, err := r.db.GetCommentById(ctx, id)
+	if err != nil {
+		if errors.Is(err, server.ErrCommentNotFound) {
+			return false, server.ErrCommentNotFound
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return false, server.ErrInternal
+	}
+	if comment.AuthorID != user.ID && !user.IsModerator() {
+		return false, server.ErrUnauthorized
+	}
+	if err := r.db.DeleteComment(ctx, id); err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return false, server.ErrInternal
+	}
+	return true, nil
+}
+
+// CreateHub is the resolver for the createHub field.
+func (r *mutationResolver) CreateHub(ctx context.Context, slug string, title string, description string) (*models.Hub, error) {
+	const op = "resolver.CreateHub"
+	if auth.ForContext(ctx) == nil {
+		return nil, server.ErrUnauthenticated
+	}
+	if errs := validation.Hub(slug, title, description); errs != nil {
+		return nil, invalidInput(ctx, errs)
+	}
+	hub, err := r.db.CreateHub(ctx, slug, title, description)
+	if err != nil {
+		if errors.Is(err, server.ErrHubSlugTaken) {
+			return nil, err
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return hub, nil
+}
+
+// SubscribeHub is the resolver for the subscribeHub field.
+func (r *mutationResolver) SubscribeHub(ctx context.Context, hubID uint) (*models.Hub, error) {
+	const op = "resolver.SubscribeHub"
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return nil, server.ErrUnauthenticated
+	}
+	hub, err := r.db.SubscribeHub(ctx, hubID, user.ID)
+	if err != nil {
+		if errors.Is(err, server.ErrHubNotFound) {
+			return nil, err
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return hub, nil
+}
+
+// UnsubscribeHub is the resolver for the unsubscribeHub field.
+func (r *mutationResolver) UnsubscribeHub(ctx context.Context, hubID uint) (*models.Hub, error) {
+	const op = "resolver.UnsubscribeHub"
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return nil, server.ErrUnauthenticated
+	}
+	hub, err := r.db.UnsubscribeHub(ctx, hubID, user.ID)
+	if err != nil {
+		if errors.Is(err, server.ErrHubNotFound) {
+			return nil, err
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return hub, nil
+}
+
+// FollowUser is the resolver for the followUser field.
+func (r *mutationResolver) FollowUser(ctx context.Context, userID uint) (*models.User, error) {
+	const op = "resolver.FollowUser"
+	follower := auth.ForContext(ctx)
+	if follower == nil {
+		return nil, server.ErrUnauthenticated
+	}
+	user, err := r.db.FollowUser(ctx, userID, follower.ID)
+	if err != nil {
+		if errors.Is(err, server.ErrUserNotFound) || errors.Is(err, server.ErrSelfFollow) {
+			return nil, err
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return user, nil
+}
+
+// UnfollowUser is the resolver for the unfollowUser field.
+func (r *mutationResolver) UnfollowUser(ctx context.Context, userID uint) (*models.User, error) {
+	const op = "resolver.UnfollowUser"
+	follower := auth.ForContext(ctx)
+	if follower == nil {
+		return nil, server.ErrUnauthenticated
+	}
+	user, err := r.db.UnfollowUser(ctx, userID, follower.ID)
+	if err != nil {
+		if errors.Is(err, server.ErrUserNotFound) {
+			return nil, err
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return user, nil
 }
 
 // ToggleComments is the resolver for the toggleComments field.
@@ -127,20 +405,170 @@ func (r *mutationResolver) ToggleComments(ctx context.Context, postID uint) (boo
 	const op = "resolver.ToggleComments"
 	user := auth.ForContext(ctx)
 	if user == nil {
-		return false, server.ErrUnauthorized
+		return false, server.ErrUnauthenticated
 	}
 	isEnabled, err := r.db.ToggleComments(ctx, postID, user.ID)
 	if err != nil {
+		if errors.Is(err, server.ErrPostNotFound) || errors.Is(err, server.ErrUnauthorized) {
+			return false, err
+		}
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return false, server.ErrInternal
 	}
 	return isEnabled, nil
 }
 
+// VotePost is the resolver for the votePost field.
+func (r *mutationResolver) VotePost(ctx context.Context, postID uint, value int) (*models.Post, error) {
+	const op = "resolver.VotePost"
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return nil, server.ErrUnauthenticated
+	}
+	if errs := validation.Vote(value); errs != nil {
+		return nil, invalidInput(ctx, errs)
+	}
+	post, err := r.db.VotePost(ctx, postID, user.ID, value)
+	if err != nil {
+		if errors.Is(err, server.ErrPostNotFound) {
+			return nil, err
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+
+	// The vote may have been loaded earlier in the request.
+	key := loaders.VoteKey{UserID: user.ID, ID: postID}
+	l := r.loadersFor(ctx)
+	l.PostVote.Clear(key)
+	l.PostVote.Prime(key, value)
+
+	return post, nil
+}
+
+// VoteComment is the resolver for the voteComment field.
+func (r *mutationResolver) VoteComment(ctx context.Context, commentID uint, value int) (*models.Comment, error) {
+	const op = "resolver.VoteComment"
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return nil, server.ErrUnauthenticated
+	}
+	if errs := validation.Vote(value); errs != nil {
+		return nil, invalidInput(ctx, errs)
+	}
+	comment, err := r.db.VoteComment(ctx, commentID, user.ID, value)
+	if err != nil {
+		if errors.Is(err, server.ErrCommentNotFound) {
+			return nil, err
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+
+	// The vote may have been loaded earlier in the request.
+	key := loaders.VoteKey{UserID: user.ID, ID: commentID}
+	l := r.loadersFor(ctx)
+	l.CommentVote.Clear(key)
+	l.CommentVote.Prime(key, value)
+
+	return comment, nil
+}
+
+// Login is the resolver for the login field.
+func (r *mutationResolver) Login(ctx context.Context, username string, password string) (*model.AuthPayload, error) {
+	const op = "resolver.Login"
+	user, err := r.db.GetUserByUsername(ctx, username)
+	if err != nil && !errors.Is(err, server.ErrUserNotFound) {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	var hash []byte
+	if user != nil {
+		hash = user.PasswordHash
+	}
+	if !pwd.Check(hash, password) {
+		return nil, server.ErrBadCredentials
+	}
+	if err := auth.Login(ctx, user.ID); err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	tokens, err := r.tokens.Issue(ctx, user.ID)
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return &model.AuthPayload{
+		User:                 user,
+		AccessToken:          tokens.AccessToken,
+		AccessTokenExpiresAt: tokens.AccessTokenExpiresAt,
+		RefreshToken:         tokens.RefreshToken,
+	}, nil
+}
+
+// RefreshToken is the resolver for the refreshToken field.
+func (r *mutationResolver) RefreshToken(ctx context.Context, token string) (*model.AuthPayload, error) {
+	const op = "resolver.RefreshToken"
+	tokens, err := r.tokens.Refresh(ctx, token)
+	if err != nil {
+		if errors.Is(err, server.ErrInvalidToken) {
+			return nil, server.ErrInvalidToken
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	user, err := r.db.GetUserById(ctx, tokens.UserID)
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return &model.AuthPayload{
+		User:                 user,
+		AccessToken:          tokens.AccessToken,
+		AccessTokenExpiresAt: tokens.AccessTokenExpiresAt,
+		RefreshToken:         tokens.RefreshToken,
+	}, nil
+}
+
+// Logout is the resolver for the logout field.
+func (r *mutationResolver) Logout(ctx context.Context, refreshToken *string) (bool, error) {
+	const op = "resolver.Logout"
+	if refreshToken != nil {
+		if err := r.tokens.Revoke(ctx, *refreshToken); err != nil {
+			if errors.Is(err, server.ErrInvalidToken) {
+				return false, server.ErrInvalidToken
+			}
+			r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+			return false, server.ErrInternal
+		}
+	}
+	if err := auth.Logout(ctx); err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return false, server.ErrInternal
+	}
+	return true, nil
+}
+
+// Title is the resolver for the title field.
+func (r *postResolver) Title(ctx context.Context, obj *models.Post) (string, error) {
+	if obj.DeletedAt != nil {
+		return deletedPlaceholder, nil
+	}
+	return obj.Title, nil
+}
+
+// Content is the resolver for the content field.
+func (r *postResolver) Content(ctx context.Context, obj *models.Post) (string, error) {
+	if obj.DeletedAt != nil {
+		return deletedPlaceholder, nil
+	}
+	return obj.Content, nil
+}
+
 // Author is the resolver for the author field.
 func (r *postResolver) Author(ctx context.Context, obj *models.Post) (*models.User, error) {
 	const op = "resolver.Author"
-	user, err := r.db.GetUserById(ctx, obj.AuthorID)
+	user, err := r.loadersFor(ctx).UserById.Load(ctx, obj.AuthorID)
 	if err != nil {
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
@@ -148,15 +576,64 @@ func (r *postResolver) Author(ctx context.Context, obj *models.Post) (*models.Us
 	return user, nil
 }
 
+// Revisions is the resolver for the revisions field.
+func (r *postResolver) Revisions(ctx context.Context, obj *models.Post) ([]*models.PostRevision, error) {
+	const op = "resolver.Revisions"
+	if obj.DeletedAt != nil {
+		return make([]*models.PostRevision, 0), nil
+	}
+	revisions, err := r.loadersFor(ctx).PostRevisionsByPostId.Load(ctx, obj.ID)
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return revisions, nil
+}
+
+// MyVote is the resolver for the myVote field.
+func (r *postResolver) MyVote(ctx context.Context, obj *models.Post) (int, error) {
+	const op = "resolver.MyVote"
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return 0, nil
+	}
+	vote, err := r.loadersFor(ctx).PostVote.Load(ctx, loaders.VoteKey{UserID: user.ID, ID: obj.ID})
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return 0, server.ErrInternal
+	}
+	return vote, nil
+}
+
 // Comments is the resolver for the comments field.
-func (r *postResolver) Comments(ctx context.Context, obj *models.Post) ([]*models.Comment, error) {
+func (r *postResolver) Comments(ctx context.Context, obj *models.Post, first *int, after *string, last *int, before *string, includeDeleted bool, orderBy model.Order) (*model.CommentConnection, error) {
 	const op = "resolver.Comments"
-	comments, err := r.db.GetCommentsForPost(ctx, obj.ID)
+	page, size, err := pageFromArgs(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	page.Order = orders[orderBy]
+	comments, err := r.loadersFor(ctx).CommentsByPostId.Load(ctx, loaders.PageKey{ID: obj.ID, Page: page, IncludeDeleted: includeDeleted})
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return commentConnection(comments, page, size), nil
+}
+
+// CommentTree is the resolver for the commentTree field.
+func (r *postResolver) CommentTree(ctx context.Context, obj *models.Post, maxDepth int, limitPerLevel int, after *string) (*model.CommentTree, error) {
+	const op = "resolver.CommentTree"
+	query, err := treeQueryFromArgs(obj.ID, nil, maxDepth, limitPerLevel, after)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := r.db.GetCommentTree(ctx, query)
 	if err != nil {
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
 	}
-	return comments, nil
+	return commentTree(tree, query), nil
 }
 
 // User is the resolver for the user field.
@@ -174,14 +651,18 @@ func (r *queryResolver) User(ctx context.Context, id uint) (*models.User, error)
 }
 
 // Users is the resolver for the users field.
-func (r *queryResolver) Users(ctx context.Context, limit int, offset int) ([]*models.User, error) {
+func (r *queryResolver) Users(ctx context.Context, first *int, after *string, last *int, before *string) (*model.UserConnection, error) {
 	const op = "resolver.Users"
-	users, err := r.db.GetUsers(ctx, limit, offset)
+	page, size, err := pageFromArgs(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	users, err := r.db.GetUsers(ctx, page)
 	if err != nil {
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
 	}
-	return users, nil
+	return userConnection(users, page, size), nil
 }
 
 // Post is the resolver for the post field.
@@ -199,14 +680,65 @@ func (r *queryResolver) Post(ctx context.Context, id uint) (*models.Post, error)
 }
 
 // Posts is the resolver for the posts field.
-func (r *queryResolver) Posts(ctx context.Context, limit int, offset int) ([]*models.Post, error) {
+func (r *queryResolver) Posts(ctx context.Context, first *int, after *string, last *int, before *string, orderBy model.Order, hub *string) (*model.PostConnection, error) {
 	const op = "resolver.Posts"
-	posts, err := r.db.GetPosts(ctx, limit, offset)
+	page, size, err := pageFromArgs(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	page.Order = orders[orderBy]
+	var posts []*models.Post
+	if hub == nil {
+		posts, err = r.db.GetPosts(ctx, page)
+	} else {
+		var found *models.Hub
+		found, err = r.db.GetHubBySlug(ctx, *hub)
+		if err == nil {
+			posts, err = r.db.GetPostsFromHub(ctx, found.ID, page)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, server.ErrHubNotFound) {
+			return nil, err
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return postConnection(posts, page, size), nil
+}
+
+// Hub is the resolver for the hub field.
+func (r *queryResolver) Hub(ctx context.Context, slug string) (*models.Hub, error) {
+	const op = "resolver.Hub"
+	hub, err := r.db.GetHubBySlug(ctx, slug)
+	if err != nil {
+		if errors.Is(err, server.ErrHubNotFound) {
+			return nil, server.ErrHubNotFound
+		}
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return hub, nil
+}
+
+// Feed is the resolver for the feed field.
+func (r *queryResolver) Feed(ctx context.Context, first *int, after *string) (*model.PostConnection, error) {
+	const op = "resolver.Feed"
+	user := auth.ForContext(ctx)
+	if user == nil {
+		return nil, server.ErrUnauthenticated
+	}
+	page, size, err := pageFromArgs(first, after, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	page.Order = models.OrderNew
+	posts, err := r.db.GetFeed(ctx, user.ID, page)
 	if err != nil {
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
 	}
-	return posts, nil
+	return postConnection(posts, page, size), nil
 }
 
 // Comment is the resolver for the comment field.
@@ -224,61 +756,114 @@ func (r *queryResolver) Comment(ctx context.Context, id uint) (*models.Comment,
 }
 
 // Comments is the resolver for the comments field.
-func (r *queryResolver) Comments(ctx context.Context, limit int, offset int) ([]*models.Comment, error) {
+func (r *queryResolver) Comments(ctx context.Context, first *int, after *string, last *int, before *string) (*model.CommentConnection, error) {
 	const op = "resolver.Comments"
-	comments, err := r.db.GetComments(ctx, limit, offset)
+	page, size, err := pageFromArgs(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := r.db.GetComments(ctx, page)
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return commentConnection(comments, page, size), nil
+}
+
+// Search is the resolver for the search field.
+func (r *queryResolver) Search(ctx context.Context, query string, typeArg []model.SearchType, first *int, after *string) (*model.SearchConnection, error) {
+	const op = "resolver.Search"
+	if errs := validation.Search(query); errs != nil {
+		return nil, invalidInput(ctx, errs)
+	}
+	q, size, err := searchQueryFromArgs(query, typeArg, first, after)
+	if err != nil {
+		return nil, err
+	}
+	hits, err := r.db.Search(ctx, q)
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	conn, err := r.searchConnection(ctx, hits, q, size)
 	if err != nil {
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
 	}
-	return comments, nil
+	return conn, nil
 }
 
 // PostAdded is the resolver for the postAdded field.
 func (r *subscriptionResolver) PostAdded(ctx context.Context) (<-chan *models.Post, error) {
-	id := random.NewRandomString(8)
-
-	postEvent := make(chan *models.Post, 1)
-	go func() {
-		<-ctx.Done()
-		close(postEvent)
-		delete(postCreatedChannels, id)
-	}()
-	postCreatedChannels[id] = postEvent
-	return postEvent, nil
+	return r.posts.Subscribe(ctx, topicPostCreated), nil
 }
 
 // CommentAdded is the resolver for the commentAdded field.
 func (r *subscriptionResolver) CommentAdded(ctx context.Context, postID uint) (<-chan *models.Comment, error) {
-	id := random.NewRandomString(8)
+	return r.comments.Subscribe(ctx, topicCommentAdded(postID)), nil
+}
 
-	commentEvent := make(chan *models.Comment, 1)
-	go func() {
-		<-ctx.Done()
-		close(commentEvent)
-		delete(commentAddedChannels, id)
-	}()
-	commentAddedChannels[id] = commentWithPost{
-		postID:      postID,
-		commentChan: commentEvent,
-	}
-	return commentEvent, nil
+// PostEdited is the resolver for the postEdited field.
+func (r *subscriptionResolver) PostEdited(ctx context.Context) (<-chan *models.Post, error) {
+	return r.posts.Subscribe(ctx, topicPostEdited), nil
+}
+
+// CommentEdited is the resolver for the commentEdited field.
+func (r *subscriptionResolver) CommentEdited(ctx context.Context, postID uint) (<-chan *models.Comment, error) {
+	return r.comments.Subscribe(ctx, topicCommentEdited(postID)), nil
 }
 
 // Posts is the resolver for the posts field.
-func (r *userResolver) Posts(ctx context.Context, obj *models.User) ([]*models.Post, error) {
+func (r *userResolver) Posts(ctx context.Context, obj *models.User, first *int, after *string, last *int, before *string) (*model.PostConnection, error) {
 	const op = "resolver.Posts"
-	posts, err := r.db.GetPostsFromUser(ctx, obj.ID)
+	page, size, err := pageFromArgs(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := r.loadersFor(ctx).PostsByUserId.Load(ctx, loaders.PageKey{ID: obj.ID, Page: page})
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return postConnection(posts, page, size), nil
+}
+
+// Followers is the resolver for the followers field.
+func (r *userResolver) Followers(ctx context.Context, obj *models.User, first *int, after *string, last *int, before *string) (*model.UserConnection, error) {
+	const op = "resolver.Followers"
+	page, size, err := pageFromArgs(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	users, err := r.loadersFor(ctx).FollowersByUserId.Load(ctx, loaders.PageKey{ID: obj.ID, Page: page})
 	if err != nil {
 		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
 		return nil, server.ErrInternal
 	}
-	return posts, nil
+	return userConnection(users, page, size), nil
+}
+
+// Following is the resolver for the following field.
+func (r *userResolver) Following(ctx context.Context, obj *models.User, first *int, after *string, last *int, before *string) (*model.UserConnection, error) {
+	const op = "resolver.Following"
+	page, size, err := pageFromArgs(first, after, last, before)
+	if err != nil {
+		return nil, err
+	}
+	users, err := r.loadersFor(ctx).FollowingByUserId.Load(ctx, loaders.PageKey{ID: obj.ID, Page: page})
+	if err != nil {
+		r.log.Error("internal error", slog.String("op", op), sl.Err(err))
+		return nil, server.ErrInternal
+	}
+	return userConnection(users, page, size), nil
 }
 
 // Comment returns graph.CommentResolver implementation.
 func (r *Resolver) Comment() graph.CommentResolver { return &commentResolver{r} }
 
+// Hub returns graph.HubResolver implementation.
+func (r *Resolver) Hub() graph.HubResolver { return &hubResolver{r} }
+
 // Mutation returns graph.MutationResolver implementation.
 func (r *Resolver) Mutation() graph.MutationResolver { return &mutationResolver{r} }
 
@@ -295,6 +880,7 @@ func (r *Resolver) Subscription() graph.SubscriptionResolver { return &subscript
 func (r *Resolver) User() graph.UserResolver { return &userResolver{r} }
 
 type commentResolver struct{ *Resolver }
+type hubResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type postResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
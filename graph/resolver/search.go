@@ -0,0 +1,106 @@
+package resolver
+
+import (
+	"context"
+	"github.com/rmntim/ozon-task/graph/model"
+	"github.com/rmntim/ozon-task/internal/lib/graph/cursor"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"math"
+)
+
+// searchTypes maps GraphQL search types to storage ones.
+var searchTypes = map[model.SearchType]models.SearchType{
+	model.SearchTypePost:    models.SearchPost,
+	model.SearchTypeComment: models.SearchComment,
+	model.SearchTypeUser:    models.SearchUser,
+}
+
+// searchQueryFromArgs translates search arguments into a storage query
+// and the requested page size. Search cursors are offsets, and like
+// pageFromArgs the query fetches one extra hit.
+func searchQueryFromArgs(text string, types []model.SearchType, first *int, after *string) (models.SearchQuery, int, error) {
+	size := defaultPageSize
+	if first != nil {
+		size = *first
+	}
+	if size < 0 || size > maxPageSize {
+		return models.SearchQuery{}, 0, server.ErrInvalidPage
+	}
+
+	query := models.SearchQuery{Text: text, Limit: size + 1}
+	for _, t := range types {
+		query.Types = append(query.Types, searchTypes[t])
+	}
+
+	if after != nil {
+		offset, err := cursor.Decode(*after)
+		if err != nil || offset > math.MaxInt32 {
+			return models.SearchQuery{}, 0, server.ErrInvalidCursor
+		}
+		query.Offset = int(offset)
+	}
+
+	return query, size, nil
+}
+
+// searchConnection loads items of hits, skipping those gone since the
+// search, and trims hits down to size.
+func (r *Resolver) searchConnection(ctx context.Context, hits []*models.SearchHit, query models.SearchQuery, size int) (*model.SearchConnection, error) {
+	info := &model.PageInfo{HasPreviousPage: query.Offset > 0}
+	if len(hits) > size {
+		hits = hits[:size]
+		info.HasNextPage = true
+	}
+
+	ids := make(map[models.SearchType][]uint)
+	for _, hit := range hits {
+		ids[hit.Type] = append(ids[hit.Type], hit.ID)
+	}
+	posts, err := r.db.GetPostsByIds(ctx, ids[models.SearchPost])
+	if err != nil {
+		return nil, err
+	}
+	comments, err := r.db.GetCommentsByIds(ctx, ids[models.SearchComment])
+	if err != nil {
+		return nil, err
+	}
+	users, err := r.db.GetUsersByIds(ctx, ids[models.SearchUser])
+	if err != nil {
+		return nil, err
+	}
+	postsById := byID(posts, func(p *models.Post) uint { return p.ID })
+	commentsById := byID(comments, func(c *models.Comment) uint { return c.ID })
+	usersById := byID(users, func(u *models.User) uint { return u.ID })
+
+	edges := make([]*model.SearchEdge, 0, len(hits))
+	for i, hit := range hits {
+		node := &model.SearchHit{Snippet: hit.Snippet, Rank: hit.Rank}
+		switch hit.Type {
+		case models.SearchPost:
+			node.Type, node.Post = model.SearchTypePost, postsById[hit.ID]
+		case models.SearchComment:
+			node.Type, node.Comment = model.SearchTypeComment, commentsById[hit.ID]
+		case models.SearchUser:
+			node.Type, node.User = model.SearchTypeUser, usersById[hit.ID]
+		}
+		if node.Post == nil && node.Comment == nil && node.User == nil {
+			continue
+		}
+		edges = append(edges, &model.SearchEdge{Cursor: cursor.Encode(uint(query.Offset + i + 1)), Node: node})
+	}
+
+	if len(edges) > 0 {
+		info.StartCursor, info.EndCursor = &edges[0].Cursor, &edges[len(edges)-1].Cursor
+	}
+
+	return &model.SearchConnection{Edges: edges, PageInfo: info}, nil
+}
+
+func byID[T any](items []T, id func(T) uint) map[uint]T {
+	m := make(map[uint]T, len(items))
+	for _, item := range items {
+		m[id(item)] = item
+	}
+	return m
+}
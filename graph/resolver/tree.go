@@ -0,0 +1,81 @@
+package resolver
+
+import (
+	"github.com/rmntim/ozon-task/graph/model"
+	"github.com/rmntim/ozon-task/internal/lib/graph/cursor"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+)
+
+const maxTreeDepth = 20
+
+// treeQueryFromArgs validates comment tree arguments.
+func treeQueryFromArgs(postID uint, rootID *uint, maxDepth int, limitPerLevel int, after *string) (models.TreeQuery, error) {
+	if maxDepth < 1 || maxDepth > maxTreeDepth || limitPerLevel < 1 || limitPerLevel > maxPageSize {
+		return models.TreeQuery{}, server.ErrInvalidPage
+	}
+
+	query := models.TreeQuery{
+		PostID:   postID,
+		RootID:   rootID,
+		MaxDepth: maxDepth,
+		Limit:    limitPerLevel,
+	}
+
+	if after != nil {
+		id, err := cursor.Decode(*after)
+		if err != nil {
+			return models.TreeQuery{}, server.ErrInvalidCursor
+		}
+		query.After = models.Cursor{ID: id, Valid: true}
+	}
+
+	return query, nil
+}
+
+// commentTree converts tree to its GraphQL representation, marking
+// branches that were cut by the query limits.
+func commentTree(tree *models.CommentTree, query models.TreeQuery) *model.CommentTree {
+	loadedReplies := make(map[uint]int)
+	lastReply := make(map[uint]uint)
+	loadedFirstLevel := 0
+	var lastFirstLevel uint
+
+	for _, n := range tree.Nodes {
+		isFirstLevel := n.ParentCommentID == nil ||
+			(query.RootID != nil && *n.ParentCommentID == *query.RootID)
+		if isFirstLevel {
+			loadedFirstLevel++
+			lastFirstLevel = n.ID
+			continue
+		}
+		loadedReplies[*n.ParentCommentID]++
+		lastReply[*n.ParentCommentID] = n.ID
+	}
+
+	nodes := make([]*model.CommentTreeNode, len(tree.Nodes))
+	for i, n := range tree.Nodes {
+		node := &model.CommentTreeNode{
+			Comment:        &n.Comment,
+			Depth:          n.Depth,
+			ChildCount:     n.ChildCount,
+			HasMoreReplies: n.ChildCount > loadedReplies[n.ID],
+		}
+		if id, ok := lastReply[n.ID]; ok && node.HasMoreReplies {
+			c := cursor.Encode(id)
+			node.MoreRepliesCursor = &c
+		}
+		nodes[i] = node
+	}
+
+	res := &model.CommentTree{
+		Nodes:   nodes,
+		HasMore: tree.Remaining > loadedFirstLevel,
+	}
+	if loadedFirstLevel > 0 && res.HasMore {
+		c := cursor.Encode(lastFirstLevel)
+		res.MoreCursor = &c
+	}
+
+	return res
+}
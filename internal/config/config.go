@@ -14,6 +14,11 @@ type Config struct {
 	Env     string           `yaml:"env" env-required:"true"`
 	Storage string           `yaml:"storage" env-required:"true"`
 	Server  HTTPServerConfig `yaml:"http_server"`
+	Auth    AuthConfig       `yaml:"auth"`
+
+	Subscriptions SubscriptionsConfig `yaml:"subscriptions"`
+	Snapshot      SnapshotConfig      `yaml:"snapshot"`
+	Tracing       TracingConfig       `yaml:"tracing"`
 }
 
 type DBConfig struct {
@@ -23,10 +28,78 @@ type DBConfig struct {
 	Address  string `env:"DATABASE_ADDRESS" env-required:"true"`
 }
 
+// HTTPServerConfig configures the HTTP server. On shutdown, readiness
+// probe fails for DrainDelay before the server stops accepting requests,
+// so it should be longer than the readiness probe period.
 type HTTPServerConfig struct {
-	Address     string        `yaml:"address" env-required:"true"`
-	Timeout     time.Duration `yaml:"timeout" env-default:"5s"`
-	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	Address         string        `yaml:"address" env-required:"true"`
+	Timeout         time.Duration `yaml:"timeout" env-default:"5s"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env-default:"10s"`
+	DrainDelay      time.Duration `yaml:"drain_delay" env-default:"5s"`
+}
+
+// MinSecretLength is the minimum length in bytes of secrets signing
+// sessions and tokens, which is the size of an HMAC-SHA256 key.
+const MinSecretLength = 32
+
+// AuthConfig configures sessions and bearer tokens. Secret and
+// JWT.Secret must be at least MinSecretLength bytes long.
+type AuthConfig struct {
+	Secret     string        `yaml:"secret" env:"AUTH_SECRET" env-required:"true"`
+	SessionTTL time.Duration `yaml:"session_ttl" env-default:"720h"`
+	JWT        JWTConfig     `yaml:"jwt"`
+}
+
+// JWTConfig configures bearer tokens. HS256 tokens are signed with
+// Secret, or with a key derived from AuthConfig.Secret if it's empty.
+// RS256 tokens are signed with PEM-encoded RSA private key read from
+// KeyFile.
+type JWTConfig struct {
+	Algorithm       string        `yaml:"algorithm" env:"JWT_ALGORITHM" env-default:"HS256"`
+	Secret          string        `yaml:"secret" env:"JWT_SECRET"`
+	KeyFile         string        `yaml:"key_file" env:"JWT_KEY_FILE"`
+	Issuer          string        `yaml:"issuer" env-default:"ozon-task"`
+	Audience        string        `yaml:"audience" env-default:"ozon-task"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env-default:"15m"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
+}
+
+// SubscriptionsConfig configures delivery of subscription events.
+// Every subscriber buffers up to BufferSize events; once the buffer is
+// full, SlowSubscriberPolicy (`drop` or `disconnect`) applies.
+//
+// Bus is `memory` to deliver events within a single instance or
+// `postgres` to deliver them to all instances sharing the database.
+// It defaults to the storage type.
+type SubscriptionsConfig struct {
+	BufferSize           int    `yaml:"buffer_size" env-default:"16"`
+	SlowSubscriberPolicy string `yaml:"slow_subscriber_policy" env-default:"drop"`
+	Bus                  string `yaml:"bus" env:"SUBSCRIPTIONS_BUS"`
+}
+
+// SnapshotConfig configures persistence of `memory` storage. Every
+// change is appended to a write-ahead log next to Path, which is fsynced
+// every SyncInterval, or on every change if it's zero. The whole storage
+// is written to Path in Format (`gob` or `json`) every Interval and on
+// shutdown. If Path is empty, data is lost on restart.
+type SnapshotConfig struct {
+	Path         string        `yaml:"path" env:"SNAPSHOT_PATH"`
+	Format       string        `yaml:"format" env-default:"gob"`
+	Interval     time.Duration `yaml:"interval" env-default:"5m"`
+	SyncInterval time.Duration `yaml:"sync_interval" env-default:"1s"`
+}
+
+// TracingConfig configures OpenTelemetry tracing. Exporter is `none`,
+// `stdout` or `otlp`, which sends spans over HTTP to Endpoint, or to
+// OTEL_EXPORTER_OTLP_ENDPOINT if it's empty. SampleRatio is the share of
+// traces started by the server that are recorded; incoming requests
+// keep the decision of their caller.
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT"`
+	ServiceName string  `yaml:"service_name" env-default:"ozon-task"`
+	SampleRatio float64 `yaml:"sample_ratio" env-default:"1"`
 }
 
 // MustLoad reads config from config path and panics
@@ -57,6 +130,19 @@ func Load() (*Config, *DBConfig, error) {
 		return nil, nil, fmt.Errorf("failed to read config: %w", err)
 	}
 
+	// env-required only checks that AUTH_SECRET is set, and an empty or
+	// short secret lets anyone forge sessions and tokens.
+	if len(config.Auth.Secret) < MinSecretLength {
+		return nil, nil, fmt.Errorf("auth secret must be at least %d bytes long", MinSecretLength)
+	}
+	if config.Auth.JWT.Secret != "" && len(config.Auth.JWT.Secret) < MinSecretLength {
+		return nil, nil, fmt.Errorf("jwt secret must be at least %d bytes long", MinSecretLength)
+	}
+
+	if config.Subscriptions.Bus == "" {
+		config.Subscriptions.Bus = config.Storage
+	}
+
 	// TODO: Maybe should also read .env, but I don't care right now.
 	var dbConfig DBConfig
 	if config.Storage == "postgres" {
@@ -7,49 +7,102 @@ import (
 	"github.com/rmntim/ozon-task/internal/server"
 	"github.com/rmntim/ozon-task/internal/storage"
 	"net/http"
-	"strconv"
+	"strings"
+	"time"
 )
 
-var userCtxKey = &contextKey{}
+const cookieName = "auth-cookie"
 
-type contextKey struct{}
+var ErrNoResponse = errors.New("no response to set session cookie on")
 
-func Middleware(db storage.Storage) func(http.Handler) http.Handler {
+var (
+	userCtxKey    = &contextKey{"user"}
+	claimsCtxKey  = &contextKey{"claims"}
+	sessionCtxKey = &contextKey{"session"}
+)
+
+type contextKey struct {
+	name string
+}
+
+// session lets resolvers set the auth cookie on the response.
+type session struct {
+	w        http.ResponseWriter
+	sessions *Sessions
+	// cookie is set if the request was authenticated by the cookie.
+	cookie bool
+}
+
+// Middleware authenticates requests by `Authorization: Bearer <jwt>`
+// header or, if there's none, by the session cookie.
+func Middleware(db storage.Storage, sessions *Sessions, tokens *Tokens) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, err := r.Cookie("auth-cookie")
+			s := &session{w: w, sessions: sessions}
+			ctx := context.WithValue(r.Context(), sessionCtxKey, s)
 
-			if err != nil || c == nil {
-				next.ServeHTTP(w, r)
+			if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				claims, err := tokens.Validate(bearer)
+				if err != nil {
+					http.Error(w, "invalid token", http.StatusUnauthorized)
+					return
+				}
+				ctx = context.WithValue(ctx, claimsCtxKey, claims)
+
+				userId, err := claims.UserID()
+				if err != nil {
+					http.Error(w, "invalid token", http.StatusUnauthorized)
+					return
+				}
+
+				serveAs(db, userId, next, w, r.WithContext(ctx))
 				return
 			}
 
-			userId, err := validateAndGetUserID(c)
-			if err != nil {
-				http.Error(w, "Invalid cookie", http.StatusForbidden)
+			c, err := r.Cookie(cookieName)
+
+			if err != nil || c == nil {
+				next.ServeHTTP(w, r.WithContext(ctx))
 				return
 			}
 
-			user, err := db.GetUserById(r.Context(), uint(userId))
+			userId, err := validateAndGetUserID(ctx, sessions, c)
+			if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrExpiredToken) || errors.Is(err, ErrRevokedToken) {
+				// Stale cookies (e.g. signed with a rotated secret) shouldn't
+				// lock users out, so just drop them and carry on anonymously.
+				clearCookie(w)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
 			if err != nil {
-				if errors.Is(err, server.ErrUserNotFound) {
-					http.Error(w, "no such user", http.StatusNotFound)
-					return
-				}
 				http.Error(w, "internal server error", http.StatusInternalServerError)
 				return
 			}
+			s.cookie = true
 
-			ctx := context.WithValue(r.Context(), userCtxKey, user)
-
-			r = r.WithContext(ctx)
-			next.ServeHTTP(w, r)
+			serveAs(db, userId, next, w, r.WithContext(ctx))
 		})
 	}
 }
 
-func validateAndGetUserID(c *http.Cookie) (int, error) {
-	return strconv.Atoi(c.Value)
+// serveAs passes the request to next on behalf of the user.
+func serveAs(db storage.Storage, userId uint, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	user, err := db.GetUserById(r.Context(), userId)
+	if err != nil {
+		if errors.Is(err, server.ErrUserNotFound) {
+			http.Error(w, "no such user", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	r = r.WithContext(WithUser(r.Context(), user))
+	next.ServeHTTP(w, r)
+}
+
+func validateAndGetUserID(ctx context.Context, sessions *Sessions, c *http.Cookie) (uint, error) {
+	return sessions.Validate(ctx, c.Value)
 }
 
 // ForContext finds the user from the context. REQUIRES Middleware to have run.
@@ -57,3 +110,70 @@ func ForContext(ctx context.Context) *models.User {
 	raw, _ := ctx.Value(userCtxKey).(*models.User)
 	return raw
 }
+
+// WithUser returns a copy of ctx on behalf of the user.
+func WithUser(ctx context.Context, user *models.User) context.Context {
+	return context.WithValue(ctx, userCtxKey, user)
+}
+
+// ClaimsForContext finds the access token claims from the context. Returns nil
+// if the request wasn't authenticated with a bearer token. REQUIRES Middleware to have run.
+func ClaimsForContext(ctx context.Context) *Claims {
+	raw, _ := ctx.Value(claimsCtxKey).(*Claims)
+	return raw
+}
+
+// Login starts a session for the user by setting the auth cookie.
+// REQUIRES Middleware to have run.
+func Login(ctx context.Context, userID uint) error {
+	s, ok := ctx.Value(sessionCtxKey).(*session)
+	if !ok {
+		return ErrNoResponse
+	}
+
+	token, expiresAt, err := s.sessions.Issue(ctx, userID)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(s.w, &http.Cookie{
+		Name:     cookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+// Logout clears the auth cookie. If the request was authenticated by the
+// cookie, all sessions of the user are revoked too, so that copies of
+// the cookie stop working. REQUIRES Middleware to have run.
+func Logout(ctx context.Context) error {
+	s, ok := ctx.Value(sessionCtxKey).(*session)
+	if !ok {
+		return ErrNoResponse
+	}
+
+	if user := ForContext(ctx); s.cookie && user != nil {
+		if err := s.sessions.Revoke(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+	clearCookie(s.w)
+
+	return nil
+}
+
+func clearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
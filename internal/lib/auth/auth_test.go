@@ -1,30 +1,213 @@
 package auth_test
 
 import (
+	"context"
+	"github.com/rmntim/ozon-task/internal/config"
 	"github.com/rmntim/ozon-task/internal/lib/auth"
+	"github.com/rmntim/ozon-task/internal/storage"
 	"github.com/rmntim/ozon-task/internal/storage/inmemory"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 func TestForContext(t *testing.T) {
+	db := inmemory.New()
+	user, err := db.CreateUser(context.Background(), "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+
+	sessions := auth.NewSessions(db, "secret", time.Hour)
+	token, _, err := sessions.Issue(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal("token should be issued")
+	}
+
+	called := false
 	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		user := auth.ForContext(r.Context())
-		if user == nil {
-			t.Error("user is nil")
+		called = true
+		u := auth.ForContext(r.Context())
+		if u == nil {
+			t.Fatal("user is nil")
 		}
 
-		if user.ID != 1 {
-			t.Error("user id is not 1")
+		if u.ID != user.ID {
+			t.Error("user id doesn't match")
 		}
 	})
 
-	testHandler := auth.Middleware(inmemory.New())(nextHandler)
+	testHandler := auth.Middleware(db, sessions, newTokens(t, db))(nextHandler)
 	req := httptest.NewRequest("GET", "/", nil)
 	req.AddCookie(&http.Cookie{
 		Name:  "auth-cookie",
-		Value: "1",
+		Value: token,
 	})
 	testHandler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !called {
+		t.Error("next handler should be called")
+	}
+}
+
+func TestForgedCookie(t *testing.T) {
+	db := inmemory.New()
+	user, err := db.CreateUser(context.Background(), "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+
+	forged, _, err := auth.NewSessions(db, "other secret", time.Hour).Issue(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal("token should be issued")
+	}
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth.ForContext(r.Context()) != nil {
+			t.Error("user should not be authenticated")
+		}
+	})
+
+	testHandler := auth.Middleware(db, auth.NewSessions(db, "secret", time.Hour), newTokens(t, db))(nextHandler)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{
+		Name:  "auth-cookie",
+		Value: forged,
+	})
+	rec := httptest.NewRecorder()
+	testHandler.ServeHTTP(rec, req)
+
+	if len(rec.Result().Cookies()) == 0 {
+		t.Error("forged cookie should be cleared")
+	}
+}
+
+func TestLogin(t *testing.T) {
+	db := inmemory.New()
+	user, err := db.CreateUser(context.Background(), "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+	sessions := auth.NewSessions(db, "secret", time.Hour)
+
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := auth.Login(r.Context(), user.ID); err != nil {
+			t.Error("login should succeed")
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	auth.Middleware(db, sessions, newTokens(t, db))(nextHandler).ServeHTTP(rec, httptest.NewRequest("POST", "/", nil))
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatal("session cookie should be set")
+	}
+
+	if !cookies[0].HttpOnly {
+		t.Error("session cookie should be http only")
+	}
+
+	id, err := sessions.Validate(context.Background(), cookies[0].Value)
+	if err != nil || id != user.ID {
+		t.Error("session cookie should hold a valid token")
+	}
+}
+
+func TestLogout(t *testing.T) {
+	db := inmemory.New()
+	user, err := db.CreateUser(context.Background(), "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+	sessions := auth.NewSessions(db, "secret", time.Hour)
+	token, _, err := sessions.Issue(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal("token should be issued")
+	}
+
+	var authenticated bool
+	handler := auth.Middleware(db, sessions, newTokens(t, db))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authenticated = auth.ForContext(r.Context()) != nil
+		if r.URL.Path == "/logout" {
+			if err := auth.Logout(r.Context()); err != nil {
+				t.Error("logout should succeed")
+			}
+		}
+	}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.AddCookie(&http.Cookie{Name: "auth-cookie", Value: token})
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if serve("/logout"); !authenticated {
+		t.Fatal("user should be authenticated by the cookie before logout")
+	}
+	if serve("/"); authenticated {
+		t.Error("cookie captured before logout should be rejected")
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	db := inmemory.New()
+	user, err := db.CreateUser(context.Background(), "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+
+	tokens := newTokens(t, db)
+	pair, err := tokens.Issue(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal("tokens should be issued")
+	}
+
+	called := false
+	nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		u := auth.ForContext(r.Context())
+		if u == nil || u.ID != user.ID {
+			t.Error("user should be authenticated by bearer token")
+		}
+		if auth.ClaimsForContext(r.Context()) == nil {
+			t.Error("claims should be in context")
+		}
+	})
+
+	handler := auth.Middleware(db, auth.NewSessions(db, "secret", time.Hour), tokens)(nextHandler)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if !called {
+		t.Error("next handler should be called")
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken+"x")
+	rec := httptest.NewRecorder()
+	called = false
+	handler.ServeHTTP(rec, req)
+
+	if called || rec.Code != http.StatusUnauthorized {
+		t.Error("request with invalid bearer token should be rejected")
+	}
+}
+
+func newTokens(t *testing.T, db storage.Storage) *auth.Tokens {
+	t.Helper()
+	tokens, err := auth.NewTokens(db, config.JWTConfig{
+		Algorithm:       "HS256",
+		Issuer:          "test",
+		Audience:        "test",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, "secret")
+	if err != nil {
+		t.Fatal("tokens should be created")
+	}
+	return tokens
 }
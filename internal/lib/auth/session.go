@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid session token")
+	ErrExpiredToken = errors.New("session token expired")
+	ErrRevokedToken = errors.New("session token revoked")
+)
+
+// Sessions issues and validates HMAC-signed session tokens. Tokens are
+// `<user id>.<session version>.<expiration unix time>.<signature>`. The
+// version must match the one stored for the user, so revoking sessions
+// of the user invalidates tokens issued before, even if not expired.
+type Sessions struct {
+	db     storage.Storage
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewSessions(db storage.Storage, secret string, ttl time.Duration) *Sessions {
+	return &Sessions{
+		db:     db,
+		secret: deriveKey(secret, "session"),
+		ttl:    ttl,
+	}
+}
+
+// Issue creates a token for the user, valid for the configured TTL or
+// until sessions of the user are revoked.
+func (s *Sessions) Issue(ctx context.Context, userID uint) (token string, expiresAt time.Time, err error) {
+	const op = "auth.Sessions.Issue"
+
+	version, err := s.db.GetSessionVersion(ctx, userID)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	expiresAt = time.Now().Add(s.ttl).Truncate(time.Second)
+	payload := strconv.FormatUint(uint64(userID), 10) + "." +
+		strconv.FormatUint(uint64(version), 10) + "." +
+		strconv.FormatInt(expiresAt.Unix(), 10)
+	return payload + "." + s.sign(payload), expiresAt, nil
+}
+
+// Validate checks token signature, expiration and session version and
+// returns the user ID.
+func (s *Sessions) Validate(ctx context.Context, token string) (uint, error) {
+	const op = "auth.Sessions.Validate"
+
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 {
+		return 0, ErrInvalidToken
+	}
+	payload, signature := token[:i], token[i+1:]
+
+	if !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return 0, ErrInvalidToken
+	}
+
+	fields := strings.Split(payload, ".")
+	if len(fields) != 3 {
+		return 0, ErrInvalidToken
+	}
+
+	userID, err := strconv.ParseUint(fields[0], 10, 0)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	version, err := strconv.ParseUint(fields[1], 10, 0)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	expiresAt, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= expiresAt {
+		return 0, ErrExpiredToken
+	}
+
+	current, err := s.db.GetSessionVersion(ctx, uint(userID))
+	if err != nil {
+		if errors.Is(err, server.ErrUserNotFound) {
+			return 0, ErrRevokedToken
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	if uint(version) != current {
+		return 0, ErrRevokedToken
+	}
+
+	return uint(userID), nil
+}
+
+// Revoke ends all sessions of the user.
+func (s *Sessions) Revoke(ctx context.Context, userID uint) error {
+	const op = "auth.Sessions.Revoke"
+
+	if err := s.db.RevokeSessions(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// deriveKey derives a key for purpose from secret, so that a secret
+// shared by sessions and access tokens never signs both directly.
+func deriveKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,99 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/lib/auth"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/storage/inmemory"
+	"testing"
+	"time"
+)
+
+func TestSessions_Validate(t *testing.T) {
+	db, user := newSessionsDB(t)
+	sessions := auth.NewSessions(db, "secret", time.Hour)
+
+	token, expiresAt, err := sessions.Issue(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal("token should be issued")
+	}
+	if !expiresAt.After(time.Now()) {
+		t.Error("token should expire in the future")
+	}
+
+	id, err := sessions.Validate(context.Background(), token)
+	if err != nil {
+		t.Error("token should be valid")
+	}
+
+	if id != user.ID {
+		t.Error("user id should match")
+	}
+}
+
+func TestSessions_ValidateTampered(t *testing.T) {
+	db, user := newSessionsDB(t)
+	sessions := auth.NewSessions(db, "secret", time.Hour)
+
+	token, _, err := sessions.Issue(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal("token should be issued")
+	}
+	tampered := "2" + token[1:]
+
+	for _, tok := range []string{"", "42", tampered} {
+		if _, err := sessions.Validate(context.Background(), tok); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("token %q should be invalid", tok)
+		}
+	}
+}
+
+func TestSessions_ValidateExpired(t *testing.T) {
+	db, user := newSessionsDB(t)
+	sessions := auth.NewSessions(db, "secret", -time.Hour)
+
+	token, _, err := sessions.Issue(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal("token should be issued")
+	}
+	if _, err := sessions.Validate(context.Background(), token); !errors.Is(err, auth.ErrExpiredToken) {
+		t.Error("token should be expired")
+	}
+}
+
+func TestSessions_Revoke(t *testing.T) {
+	ctx := context.Background()
+	db, user := newSessionsDB(t)
+	sessions := auth.NewSessions(db, "secret", time.Hour)
+
+	token, _, err := sessions.Issue(ctx, user.ID)
+	if err != nil {
+		t.Fatal("token should be issued")
+	}
+	if err := sessions.Revoke(ctx, user.ID); err != nil {
+		t.Fatal("sessions should be revoked")
+	}
+
+	if _, err := sessions.Validate(ctx, token); !errors.Is(err, auth.ErrRevokedToken) {
+		t.Error("token issued before revocation should be revoked, got:", err)
+	}
+
+	token, _, err = sessions.Issue(ctx, user.ID)
+	if err != nil {
+		t.Fatal("token should be issued")
+	}
+	if _, err := sessions.Validate(ctx, token); err != nil {
+		t.Error("token issued after revocation should be valid, got:", err)
+	}
+}
+
+func newSessionsDB(t *testing.T) (*inmemory.Storage, *models.User) {
+	t.Helper()
+	db := inmemory.New()
+	user, err := db.CreateUser(context.Background(), "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+	return db, user
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rmntim/ozon-task/internal/config"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+)
+
+// Claims are the claims of access tokens. Subject holds the user ID.
+type Claims struct {
+	jwt.RegisteredClaims
+}
+
+// TokenPair is a short-lived access token along with a refresh token,
+// which can be exchanged for a new pair exactly once.
+type TokenPair struct {
+	UserID               uint
+	AccessToken          string
+	AccessTokenExpiresAt time.Time
+	RefreshToken         string
+}
+
+// Tokens issues JWT access tokens and rotates refresh tokens. Refresh
+// tokens of one login form a family: reusing a rotated token revokes
+// the whole family, since either its holder or the attacker has it.
+type Tokens struct {
+	db         storage.Storage
+	method     jwt.SigningMethod
+	signKey    any
+	verifyKey  any
+	issuer     string
+	audience   string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+// NewTokens creates Tokens from config, reading RSA key file if needed.
+// When no JWT secret is configured, the HS256 key is derived from
+// fallbackSecret, which sessions derive their own key from too.
+func NewTokens(db storage.Storage, cfg config.JWTConfig, fallbackSecret string) (*Tokens, error) {
+	const op = "auth.NewTokens"
+
+	t := &Tokens{
+		db:         db,
+		issuer:     cfg.Issuer,
+		audience:   cfg.Audience,
+		accessTTL:  cfg.AccessTokenTTL,
+		refreshTTL: cfg.RefreshTokenTTL,
+	}
+
+	switch cfg.Algorithm {
+	case "HS256":
+		key := []byte(cfg.Secret)
+		if cfg.Secret == "" {
+			key = deriveKey(fallbackSecret, "jwt-hs256")
+		}
+		t.method = jwt.SigningMethodHS256
+		t.signKey, t.verifyKey = key, key
+	case "RS256":
+		pem, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		t.method = jwt.SigningMethodRS256
+		t.signKey, t.verifyKey = key, &key.PublicKey
+	default:
+		return nil, fmt.Errorf("%s: unsupported algorithm: %s", op, cfg.Algorithm)
+	}
+
+	return t, nil
+}
+
+// Issue starts a new refresh token family for the user.
+func (t *Tokens) Issue(ctx context.Context, userID uint) (*TokenPair, error) {
+	family, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	return t.issue(ctx, userID, family)
+}
+
+// Refresh exchanges a refresh token for a new pair. The old refresh
+// token can't be used again.
+func (t *Tokens) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	token, err := t.db.UseRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, server.ErrTokenReused) {
+			if err := t.db.RevokeRefreshTokens(ctx, token.Family); err != nil {
+				return nil, err
+			}
+			return nil, server.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		return nil, server.ErrInvalidToken
+	}
+
+	return t.issue(ctx, token.UserID, token.Family)
+}
+
+// Revoke invalidates the refresh token along with its whole family.
+func (t *Tokens) Revoke(ctx context.Context, refreshToken string) error {
+	token, err := t.db.UseRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil && !errors.Is(err, server.ErrTokenReused) {
+		return err
+	}
+	return t.db.RevokeRefreshTokens(ctx, token.Family)
+}
+
+// Validate checks access token signature and its exp, nbf, iss and aud claims.
+func (t *Tokens) Validate(accessToken string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(accessToken, &claims,
+		func(*jwt.Token) (any, error) { return t.verifyKey, nil },
+		jwt.WithValidMethods([]string{t.method.Alg()}),
+		jwt.WithIssuer(t.issuer),
+		jwt.WithAudience(t.audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, server.ErrInvalidToken
+	}
+	return &claims, nil
+}
+
+// UserID returns the ID of the user the claims were issued to.
+func (c *Claims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 0)
+	if err != nil {
+		return 0, server.ErrInvalidToken
+	}
+	return uint(id), nil
+}
+
+func (t *Tokens) issue(ctx context.Context, userID uint, family string) (*TokenPair, error) {
+	const op = "auth.Tokens.issue"
+
+	id, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(t.accessTTL)
+	accessToken, err := jwt.NewWithClaims(t.method, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Issuer:    t.issuer,
+			Subject:   strconv.FormatUint(uint64(userID), 10),
+			Audience:  jwt.ClaimStrings{t.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}).SignedString(t.signKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := t.db.CreateRefreshToken(ctx, &models.RefreshToken{
+		Hash:      hashToken(refreshToken),
+		UserID:    userID,
+		Family:    family,
+		ExpiresAt: now.Add(t.refreshTTL),
+	}); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &TokenPair{
+		UserID:               userID,
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: expiresAt,
+		RefreshToken:         refreshToken,
+	}, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,133 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/config"
+	"github.com/rmntim/ozon-task/internal/lib/auth"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage/inmemory"
+	"testing"
+	"time"
+)
+
+func TestTokensValidate(t *testing.T) {
+	db := inmemory.New()
+	tokens := newTokens(t, db)
+
+	pair, err := tokens.Issue(context.Background(), 42)
+	if err != nil {
+		t.Fatal("tokens should be issued")
+	}
+
+	claims, err := tokens.Validate(pair.AccessToken)
+	if err != nil {
+		t.Fatal("access token should be valid")
+	}
+	if id, err := claims.UserID(); err != nil || id != 42 {
+		t.Error("access token should hold user id")
+	}
+
+	other, err := auth.NewTokens(db, config.JWTConfig{
+		Algorithm:       "HS256",
+		Issuer:          "other",
+		Audience:        "test",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, "secret")
+	if err != nil {
+		t.Fatal("tokens should be created")
+	}
+	if _, err := other.Validate(pair.AccessToken); !errors.Is(err, server.ErrInvalidToken) {
+		t.Error("access token from another issuer should be invalid")
+	}
+
+	expired, err := auth.NewTokens(db, config.JWTConfig{
+		Algorithm:       "HS256",
+		Issuer:          "test",
+		Audience:        "test",
+		AccessTokenTTL:  -time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, "secret")
+	if err != nil {
+		t.Fatal("tokens should be created")
+	}
+	pair, err = expired.Issue(context.Background(), 42)
+	if err != nil {
+		t.Fatal("tokens should be issued")
+	}
+	if _, err := tokens.Validate(pair.AccessToken); !errors.Is(err, server.ErrInvalidToken) {
+		t.Error("expired access token should be invalid")
+	}
+}
+
+func TestTokensFallbackSecret(t *testing.T) {
+	db := inmemory.New()
+	pair, err := newTokens(t, db).Issue(context.Background(), 42)
+	if err != nil {
+		t.Fatal("tokens should be issued")
+	}
+
+	raw, err := auth.NewTokens(db, config.JWTConfig{
+		Algorithm:       "HS256",
+		Secret:          "secret",
+		Issuer:          "test",
+		Audience:        "test",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	}, "")
+	if err != nil {
+		t.Fatal("tokens should be created")
+	}
+	if _, err := raw.Validate(pair.AccessToken); !errors.Is(err, server.ErrInvalidToken) {
+		t.Error("access token should not be signed with the session secret itself")
+	}
+}
+
+func TestTokensRefresh(t *testing.T) {
+	tokens := newTokens(t, inmemory.New())
+	ctx := context.Background()
+
+	first, err := tokens.Issue(ctx, 42)
+	if err != nil {
+		t.Fatal("tokens should be issued")
+	}
+
+	second, err := tokens.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatal("refresh token should be exchanged")
+	}
+	if second.UserID != 42 || second.RefreshToken == first.RefreshToken {
+		t.Error("refresh should issue new tokens for the same user")
+	}
+
+	if _, err := tokens.Refresh(ctx, first.RefreshToken); !errors.Is(err, server.ErrInvalidToken) {
+		t.Error("used refresh token should be invalid")
+	}
+
+	if _, err := tokens.Refresh(ctx, second.RefreshToken); !errors.Is(err, server.ErrInvalidToken) {
+		t.Error("reuse should revoke the whole family")
+	}
+}
+
+func TestTokensRevoke(t *testing.T) {
+	tokens := newTokens(t, inmemory.New())
+	ctx := context.Background()
+
+	pair, err := tokens.Issue(ctx, 42)
+	if err != nil {
+		t.Fatal("tokens should be issued")
+	}
+
+	if err := tokens.Revoke(ctx, pair.RefreshToken); err != nil {
+		t.Fatal("refresh token should be revoked")
+	}
+
+	if _, err := tokens.Refresh(ctx, pair.RefreshToken); !errors.Is(err, server.ErrInvalidToken) {
+		t.Error("revoked refresh token should be invalid")
+	}
+
+	if err := tokens.Revoke(ctx, "unknown"); !errors.Is(err, server.ErrInvalidToken) {
+		t.Error("revoking unknown token should fail")
+	}
+}
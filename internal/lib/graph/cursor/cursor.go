@@ -0,0 +1,37 @@
+package cursor
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const prefix = "cursor:"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Encode makes an opaque cursor pointing at item with given ID.
+func Encode(id uint) string {
+	return base64.StdEncoding.EncodeToString([]byte(prefix + strconv.FormatUint(uint64(id), 10)))
+}
+
+// Decode extracts item ID from a cursor made by Encode.
+func Decode(cursor string) (uint, error) {
+	raw, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	s, ok := strings.CutPrefix(string(raw), prefix)
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseUint(s, 10, 0)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+
+	return uint(id), nil
+}
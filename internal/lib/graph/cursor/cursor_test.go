@@ -0,0 +1,26 @@
+package cursor_test
+
+import (
+	"errors"
+	"github.com/rmntim/ozon-task/internal/lib/graph/cursor"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	id, err := cursor.Decode(cursor.Encode(42))
+	if err != nil {
+		t.Error("cursor should be decoded")
+	}
+
+	if id != 42 {
+		t.Error("decoded id should be 42")
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, c := range []string{"", "42", "bm90LWEtY3Vyc29y"} {
+		if _, err := cursor.Decode(c); !errors.Is(err, cursor.ErrInvalidCursor) {
+			t.Errorf("cursor %q should be invalid", c)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package presenter
+
+import (
+	"context"
+	"errors"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/rmntim/ozon-task/internal/lib/graph/cursor"
+	"github.com/rmntim/ozon-task/internal/lib/validation"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/server/middleware/requestid"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"log/slog"
+	"runtime/debug"
+)
+
+// Codes are set in extensions.code of errors, so that clients don't
+// have to match on messages.
+const (
+	CodeBadUserInput    = "BAD_USER_INPUT"
+	CodeUnauthenticated = "UNAUTHENTICATED"
+	CodeForbidden       = "FORBIDDEN"
+	CodeNotFound        = "NOT_FOUND"
+	CodeConflict        = "CONFLICT"
+	CodeInternal        = "INTERNAL_SERVER_ERROR"
+)
+
+var codes = []struct {
+	err  error
+	code string
+}{
+	{server.ErrUserNotFound, CodeNotFound},
+	{server.ErrPostNotFound, CodeNotFound},
+	{server.ErrCommentNotFound, CodeNotFound},
+	{server.ErrCommentsDisabled, CodeForbidden},
+	{server.ErrParentCommentMismatch, CodeBadUserInput},
+	{server.ErrHubNotFound, CodeNotFound},
+	{server.ErrHubSlugTaken, CodeConflict},
+	{server.ErrSelfFollow, CodeBadUserInput},
+	{server.ErrUnauthenticated, CodeUnauthenticated},
+	{server.ErrUnauthorized, CodeForbidden},
+	{server.ErrBadCredentials, CodeUnauthenticated},
+	{server.ErrInvalidToken, CodeUnauthenticated},
+	{server.ErrTokenReused, CodeUnauthenticated},
+	{server.ErrUsernameTaken, CodeConflict},
+	{server.ErrEmailTaken, CodeConflict},
+	{server.ErrInvalidCursor, CodeBadUserInput},
+	{cursor.ErrInvalidCursor, CodeBadUserInput},
+	{server.ErrInvalidPage, CodeBadUserInput},
+	{server.ErrInternal, CodeInternal},
+}
+
+// Code returns extensions.code for err, or an empty string if err
+// isn't one of the known errors.
+func Code(err error) string {
+	var errs validation.Errors
+	if errors.As(err, &errs) {
+		return CodeBadUserInput
+	}
+	for _, c := range codes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return ""
+}
+
+// ErrorPresenter sets extensions.code of every error it knows, unless
+// the resolver has already set one.
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+	if _, ok := gqlErr.Extensions["code"]; ok {
+		return gqlErr
+	}
+
+	code := Code(err)
+	if code == "" {
+		return gqlErr
+	}
+	if gqlErr.Extensions == nil {
+		gqlErr.Extensions = make(map[string]any)
+	}
+	gqlErr.Extensions["code"] = code
+	return gqlErr
+}
+
+// Recover logs a panic of a resolver, and reports it to the client as
+// an internal error along with the request ID to look the log up by.
+func Recover(log *slog.Logger) graphql.RecoverFunc {
+	return func(ctx context.Context, p any) error {
+		id := requestid.FromContext(ctx)
+		log.Error("resolver panicked",
+			slog.String("request_id", id),
+			slog.Any("panic", p),
+			slog.String("stack", string(debug.Stack())),
+		)
+
+		return &gqlerror.Error{
+			Message: server.ErrInternal.Error(),
+			Extensions: map[string]any{
+				"code":       CodeInternal,
+				"request_id": id,
+			},
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package presenter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rmntim/ozon-task/internal/lib/graph/presenter"
+	"github.com/rmntim/ozon-task/internal/lib/validation"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"io"
+	"log/slog"
+	"testing"
+)
+
+func TestErrorPresenter(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		err  error
+		code string
+	}{
+		{server.ErrPostNotFound, presenter.CodeNotFound},
+		{fmt.Errorf("op: %w", server.ErrUsernameTaken), presenter.CodeConflict},
+		{server.ErrUnauthenticated, presenter.CodeUnauthenticated},
+		{server.ErrUnauthorized, presenter.CodeForbidden},
+		{validation.Comment(""), presenter.CodeBadUserInput},
+	} {
+		if got := presenter.ErrorPresenter(ctx, tt.err); got.Extensions["code"] != tt.code {
+			t.Errorf("%v should have code %s", tt.err, tt.code)
+		}
+	}
+
+	if got := presenter.ErrorPresenter(ctx, errors.New("unknown")); got.Extensions["code"] != nil {
+		t.Error("unknown error should have no code")
+	}
+
+	custom := &gqlerror.Error{Message: "custom", Extensions: map[string]any{"code": "CUSTOM"}}
+	if got := presenter.ErrorPresenter(ctx, custom); got.Extensions["code"] != "CUSTOM" {
+		t.Error("code set by resolver should be kept")
+	}
+}
+
+func TestRecover(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	err := presenter.Recover(log)(context.Background(), "boom")
+
+	var gqlErr *gqlerror.Error
+	if !errors.As(err, &gqlErr) || gqlErr.Extensions["code"] != presenter.CodeInternal {
+		t.Error("panic should be reported as internal error")
+	}
+	if gqlErr.Message != server.ErrInternal.Error() {
+		t.Error("panic details should not be exposed")
+	}
+}
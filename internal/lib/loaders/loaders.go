@@ -0,0 +1,317 @@
+package loaders
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"github.com/vikstrous/dataloadgen"
+)
+
+// wait is how long loaders collect keys before issuing a batch.
+const wait = 2 * time.Millisecond
+
+var loadersCtxKey = &contextKey{}
+
+type contextKey struct{}
+
+// Loaders batch lookups made by field resolvers, so that every nesting
+// level of a query costs a single storage call.
+type Loaders struct {
+	UserById           *dataloadgen.Loader[uint, *models.User]
+	PostById           *dataloadgen.Loader[uint, *models.Post]
+	CommentById        *dataloadgen.Loader[uint, *models.Comment]
+	PostsByUserId      *dataloadgen.Loader[PageKey, []*models.Post]
+	CommentsByPostId   *dataloadgen.Loader[PageKey, []*models.Comment]
+	RepliesByCommentId *dataloadgen.Loader[PageKey, []*models.Comment]
+	FollowersByUserId  *dataloadgen.Loader[PageKey, []*models.User]
+	FollowingByUserId  *dataloadgen.Loader[PageKey, []*models.User]
+
+	PostRevisionsByPostId       *dataloadgen.Loader[uint, []*models.PostRevision]
+	CommentRevisionsByCommentId *dataloadgen.Loader[uint, []*models.CommentRevision]
+
+	PostVote    *dataloadgen.Loader[VoteKey, int]
+	CommentVote *dataloadgen.Loader[VoteKey, int]
+}
+
+// PageKey identifies a page of items belonging to the parent with ID.
+type PageKey struct {
+	ID   uint
+	Page models.Page
+	// IncludeDeleted is only used for comments.
+	IncludeDeleted bool
+}
+
+// VoteKey identifies the vote of the user on the post or the comment
+// with ID. Loaded value is 0 if the user hasn't voted.
+type VoteKey struct {
+	UserID uint
+	ID     uint
+}
+
+// New creates a fresh set of loaders. Loaders cache results, so they
+// must not outlive a single request.
+func New(db storage.Storage) *Loaders {
+	r := &reader{db: db}
+	return &Loaders{
+		UserById:           dataloadgen.NewLoader(r.getUsers, dataloadgen.WithWait(wait)),
+		PostById:           dataloadgen.NewLoader(r.getPosts, dataloadgen.WithWait(wait)),
+		CommentById:        dataloadgen.NewLoader(r.getComments, dataloadgen.WithWait(wait)),
+		PostsByUserId:      dataloadgen.NewLoader(r.getPostsByUsers, dataloadgen.WithWait(wait)),
+		CommentsByPostId:   dataloadgen.NewLoader(r.getCommentsByPosts, dataloadgen.WithWait(wait)),
+		RepliesByCommentId: dataloadgen.NewLoader(r.getRepliesByComments, dataloadgen.WithWait(wait)),
+		FollowersByUserId:  dataloadgen.NewLoader(r.getFollowersByUsers, dataloadgen.WithWait(wait)),
+		FollowingByUserId:  dataloadgen.NewLoader(r.getFollowingByUsers, dataloadgen.WithWait(wait)),
+
+		PostRevisionsByPostId:       dataloadgen.NewLoader(r.getPostRevisions, dataloadgen.WithWait(wait)),
+		CommentRevisionsByCommentId: dataloadgen.NewLoader(r.getCommentRevisions, dataloadgen.WithWait(wait)),
+
+		PostVote:    dataloadgen.NewLoader(r.getPostVotes, dataloadgen.WithWait(wait)),
+		CommentVote: dataloadgen.NewLoader(r.getCommentVotes, dataloadgen.WithWait(wait)),
+	}
+}
+
+// Middleware injects new loaders into every request context. Websocket
+// connections are skipped, because their context lives as long as the
+// connection and cached values would go stale.
+func Middleware(db storage.Storage) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Upgrade") == "websocket" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), loadersCtxKey, New(db))
+
+			r = r.WithContext(ctx)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// For finds the loaders from the context. Returns nil if Middleware
+// hasn't attached any.
+func For(ctx context.Context) *Loaders {
+	raw, _ := ctx.Value(loadersCtxKey).(*Loaders)
+	return raw
+}
+
+type reader struct {
+	db storage.Storage
+}
+
+func (r *reader) getUsers(ctx context.Context, ids []uint) ([]*models.User, []error) {
+	users, err := r.db.GetUsersByIds(ctx, ids)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return mapByKey(ids, users, func(u *models.User) uint { return u.ID }, server.ErrUserNotFound)
+}
+
+func (r *reader) getPosts(ctx context.Context, ids []uint) ([]*models.Post, []error) {
+	posts, err := r.db.GetPostsByIds(ctx, ids)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return mapByKey(ids, posts, func(p *models.Post) uint { return p.ID }, server.ErrPostNotFound)
+}
+
+func (r *reader) getComments(ctx context.Context, ids []uint) ([]*models.Comment, []error) {
+	comments, err := r.db.GetCommentsByIds(ctx, ids)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return mapByKey(ids, comments, func(c *models.Comment) uint { return c.ID }, server.ErrCommentNotFound)
+}
+
+func (r *reader) getPostsByUsers(ctx context.Context, keys []PageKey) ([][]*models.Post, []error) {
+	fetch := func(ctx context.Context, ids []uint, k PageKey) ([]*models.Post, error) {
+		return r.db.GetPostsByUserIds(ctx, ids, k.Page)
+	}
+	return loadPages(ctx, keys, fetch, func(p *models.Post) uint { return p.AuthorID })
+}
+
+func (r *reader) getCommentsByPosts(ctx context.Context, keys []PageKey) ([][]*models.Comment, []error) {
+	fetch := func(ctx context.Context, ids []uint, k PageKey) ([]*models.Comment, error) {
+		return r.db.GetCommentsByPostIds(ctx, ids, k.Page, k.IncludeDeleted)
+	}
+	return loadPages(ctx, keys, fetch, func(c *models.Comment) uint { return c.PostID })
+}
+
+func (r *reader) getRepliesByComments(ctx context.Context, keys []PageKey) ([][]*models.Comment, []error) {
+	fetch := func(ctx context.Context, ids []uint, k PageKey) ([]*models.Comment, error) {
+		return r.db.GetRepliesByCommentIds(ctx, ids, k.Page, k.IncludeDeleted)
+	}
+	return loadPages(ctx, keys, fetch, func(c *models.Comment) uint { return *c.ParentCommentID })
+}
+
+func (r *reader) getFollowersByUsers(ctx context.Context, keys []PageKey) ([][]*models.User, []error) {
+	return loadFollows(ctx, keys, r.db.GetFollowersByUserIds)
+}
+
+func (r *reader) getFollowingByUsers(ctx context.Context, keys []PageKey) ([][]*models.User, []error) {
+	return loadFollows(ctx, keys, r.db.GetFollowingByUserIds)
+}
+
+func (r *reader) getPostRevisions(ctx context.Context, ids []uint) ([][]*models.PostRevision, []error) {
+	revisions, err := r.db.GetPostRevisionsByPostIds(ctx, ids)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return groupByKey(ids, revisions, func(r *models.PostRevision) uint { return r.PostID }), nil
+}
+
+func (r *reader) getCommentRevisions(ctx context.Context, ids []uint) ([][]*models.CommentRevision, []error) {
+	revisions, err := r.db.GetCommentRevisionsByCommentIds(ctx, ids)
+	if err != nil {
+		return nil, []error{err}
+	}
+	return groupByKey(ids, revisions, func(r *models.CommentRevision) uint { return r.CommentID }), nil
+}
+
+func (r *reader) getPostVotes(ctx context.Context, keys []VoteKey) ([]int, []error) {
+	return loadVotes(ctx, keys, r.db.GetPostVotes)
+}
+
+func (r *reader) getCommentVotes(ctx context.Context, keys []VoteKey) ([]int, []error) {
+	return loadVotes(ctx, keys, r.db.GetCommentVotes)
+}
+
+// loadVotes fetches votes for every key, issuing one storage call per
+// user. It's always the current user, so it's a single call.
+func loadVotes(
+	ctx context.Context,
+	keys []VoteKey,
+	fetch func(ctx context.Context, userId uint, ids []uint) ([]*models.Vote, error),
+) ([]int, []error) {
+	idsByUser := make(map[uint][]uint)
+	for _, k := range keys {
+		idsByUser[k.UserID] = append(idsByUser[k.UserID], k.ID)
+	}
+
+	values := make(map[VoteKey]int, len(keys))
+	for userId, ids := range idsByUser {
+		votes, err := fetch(ctx, userId, ids)
+		if err != nil {
+			return nil, []error{err}
+		}
+		for _, v := range votes {
+			values[VoteKey{UserID: v.UserID, ID: v.TargetID}] = v.Value
+		}
+	}
+
+	res := make([]int, len(keys))
+	for i, k := range keys {
+		res[i] = values[k]
+	}
+	return res, nil
+}
+
+// loadFollows fetches pages of followers or followed users for every key,
+// the same way as loadPages.
+func loadFollows(
+	ctx context.Context,
+	keys []PageKey,
+	fetch func(ctx context.Context, userIds []uint, page models.Page) ([]*models.Follow, error),
+) ([][]*models.User, []error) {
+	pages, errs := loadPages(ctx, keys, func(ctx context.Context, ids []uint, k PageKey) ([]*models.Follow, error) {
+		return fetch(ctx, ids, k.Page)
+	}, func(f *models.Follow) uint { return f.TargetID })
+	if errs != nil {
+		return nil, errs
+	}
+
+	res := make([][]*models.User, len(pages))
+	for i, follows := range pages {
+		res[i] = make([]*models.User, len(follows))
+		for j, f := range follows {
+			res[i][j] = &f.User
+		}
+	}
+	return res, nil
+}
+
+// mapByKey orders values to match keys, reporting notFound for every
+// key that has no value.
+func mapByKey[V any](keys []uint, values []V, key func(V) uint, notFound error) ([]V, []error) {
+	byKey := make(map[uint]V, len(values))
+	for _, v := range values {
+		byKey[key(v)] = v
+	}
+
+	res := make([]V, len(keys))
+	errs := make([]error, len(keys))
+	for i, k := range keys {
+		v, ok := byKey[k]
+		if !ok {
+			errs[i] = notFound
+			continue
+		}
+		res[i] = v
+	}
+	return res, errs
+}
+
+// groupByKey buckets values by key, preserving their order. Keys
+// without values get empty slices.
+func groupByKey[V any](keys []uint, values []V, key func(V) uint) [][]V {
+	byKey := make(map[uint][]V, len(keys))
+	for _, v := range values {
+		byKey[key(v)] = append(byKey[key(v)], v)
+	}
+
+	res := make([][]V, len(keys))
+	for i, k := range keys {
+		if byKey[k] == nil {
+			res[i] = make([]V, 0)
+			continue
+		}
+		res[i] = byKey[k]
+	}
+	return res
+}
+
+// loadPages fetches pages of children for every key, issuing one storage
+// call per distinct page. Sibling fields share arguments, so it's usually
+// a single call. Children are bucketed by parent, preserving their order.
+// fetch gets the key of the page with ID unset.
+func loadPages[V any](
+	ctx context.Context,
+	keys []PageKey,
+	fetch func(ctx context.Context, ids []uint, page PageKey) ([]V, error),
+	parent func(V) uint,
+) ([][]V, []error) {
+	idsByPage := make(map[PageKey][]uint)
+	for _, k := range keys {
+		page := k
+		page.ID = 0
+		idsByPage[page] = append(idsByPage[page], k.ID)
+	}
+
+	byKey := make(map[PageKey][]V, len(keys))
+	for page, ids := range idsByPage {
+		values, err := fetch(ctx, ids, page)
+		if err != nil {
+			return nil, []error{err}
+		}
+		for _, v := range values {
+			k := page
+			k.ID = parent(v)
+			byKey[k] = append(byKey[k], v)
+		}
+	}
+
+	res := make([][]V, len(keys))
+	for i, k := range keys {
+		if byKey[k] == nil {
+			res[i] = make([]V, 0)
+			continue
+		}
+		res[i] = byKey[k]
+	}
+	return res, nil
+}
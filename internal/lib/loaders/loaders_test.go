@@ -0,0 +1,205 @@
+package loaders_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rmntim/ozon-task/internal/lib/loaders"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"github.com/rmntim/ozon-task/internal/storage/inmemory"
+)
+
+type countingStorage struct {
+	storage.Storage
+	calls atomic.Int32
+}
+
+func (s *countingStorage) GetUsersByIds(ctx context.Context, ids []uint) ([]*models.User, error) {
+	s.calls.Add(1)
+	return s.Storage.GetUsersByIds(ctx, ids)
+}
+
+func (s *countingStorage) GetCommentsByPostIds(ctx context.Context, postIds []uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	s.calls.Add(1)
+	return s.Storage.GetCommentsByPostIds(ctx, postIds, page, includeDeleted)
+}
+
+func (s *countingStorage) GetFollowersByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Follow, error) {
+	s.calls.Add(1)
+	return s.Storage.GetFollowersByUserIds(ctx, userIds, page)
+}
+
+func TestLoaders_UserByIdBatches(t *testing.T) {
+	ctx := context.Background()
+	db := &countingStorage{Storage: inmemory.New()}
+
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("test%d", i)
+		if _, err := db.CreateUser(ctx, name, name, "test"); err != nil {
+			t.Fatal("user should be created")
+		}
+	}
+
+	l := loaders.New(db)
+
+	var wg sync.WaitGroup
+	for i := uint(0); i < 5; i++ {
+		wg.Add(1)
+		go func(id uint) {
+			defer wg.Done()
+			user, err := l.UserById.Load(ctx, id)
+			if err != nil {
+				t.Error("user should be loaded")
+				return
+			}
+			if user.ID != id {
+				t.Error("loaded user id should match key")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if calls := db.calls.Load(); calls != 1 {
+		t.Errorf("storage should be called once, got %d", calls)
+	}
+}
+
+func TestLoaders_UserByIdNotFound(t *testing.T) {
+	l := loaders.New(inmemory.New())
+
+	_, err := l.UserById.Load(context.Background(), 42)
+	if !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("should return ErrUserNotFound")
+	}
+}
+
+func TestLoaders_CommentsByPostId(t *testing.T) {
+	ctx := context.Background()
+	db := &countingStorage{Storage: inmemory.New()}
+
+	user, err := db.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+
+	first, err := db.CreatePost(ctx, "test", "test", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created")
+	}
+
+	second, err := db.CreatePost(ctx, "test", "test", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created")
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := db.CreateComment(ctx, "test", user.ID, first.ID, nil); err != nil {
+			t.Fatal("comment should be created")
+		}
+	}
+
+	l := loaders.New(db)
+
+	page := models.Page{Limit: 2}
+	comments, err := l.CommentsByPostId.LoadAll(ctx, []loaders.PageKey{
+		{ID: first.ID, Page: page},
+		{ID: second.ID, Page: page},
+	})
+	if err != nil {
+		t.Fatal("comments should be loaded")
+	}
+
+	if len(comments[0]) != 2 {
+		t.Error("first post should have a full page of comments")
+	}
+
+	if comments[1] == nil || len(comments[1]) != 0 {
+		t.Error("second post should have empty comments")
+	}
+
+	if calls := db.calls.Load(); calls != 1 {
+		t.Errorf("storage should be called once, got %d", calls)
+	}
+}
+
+func TestLoaders_PostVote(t *testing.T) {
+	ctx := context.Background()
+	db := inmemory.New()
+
+	user, err := db.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+	voted, err := db.CreatePost(ctx, "test", "test", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created")
+	}
+	other, err := db.CreatePost(ctx, "test", "test", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created")
+	}
+	if _, err := db.VotePost(ctx, voted.ID, user.ID, -1); err != nil {
+		t.Fatal("post should be voted on")
+	}
+
+	votes, err := loaders.New(db).PostVote.LoadAll(ctx, []loaders.VoteKey{
+		{UserID: user.ID, ID: voted.ID},
+		{UserID: user.ID, ID: other.ID},
+	})
+	if err != nil {
+		t.Fatal("votes should be loaded")
+	}
+	if votes[0] != -1 || votes[1] != 0 {
+		t.Error("votes should be loaded by post, with 0 for no vote, got", votes)
+	}
+}
+
+func TestLoaders_FollowersByUserId(t *testing.T) {
+	ctx := context.Background()
+	db := &countingStorage{Storage: inmemory.New()}
+
+	users := make([]*models.User, 4)
+	for i := range users {
+		name := fmt.Sprintf("test%d", i)
+		user, err := db.CreateUser(ctx, name, name, "test")
+		if err != nil {
+			t.Fatal("user should be created")
+		}
+		users[i] = user
+	}
+	followed, idle := users[0], users[1]
+	for _, follower := range users[1:] {
+		if _, err := db.FollowUser(ctx, followed.ID, follower.ID); err != nil {
+			t.Fatal("user should be followed")
+		}
+	}
+
+	l := loaders.New(db)
+
+	page := models.Page{Limit: 2}
+	followers, err := l.FollowersByUserId.LoadAll(ctx, []loaders.PageKey{
+		{ID: followed.ID, Page: page},
+		{ID: idle.ID, Page: page},
+	})
+	if err != nil {
+		t.Fatal("followers should be loaded")
+	}
+
+	if len(followers[0]) != 2 || followers[0][0].ID != users[1].ID || followers[0][1].ID != users[2].ID {
+		t.Error("followed user should have a full page of followers")
+	}
+
+	if followers[1] == nil || len(followers[1]) != 0 {
+		t.Error("idle user should have no followers")
+	}
+
+	if calls := db.calls.Load(); calls != 1 {
+		t.Errorf("storage should be called once, got %d", calls)
+	}
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"database/sql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rmntim/ozon-task/internal/lib/pubsub"
+	"strings"
+)
+
+// StatsSource is a pubsub.Broker of any event type.
+type StatsSource interface {
+	Stats() pubsub.Stats
+}
+
+// RegisterBroker exports subscriptions of the broker, labeled with name.
+func (m *Metrics) RegisterBroker(name string, broker StatsSource) {
+	labels := prometheus.Labels{"broker": name}
+	m.registry.MustRegister(&brokerCollector{
+		broker: broker,
+		subscriptions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "subscriptions", "active"),
+			"Live subscriptions by topic. Per-post topics are counted together.",
+			[]string{"topic"}, labels,
+		),
+		dropped: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "subscriptions", "dropped_events_total"),
+			"Events skipped for subscribers with full buffers.",
+			nil, labels,
+		),
+		disconnected: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "subscriptions", "disconnected_total"),
+			"Subscribers disconnected for not keeping up.",
+			nil, labels,
+		),
+	})
+}
+
+// RegisterDB exports connection pool stats.
+func (m *Metrics) RegisterDB(stats func() sql.DBStats) {
+	m.registry.MustRegister(&dbCollector{stats: stats})
+}
+
+type brokerCollector struct {
+	broker StatsSource
+
+	subscriptions *prometheus.Desc
+	dropped       *prometheus.Desc
+	disconnected  *prometheus.Desc
+}
+
+func (c *brokerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.subscriptions
+	ch <- c.dropped
+	ch <- c.disconnected
+}
+
+func (c *brokerCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.broker.Stats()
+
+	topics := make(map[string]int, len(stats.Topics))
+	for topic, subscribers := range stats.Topics {
+		topics[topicKind(topic)] += subscribers
+	}
+	for topic, subscribers := range topics {
+		ch <- prometheus.MustNewConstMetric(c.subscriptions, prometheus.GaugeValue, float64(subscribers), topic)
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(stats.Dropped))
+	ch <- prometheus.MustNewConstMetric(c.disconnected, prometheus.CounterValue, float64(stats.Disconnected))
+}
+
+// topicKind strips the ID off per-post topics, e.g. `comment.added.42`,
+// so that the number of series doesn't grow with the number of posts.
+func topicKind(topic string) string {
+	i := strings.LastIndexByte(topic, '.')
+	if i < 0 {
+		return topic
+	}
+	if strings.Trim(topic[i+1:], "0123456789") != "" {
+		return topic
+	}
+	return topic[:i]
+}
+
+var (
+	dbMaxOpenDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "max_open_connections"),
+		"Maximum number of open connections.", nil, nil,
+	)
+	dbOpenDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "open_connections"),
+		"Open connections, both in use and idle.", nil, nil,
+	)
+	dbInUseDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "in_use_connections"),
+		"Connections in use.", nil, nil,
+	)
+	dbIdleDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "idle_connections"),
+		"Idle connections.", nil, nil,
+	)
+	dbWaitCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "wait_count_total"),
+		"Times a connection had to be waited for.", nil, nil,
+	)
+	dbWaitDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db", "wait_duration_seconds_total"),
+		"Time spent waiting for connections.", nil, nil,
+	)
+)
+
+type dbCollector struct {
+	stats func() sql.DBStats
+}
+
+func (c *dbCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dbMaxOpenDesc
+	ch <- dbOpenDesc
+	ch <- dbInUseDesc
+	ch <- dbIdleDesc
+	ch <- dbWaitCountDesc
+	ch <- dbWaitDurationDesc
+}
+
+func (c *dbCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.stats()
+
+	ch <- prometheus.MustNewConstMetric(dbMaxOpenDesc, prometheus.GaugeValue, float64(stats.MaxOpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbOpenDesc, prometheus.GaugeValue, float64(stats.OpenConnections))
+	ch <- prometheus.MustNewConstMetric(dbInUseDesc, prometheus.GaugeValue, float64(stats.InUse))
+	ch <- prometheus.MustNewConstMetric(dbIdleDesc, prometheus.GaugeValue, float64(stats.Idle))
+	ch <- prometheus.MustNewConstMetric(dbWaitCountDesc, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(dbWaitDurationDesc, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"time"
+)
+
+// codeUnknown labels errors without extensions.code.
+const codeUnknown = "UNKNOWN"
+
+// GraphQL returns gqlgen extension that records operations, fields
+// and errors.
+func (m *Metrics) GraphQL() graphql.HandlerExtension {
+	return &extension{m: m}
+}
+
+type extension struct {
+	m *Metrics
+}
+
+var (
+	_ graphql.HandlerExtension    = &extension{}
+	_ graphql.ResponseInterceptor = &extension{}
+	_ graphql.FieldInterceptor    = &extension{}
+)
+
+func (e *extension) ExtensionName() string {
+	return "Metrics"
+}
+
+func (e *extension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptResponse counts errors of every response, including those of
+// requests that failed validation. Subscriptions respond once per event,
+// so only queries and mutations are timed. Operations aren't labeled
+// with their names, which clients choose freely.
+func (e *extension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	resp := next(ctx)
+	if resp == nil {
+		return nil
+	}
+
+	for _, err := range resp.Errors {
+		code, ok := err.Extensions["code"].(string)
+		if !ok {
+			code = codeUnknown
+		}
+		e.m.errors.WithLabelValues(code).Inc()
+	}
+
+	if !graphql.HasOperationContext(ctx) {
+		return resp
+	}
+	oc := graphql.GetOperationContext(ctx)
+	if oc.Operation == nil || oc.Operation.Operation == ast.Subscription {
+		return resp
+	}
+
+	e.m.operations.
+		WithLabelValues(string(oc.Operation.Operation)).
+		Observe(time.Since(oc.Stats.OperationStart).Seconds())
+
+	return resp
+}
+
+// InterceptField times fields with resolvers. Other fields are only
+// read from structs, and timing them would cost more than resolving.
+func (e *extension) InterceptField(ctx context.Context, next graphql.Resolver) (any, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	start := time.Now()
+	res, err := next(ctx)
+	e.m.fields.WithLabelValues(fc.Object, fc.Field.Name).Observe(time.Since(start).Seconds())
+
+	return res, err
+}
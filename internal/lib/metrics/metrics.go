@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+const namespace = "ozon_task"
+
+// Metrics holds collectors of the server in its own registry, so that
+// tests can create as many as they need.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	operations *prometheus.HistogramVec
+	fields     *prometheus.HistogramVec
+	errors     *prometheus.CounterVec
+	storage    *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		operations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "graphql",
+			Name:      "operation_duration_seconds",
+			Help:      "Time to execute GraphQL queries and mutations.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"type"}),
+		fields: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "graphql",
+			Name:      "field_duration_seconds",
+			Help:      "Time to resolve GraphQL fields that have resolvers.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"object", "field"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "graphql",
+			Name:      "errors_total",
+			Help:      "GraphQL errors returned to clients by extensions.code.",
+		}, []string{"code"}),
+		storage: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "storage",
+			Name:      "call_duration_seconds",
+			Help:      "Time spent in storage methods.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.operations,
+		m.fields,
+		m.errors,
+		m.storage,
+	)
+
+	return m
+}
+
+// Handler serves the metrics to Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveStorage records a call of a storage method that started at start.
+func (m *Metrics) ObserveStorage(method string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.storage.WithLabelValues(method, result).Observe(time.Since(start).Seconds())
+}
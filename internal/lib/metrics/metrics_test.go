@@ -0,0 +1,121 @@
+package metrics_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/rmntim/ozon-task/graph"
+	"github.com/rmntim/ozon-task/graph/resolver"
+	"github.com/rmntim/ozon-task/internal/lib/graph/presenter"
+	"github.com/rmntim/ozon-task/internal/lib/metrics"
+	"github.com/rmntim/ozon-task/internal/lib/pubsub"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/storage/inmemory"
+	"github.com/rmntim/ozon-task/internal/storage/instrumented"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphQL(t *testing.T) {
+	m := metrics.New()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	posts := pubsub.New[*models.Post](1, pubsub.Drop)
+	comments := pubsub.New[*models.Comment](1, pubsub.Drop)
+	db := instrumented.New(inmemory.New(), m)
+
+	srv := handler.NewDefaultServer(graph.NewExecutableSchema(resolver.New(db, log, nil, posts, comments)))
+	srv.SetErrorPresenter(presenter.ErrorPresenter)
+	srv.Use(m.GraphQL())
+	c := client.New(srv)
+
+	var resp any
+	if err := c.Post(`query Users { users(first: 1) { pageInfo { hasNextPage } } }`, &resp); err != nil {
+		t.Fatal("query should succeed:", err)
+	}
+	if err := c.Post(`{ nope }`, &resp); err == nil {
+		t.Fatal("invalid query should fail")
+	}
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`ozon_task_graphql_operation_duration_seconds_count{type="query"} 1`,
+		`ozon_task_graphql_field_duration_seconds_count{field="users",object="Query"} 1`,
+		`ozon_task_graphql_errors_total{code="GRAPHQL_VALIDATION_FAILED"} 1`,
+		`ozon_task_storage_call_duration_seconds_count{method="GetUsers",result="ok"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Error("metrics should contain", want)
+		}
+	}
+	if strings.Contains(body, `name="Users"`) {
+		t.Error("operations should not be labeled with names chosen by clients")
+	}
+	if strings.Contains(body, `field="hasNextPage"`) {
+		t.Error("fields without resolvers should not be timed")
+	}
+}
+
+func TestObserveStorage(t *testing.T) {
+	m := metrics.New()
+	m.ObserveStorage("GetPostById", time.Now(), errors.New("not found"))
+
+	if body := scrape(t, m); !strings.Contains(body, `ozon_task_storage_call_duration_seconds_count{method="GetPostById",result="error"} 1`) {
+		t.Error("failed call should be recorded as error")
+	}
+}
+
+func TestRegisterBroker(t *testing.T) {
+	m := metrics.New()
+	broker := pubsub.New[int](1, pubsub.Drop)
+	m.RegisterBroker("comments", broker)
+	m.RegisterBroker("posts", pubsub.New[int](1, pubsub.Drop))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker.Subscribe(ctx, "comment.added.1")
+	broker.Subscribe(ctx, "comment.added.2")
+	broker.Subscribe(ctx, "post.created")
+
+	body := scrape(t, m)
+	if !strings.Contains(body, `ozon_task_subscriptions_active{broker="comments",topic="comment.added"} 2`) {
+		t.Error("per-post topics should be counted together")
+	}
+	if !strings.Contains(body, `ozon_task_subscriptions_active{broker="comments",topic="post.created"} 1`) {
+		t.Error("topics should be counted separately")
+	}
+}
+
+func TestRegisterDB(t *testing.T) {
+	m := metrics.New()
+	m.RegisterDB(func() sql.DBStats {
+		return sql.DBStats{MaxOpenConnections: 10, OpenConnections: 3, InUse: 1, Idle: 2}
+	})
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		"ozon_task_db_max_open_connections 10",
+		"ozon_task_db_in_use_connections 1",
+		"ozon_task_db_idle_connections 2",
+	} {
+		if !strings.Contains(body, want) {
+			t.Error("metrics should contain", want)
+		}
+	}
+}
+
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != 200 {
+		t.Fatal("metrics should be served, got status", rec.Code)
+	}
+	return rec.Body.String()
+}
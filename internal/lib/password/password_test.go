@@ -0,0 +1,31 @@
+package password_test
+
+import (
+	"github.com/rmntim/ozon-task/internal/lib/password"
+	"testing"
+)
+
+func TestHashAndCheck(t *testing.T) {
+	hash, err := password.Hash("secret")
+	if err != nil {
+		t.Fatal("password should be hashed")
+	}
+
+	if string(hash) == "secret" {
+		t.Error("hash should differ from password")
+	}
+
+	if !password.Check(hash, "secret") {
+		t.Error("password should match its hash")
+	}
+
+	if password.Check(hash, "wrong") {
+		t.Error("wrong password should not match")
+	}
+}
+
+func TestCheckNilHash(t *testing.T) {
+	if password.Check(nil, "secret") {
+		t.Error("nil hash should never match")
+	}
+}
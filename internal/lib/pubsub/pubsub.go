@@ -0,0 +1,190 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Policy decides what happens to a subscriber whose buffer is full.
+type Policy int
+
+const (
+	// Drop skips the event for the lagging subscriber only.
+	Drop Policy = iota
+	// Disconnect closes the lagging subscriber's channel, so that the
+	// client notices it has missed events and can resubscribe.
+	Disconnect
+)
+
+// ParsePolicy parses `drop` or `disconnect`.
+func ParsePolicy(s string) (Policy, error) {
+	switch s {
+	case "drop":
+		return Drop, nil
+	case "disconnect":
+		return Disconnect, nil
+	}
+	return 0, fmt.Errorf("unknown slow subscriber policy: %s", s)
+}
+
+// Stats are counters of a broker, meant to be exported as metrics.
+type Stats struct {
+	Subscribers int
+	// Topics holds the number of subscribers of every topic.
+	Topics       map[string]int
+	Dropped      uint64
+	Disconnected uint64
+}
+
+// Forwarder carries published events elsewhere, e.g. to other server
+// instances. It must eventually hand them back to Broker.Deliver.
+type Forwarder[T any] interface {
+	Forward(topic string, event T)
+}
+
+// Broker delivers events published to a topic to every subscriber of
+// that topic. Publishing never blocks: every subscriber has a bounded
+// buffer, and the policy handles subscribers that don't keep up.
+type Broker[T any] struct {
+	bufferSize int
+	policy     Policy
+	forwarder  Forwarder[T]
+
+	mu     sync.Mutex
+	topics map[string]map[*subscription[T]]struct{}
+	closed bool
+
+	dropped      atomic.Uint64
+	disconnected atomic.Uint64
+}
+
+type subscription[T any] struct {
+	ch   chan T
+	stop func() bool
+}
+
+func New[T any](bufferSize int, policy Policy) *Broker[T] {
+	return &Broker[T]{
+		bufferSize: bufferSize,
+		policy:     policy,
+		topics:     make(map[string]map[*subscription[T]]struct{}),
+	}
+}
+
+// Subscribe returns a channel of events published to the topic. The
+// channel is closed once ctx is done, the subscriber is disconnected or
+// the broker is closed.
+func (b *Broker[T]) Subscribe(ctx context.Context, topic string) <-chan T {
+	sub := &subscription[T]{ch: make(chan T, b.bufferSize)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(sub.ch)
+		return sub.ch
+	}
+
+	subs, ok := b.topics[topic]
+	if !ok {
+		subs = make(map[*subscription[T]]struct{})
+		b.topics[topic] = subs
+	}
+	subs[sub] = struct{}{}
+
+	sub.stop = context.AfterFunc(ctx, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.remove(topic, sub)
+	})
+
+	return sub.ch
+}
+
+// ForwardTo makes the broker pass published events to f instead of
+// delivering them right away. It must be called before publishing.
+func (b *Broker[T]) ForwardTo(f Forwarder[T]) {
+	b.forwarder = f
+}
+
+// Publish sends the event to every subscriber of the topic, through
+// the forwarder if there's one.
+func (b *Broker[T]) Publish(topic string, event T) {
+	if b.forwarder != nil {
+		b.forwarder.Forward(topic, event)
+		return
+	}
+	b.Deliver(topic, event)
+}
+
+// Deliver sends the event to every local subscriber of the topic.
+func (b *Broker[T]) Deliver(topic string, event T) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.topics[topic] {
+		select {
+		case sub.ch <- event:
+			continue
+		default:
+		}
+
+		b.dropped.Add(1)
+		if b.policy == Disconnect {
+			sub.stop()
+			b.remove(topic, sub)
+			b.disconnected.Add(1)
+		}
+	}
+}
+
+// Close closes channels of all subscribers, so that subscriptions end
+// gracefully, and of those who subscribe later.
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for topic, subs := range b.topics {
+		for sub := range subs {
+			sub.stop()
+			b.remove(topic, sub)
+		}
+	}
+}
+
+func (b *Broker[T]) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscribers := 0
+	topics := make(map[string]int, len(b.topics))
+	for topic, subs := range b.topics {
+		subscribers += len(subs)
+		topics[topic] = len(subs)
+	}
+
+	return Stats{
+		Subscribers:  subscribers,
+		Topics:       topics,
+		Dropped:      b.dropped.Load(),
+		Disconnected: b.disconnected.Load(),
+	}
+}
+
+// remove closes the subscription, unless it's already gone.
+// REQUIRES b.mu to be held.
+func (b *Broker[T]) remove(topic string, sub *subscription[T]) {
+	subs := b.topics[topic]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.topics, topic)
+	}
+	close(sub.ch)
+}
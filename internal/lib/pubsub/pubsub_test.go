@@ -0,0 +1,176 @@
+package pubsub_test
+
+import (
+	"context"
+	"github.com/rmntim/ozon-task/internal/lib/pubsub"
+	"sync"
+	"testing"
+)
+
+func TestBroker_Publish(t *testing.T) {
+	b := pubsub.New[int](1, pubsub.Drop)
+	ctx := context.Background()
+
+	first := b.Subscribe(ctx, "first")
+	second := b.Subscribe(ctx, "second")
+
+	if topics := b.Stats().Topics; topics["first"] != 1 || topics["second"] != 1 {
+		t.Error("subscribers should be counted per topic")
+	}
+
+	b.Publish("first", 42)
+
+	if v := <-first; v != 42 {
+		t.Error("subscriber should receive published event")
+	}
+
+	select {
+	case <-second:
+		t.Error("subscriber should not receive events of other topics")
+	default:
+	}
+}
+
+func TestBroker_Unsubscribe(t *testing.T) {
+	b := pubsub.New[int](1, pubsub.Drop)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events := b.Subscribe(ctx, "topic")
+	cancel()
+
+	if _, ok := <-events; ok {
+		t.Error("channel should be closed once context is done")
+	}
+
+	if b.Stats().Subscribers != 0 {
+		t.Error("subscriber should be removed")
+	}
+
+	// Publishing to a topic with no subscribers left must not panic.
+	b.Publish("topic", 42)
+}
+
+func TestBroker_Close(t *testing.T) {
+	b := pubsub.New[int](1, pubsub.Drop)
+	ctx := context.Background()
+
+	first := b.Subscribe(ctx, "first")
+	second := b.Subscribe(ctx, "second")
+	b.Close()
+
+	if _, ok := <-first; ok {
+		t.Error("channel should be closed once broker is closed")
+	}
+	if _, ok := <-second; ok {
+		t.Error("channels of all topics should be closed")
+	}
+	if b.Stats().Subscribers != 0 {
+		t.Error("subscribers should be removed")
+	}
+
+	if _, ok := <-b.Subscribe(ctx, "first"); ok {
+		t.Error("subscribing to closed broker should return closed channel")
+	}
+
+	// Publishing to a closed broker must not panic.
+	b.Publish("first", 42)
+}
+
+func TestBroker_Drop(t *testing.T) {
+	b := pubsub.New[int](1, pubsub.Drop)
+
+	events := b.Subscribe(context.Background(), "topic")
+	b.Publish("topic", 1)
+	b.Publish("topic", 2)
+
+	if v := <-events; v != 1 {
+		t.Error("buffered event should be delivered")
+	}
+
+	select {
+	case <-events:
+		t.Error("event should be dropped for lagging subscriber")
+	default:
+	}
+
+	if stats := b.Stats(); stats.Dropped != 1 || stats.Subscribers != 1 {
+		t.Error("dropped event should be counted, keeping the subscriber")
+	}
+}
+
+func TestBroker_Disconnect(t *testing.T) {
+	b := pubsub.New[int](1, pubsub.Disconnect)
+
+	events := b.Subscribe(context.Background(), "topic")
+	b.Publish("topic", 1)
+	b.Publish("topic", 2)
+
+	if v := <-events; v != 1 {
+		t.Error("buffered event should be delivered")
+	}
+
+	if _, ok := <-events; ok {
+		t.Error("lagging subscriber should be disconnected")
+	}
+
+	if stats := b.Stats(); stats.Disconnected != 1 || stats.Subscribers != 0 {
+		t.Error("disconnected subscriber should be counted and removed")
+	}
+}
+
+func TestBroker_Concurrent(t *testing.T) {
+	b := pubsub.New[int](1, pubsub.Disconnect)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithCancel(context.Background())
+			b.Subscribe(ctx, "topic")
+			cancel()
+		}()
+		go func() {
+			defer wg.Done()
+			b.Publish("topic", i)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestParsePolicy(t *testing.T) {
+	if p, err := pubsub.ParsePolicy("disconnect"); err != nil || p != pubsub.Disconnect {
+		t.Error("disconnect policy should be parsed")
+	}
+
+	if _, err := pubsub.ParsePolicy("block"); err == nil {
+		t.Error("unknown policy should not be parsed")
+	}
+}
+
+type loopback struct {
+	broker *pubsub.Broker[int]
+	topics []string
+}
+
+func (l *loopback) Forward(topic string, event int) {
+	l.topics = append(l.topics, topic)
+	l.broker.Deliver(topic, event+1)
+}
+
+func TestBroker_ForwardTo(t *testing.T) {
+	b := pubsub.New[int](1, pubsub.Drop)
+	f := &loopback{broker: b}
+	b.ForwardTo(f)
+
+	events := b.Subscribe(context.Background(), "topic")
+	b.Publish("topic", 1)
+
+	if len(f.topics) != 1 || f.topics[0] != "topic" {
+		t.Error("event should be forwarded")
+	}
+
+	if v := <-events; v != 2 {
+		t.Error("subscriber should receive forwarded event")
+	}
+}
@@ -0,0 +1,96 @@
+package tracing
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// GraphQL returns gqlgen extension that starts a span for every
+// operation and a child span for every field with a resolver.
+func GraphQL() graphql.HandlerExtension {
+	return extension{}
+}
+
+type extension struct{}
+
+var (
+	_ graphql.HandlerExtension    = extension{}
+	_ graphql.ResponseInterceptor = extension{}
+	_ graphql.FieldInterceptor    = extension{}
+)
+
+func (extension) ExtensionName() string {
+	return "Tracing"
+}
+
+func (extension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptResponse spans the execution of an operation. Subscriptions
+// respond once per event, so they get a span per event. The document
+// isn't recorded, as inline arguments may hold passwords and tokens.
+func (extension) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	if !graphql.HasOperationContext(ctx) {
+		return next(ctx)
+	}
+	oc := graphql.GetOperationContext(ctx)
+	if oc.Operation == nil {
+		return next(ctx)
+	}
+
+	kind := string(oc.Operation.Operation)
+	name := oc.OperationName
+	if name == "" {
+		name = oc.Operation.Name
+	}
+	spanName := kind
+	if name != "" {
+		spanName += " " + name
+	}
+
+	opts := []trace.SpanStartOption{
+		trace.WithAttributes(
+			attribute.String("graphql.operation.type", kind),
+			attribute.String("graphql.operation.name", name),
+		),
+	}
+	// Include parsing and validation in the span of a single response.
+	if oc.Operation.Operation != ast.Subscription {
+		opts = append(opts, trace.WithTimestamp(oc.Stats.OperationStart))
+	}
+
+	ctx, span := tracer().Start(ctx, spanName, opts...)
+	defer span.End()
+
+	resp := next(ctx)
+	if resp != nil && len(resp.Errors) > 0 {
+		span.SetStatus(codes.Error, resp.Errors.Error())
+	}
+	return resp
+}
+
+// InterceptField spans fields with resolvers. Other fields are only
+// read from structs and would only add noise to traces.
+func (extension) InterceptField(ctx context.Context, next graphql.Resolver) (any, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || !fc.IsResolver {
+		return next(ctx)
+	}
+
+	ctx, span := tracer().Start(ctx, fc.Object+"."+fc.Field.Name, trace.WithAttributes(
+		attribute.String("graphql.field.path", fc.Path().String()),
+	))
+	defer span.End()
+
+	res, err := next(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return res, err
+}
@@ -0,0 +1,122 @@
+package tracing_test
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/client"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/rmntim/ozon-task/graph"
+	"github.com/rmntim/ozon-task/graph/resolver"
+	"github.com/rmntim/ozon-task/internal/config"
+	"github.com/rmntim/ozon-task/internal/lib/pubsub"
+	"github.com/rmntim/ozon-task/internal/lib/tracing"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/storage/inmemory"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGraphQL(t *testing.T) {
+	recorder := record(t)
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	posts := pubsub.New[*models.Post](1, pubsub.Drop)
+	comments := pubsub.New[*models.Comment](1, pubsub.Drop)
+	srv := handler.NewDefaultServer(graph.NewExecutableSchema(resolver.New(inmemory.New(), log, nil, posts, comments)))
+	srv.Use(tracing.GraphQL())
+
+	var resp any
+	if err := client.New(srv).Post(`query Users { users(first: 1) { pageInfo { hasNextPage } } }`, &resp); err != nil {
+		t.Fatal("query should succeed:", err)
+	}
+
+	spans := byName(recorder.Ended())
+	operation, ok := spans["query Users"]
+	if !ok {
+		t.Fatal("operation should be traced")
+	}
+	field, ok := spans["Query.users"]
+	if !ok {
+		t.Fatal("field with resolver should be traced")
+	}
+	if field.Parent().SpanID() != operation.SpanContext().SpanID() {
+		t.Error("field span should be a child of operation span")
+	}
+	for _, attr := range operation.Attributes() {
+		if strings.Contains(attr.Value.Emit(), "first: 1") {
+			t.Error("operation span should not hold the document, got", attr.Key)
+		}
+	}
+	if _, ok := spans["PageInfo.hasNextPage"]; ok {
+		t.Error("fields without resolvers should not be traced")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+	h := tracing.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	r := httptest.NewRequest("POST", "/query", nil)
+	r.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatal("only requests to the API should be traced, got", len(spans), "spans")
+	}
+	if spans[0].Name() != "POST /query" {
+		t.Error("span should be named after the request, got", spans[0].Name())
+	}
+	if spans[0].SpanContext().TraceID().String() != traceID {
+		t.Error("span should continue the trace of the caller")
+	}
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), config.TracingConfig{Exporter: "none"})
+	if err != nil {
+		t.Fatal("tracing should be set up without exporter:", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Error("tracing should be shut down:", err)
+	}
+
+	if _, err := tracing.Setup(context.Background(), config.TracingConfig{Exporter: "zipkin"}); err == nil {
+		t.Error("unknown exporter should be rejected")
+	}
+}
+
+// record installs global tracer provider that keeps spans in memory.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	if _, err := tracing.Setup(context.Background(), config.TracingConfig{Exporter: "none"}); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prev)
+	})
+
+	return recorder
+}
+
+func byName(spans []sdktrace.ReadOnlySpan) map[string]sdktrace.ReadOnlySpan {
+	m := make(map[string]sdktrace.ReadOnlySpan, len(spans))
+	for _, span := range spans {
+		m[span.Name()] = span
+	}
+	return m
+}
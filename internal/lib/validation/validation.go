@@ -0,0 +1,222 @@
+package validation
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits match column sizes of the postgres schema, so that both
+// storages accept the same input.
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 50
+	MaxEmailLength    = 100
+	// MaxPasswordLength is the most bcrypt takes into account.
+	MaxPasswordLength = 72
+	MaxTitleLength    = 255
+	MaxCommentLength  = 2000
+	MaxSearchLength   = 256
+	MinSlugLength     = 3
+	MaxSlugLength     = 50
+	MaxHubTitleLength = 100
+	// MaxHubDescriptionLength is the longest description of a hub, which
+	// may be empty.
+	MaxHubDescriptionLength = 1000
+	// MaxPostHubs is how many hubs a post may be published to.
+	MaxPostHubs = 5
+)
+
+var (
+	usernameRe = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+	slugRe     = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// FieldError describes an invalid input field.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Errors are all problems found with the input, in argument order.
+// Checks return nil if the input is valid.
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// User checks arguments of user registration.
+func User(username, email, password string) Errors {
+	var errs Errors
+	errs.add("username", checkUsername(username))
+	errs.add("email", checkEmail(email))
+	errs.add("password", checkPassword(password))
+	return errs
+}
+
+// Post checks title and content of a post.
+func Post(title, content string) Errors {
+	var errs Errors
+	errs.add("title", checkTitle(title))
+	errs.add("content", checkNotEmpty(content))
+	return errs
+}
+
+// Comment checks content of a comment. Length is counted in runes,
+// as VARCHAR limits are counted in characters.
+func Comment(content string) Errors {
+	var errs Errors
+	errs.add("content", checkComment(content))
+	return errs
+}
+
+// Vote checks value of a vote: 1 upvotes, -1 downvotes and 0 retracts
+// the vote.
+func Vote(value int) Errors {
+	var errs Errors
+	if value < -1 || value > 1 {
+		errs.add("value", "must be -1, 0 or 1")
+	}
+	return errs
+}
+
+// Hub checks arguments of hub creation.
+func Hub(slug, title, description string) Errors {
+	var errs Errors
+	errs.add("slug", checkSlug(slug))
+	errs.add("title", checkHubTitle(title))
+	if utf8.RuneCountInString(description) > MaxHubDescriptionLength {
+		errs.add("description", "must be at most 1000 characters long")
+	}
+	return errs
+}
+
+// PostHubs checks hubs a post is published to.
+func PostHubs(hubIds []uint) Errors {
+	var errs Errors
+	if len(hubIds) > MaxPostHubs {
+		errs.add("hubIds", "must list at most 5 hubs")
+	}
+	return errs
+}
+
+// Search checks a full-text search query.
+func Search(query string) Errors {
+	var errs Errors
+	errs.add("query", checkSearch(query))
+	return errs
+}
+
+// Checks return a message describing the problem, or an empty string.
+
+func checkUsername(username string) string {
+	if n := utf8.RuneCountInString(username); n < MinUsernameLength || n > MaxUsernameLength {
+		return "must be from 3 to 50 characters long"
+	}
+	if !usernameRe.MatchString(username) {
+		return "must only contain latin letters, digits and underscores"
+	}
+	return ""
+}
+
+func checkEmail(email string) string {
+	if utf8.RuneCountInString(email) > MaxEmailLength {
+		return "must be at most 100 characters long"
+	}
+	// Display names and comments are valid in addresses, but not here.
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+func checkPassword(password string) string {
+	if password == "" {
+		return "must not be empty"
+	}
+	if len(password) > MaxPasswordLength {
+		return "must be at most 72 bytes long"
+	}
+	return ""
+}
+
+func checkTitle(title string) string {
+	if msg := checkNotEmpty(title); msg != "" {
+		return msg
+	}
+	if utf8.RuneCountInString(title) > MaxTitleLength {
+		return "must be at most 255 characters long"
+	}
+	return ""
+}
+
+func checkComment(content string) string {
+	if msg := checkNotEmpty(content); msg != "" {
+		return msg
+	}
+	if utf8.RuneCountInString(content) > MaxCommentLength {
+		return "must be at most 2000 characters long"
+	}
+	return ""
+}
+
+func checkSlug(slug string) string {
+	if n := len(slug); n < MinSlugLength || n > MaxSlugLength {
+		return "must be from 3 to 50 characters long"
+	}
+	if !slugRe.MatchString(slug) {
+		return "must only contain lowercase latin letters, digits and single hyphens between them"
+	}
+	return ""
+}
+
+func checkHubTitle(title string) string {
+	if msg := checkNotEmpty(title); msg != "" {
+		return msg
+	}
+	if utf8.RuneCountInString(title) > MaxHubTitleLength {
+		return "must be at most 100 characters long"
+	}
+	return ""
+}
+
+func checkSearch(query string) string {
+	if msg := checkNotEmpty(query); msg != "" {
+		return msg
+	}
+	if utf8.RuneCountInString(query) > MaxSearchLength {
+		return "must be at most 256 characters long"
+	}
+	return ""
+}
+
+func checkNotEmpty(value string) string {
+	if strings.TrimSpace(value) == "" {
+		return "must not be empty"
+	}
+	return ""
+}
+
+func (e *Errors) add(field, message string) {
+	if message != "" {
+		*e = append(*e, &FieldError{Field: field, Message: message})
+	}
+}
@@ -0,0 +1,113 @@
+package validation_test
+
+import (
+	"github.com/rmntim/ozon-task/internal/lib/validation"
+	"strings"
+	"testing"
+)
+
+func TestUser(t *testing.T) {
+	if errs := validation.User("user_42", "user@example.com", "password"); errs != nil {
+		t.Error("valid user should pass:", errs)
+	}
+
+	for _, username := range []string{"ab", strings.Repeat("a", 51), "user name", "юзер"} {
+		errs := validation.User(username, "user@example.com", "password")
+		if len(errs) != 1 || errs[0].Field != "username" {
+			t.Errorf("username %q should be rejected", username)
+		}
+	}
+
+	for _, email := range []string{"user", "User <user@example.com>", strings.Repeat("a", 100) + "@example.com"} {
+		errs := validation.User("user", email, "password")
+		if len(errs) != 1 || errs[0].Field != "email" {
+			t.Errorf("email %q should be rejected", email)
+		}
+	}
+
+	errs := validation.User("", "", strings.Repeat("a", 73))
+	if len(errs) != 3 {
+		t.Error("every invalid field should be reported")
+	}
+}
+
+func TestPost(t *testing.T) {
+	if errs := validation.Post("title", "content"); errs != nil {
+		t.Error("valid post should pass:", errs)
+	}
+
+	errs := validation.Post(" ", "")
+	if len(errs) != 2 || errs[0].Field != "title" || errs[1].Field != "content" {
+		t.Error("blank title and content should be rejected")
+	}
+
+	if errs := validation.Post(strings.Repeat("a", 256), "content"); len(errs) != 1 {
+		t.Error("long title should be rejected")
+	}
+}
+
+func TestComment(t *testing.T) {
+	// Length is in characters, not bytes.
+	if errs := validation.Comment(strings.Repeat("я", 2000)); errs != nil {
+		t.Error("comment of 2000 characters should pass")
+	}
+
+	if errs := validation.Comment(strings.Repeat("a", 2001)); len(errs) != 1 {
+		t.Error("comment over 2000 characters should be rejected")
+	}
+
+	if errs := validation.Comment("\n\t"); len(errs) != 1 {
+		t.Error("blank comment should be rejected")
+	}
+}
+
+func TestVote(t *testing.T) {
+	for _, value := range []int{-1, 0, 1} {
+		if errs := validation.Vote(value); errs != nil {
+			t.Error("vote of", value, "should pass")
+		}
+	}
+
+	if errs := validation.Vote(2); len(errs) != 1 || errs[0].Field != "value" {
+		t.Error("vote of 2 should be rejected")
+	}
+}
+
+func TestSearch(t *testing.T) {
+	if errs := validation.Search("кошки and dogs"); errs != nil {
+		t.Error("query should pass")
+	}
+
+	for _, query := range []string{" ", strings.Repeat("a", validation.MaxSearchLength+1)} {
+		if errs := validation.Search(query); len(errs) != 1 || errs[0].Field != "query" {
+			t.Errorf("query %.10q should be rejected", query)
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	if errs := validation.Hub("go-lang2", "Go", ""); errs != nil {
+		t.Error("valid hub should pass:", errs)
+	}
+
+	for _, slug := range []string{"go", strings.Repeat("a", 51), "Go-lang", "go--lang", "-go", "го-ланг"} {
+		if errs := validation.Hub(slug, "Go", ""); len(errs) != 1 || errs[0].Field != "slug" {
+			t.Errorf("slug %q should be rejected", slug)
+		}
+	}
+
+	errs := validation.Hub("golang", " ", strings.Repeat("я", 1001))
+	if len(errs) != 2 || errs[0].Field != "title" || errs[1].Field != "description" {
+		t.Error("blank title and long description should be rejected")
+	}
+}
+
+func TestPostHubs(t *testing.T) {
+	if errs := validation.PostHubs([]uint{1, 2, 3, 4, 5}); errs != nil {
+		t.Error("5 hubs should pass")
+	}
+
+	if errs := validation.PostHubs([]uint{1, 2, 3, 4, 5, 6}); len(errs) != 1 || errs[0].Field != "hubIds" {
+		t.Error("6 hubs should be rejected")
+	}
+}
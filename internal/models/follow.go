@@ -0,0 +1,8 @@
+package models
+
+// Follow is a user found by a batch lookup of follows of the user with
+// TargetID: either one of their followers or one of the users they follow.
+type Follow struct {
+	TargetID uint `db:"target_id"`
+	User
+}
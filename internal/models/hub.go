@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Hub is a community posts are published to. A post may belong to
+// several hubs.
+type Hub struct {
+	ID          uint      `json:"id"`
+	Slug        string    `json:"slug"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	// SubscribersCount is the number of users subscribed to the hub.
+	SubscribersCount int `json:"subscribersCount" db:"subscribers_count"`
+}
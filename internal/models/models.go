@@ -5,26 +5,44 @@ import (
 )
 
 type Comment struct {
-	ID              uint      `json:"id"`
-	Content         string    `json:"content"`
-	AuthorID        uint      `json:"-" db:"author_id"`
-	CreatedAt       time.Time `json:"createdAt" db:"created_at"`
-	PostID          uint      `json:"-" db:"post_id"`
-	ParentCommentID *uint     `json:"-" db:"parent_comment_id"`
-	RepliesIDs      IDArray   `json:"-" db:"replies_ids"`
+	ID              uint       `json:"id"`
+	Content         string     `json:"content"`
+	AuthorID        uint       `json:"-" db:"author_id"`
+	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
+	PostID          uint       `json:"-" db:"post_id"`
+	ParentCommentID *uint      `json:"-" db:"parent_comment_id"`
+	EditedAt        *time.Time `json:"editedAt" db:"edited_at"`
+	DeletedAt       *time.Time `json:"deletedAt" db:"deleted_at"`
+	RepliesIDs      IDArray    `json:"-" db:"replies_ids"`
+	Upvotes         int        `json:"upvotes"`
+	Downvotes       int        `json:"downvotes"`
+}
+
+// Score is the number of upvotes minus the number of downvotes.
+func (c *Comment) Score() int {
+	return c.Upvotes - c.Downvotes
 }
 
 type Mutation struct {
 }
 
 type Post struct {
-	ID                uint      `json:"id"`
-	Title             string    `json:"title"`
-	CreatedAt         time.Time `json:"createdAt" db:"created_at"`
-	Content           string    `json:"content"`
-	CommentsAvailable bool      `json:"commentsAvailable" db:"comments_available"`
-	AuthorID          uint      `json:"-" db:"author_id"`
-	CommentsIDs       IDArray   `json:"-" db:"comments_ids"`
+	ID                uint       `json:"id"`
+	Title             string     `json:"title"`
+	CreatedAt         time.Time  `json:"createdAt" db:"created_at"`
+	Content           string     `json:"content"`
+	CommentsAvailable bool       `json:"commentsAvailable" db:"comments_available"`
+	AuthorID          uint       `json:"-" db:"author_id"`
+	EditedAt          *time.Time `json:"editedAt" db:"edited_at"`
+	DeletedAt         *time.Time `json:"deletedAt" db:"deleted_at"`
+	CommentsIDs       IDArray    `json:"-" db:"comments_ids"`
+	Upvotes           int        `json:"upvotes"`
+	Downvotes         int        `json:"downvotes"`
+}
+
+// Score is the number of upvotes minus the number of downvotes.
+func (p *Post) Score() int {
+	return p.Upvotes - p.Downvotes
 }
 
 type Query struct {
@@ -34,8 +52,38 @@ type Subscription struct {
 }
 
 type User struct {
-	ID       uint    `json:"id"`
-	Username string  `json:"username"`
-	Email    string  `json:"email"`
-	PostsIDs IDArray `json:"-" db:"posts_ids"`
+	ID             uint    `json:"id"`
+	Username       string  `json:"username"`
+	Email          string  `json:"email"`
+	Role           Role    `json:"role"`
+	FollowersCount int     `json:"followersCount" db:"followers_count"`
+	PasswordHash   []byte  `json:"-" db:"password_hash"`
+	PostsIDs       IDArray `json:"-" db:"posts_ids"`
+}
+
+// IsAdmin reports whether the user may act on behalf of other users.
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// IsModerator reports whether the user may delete content of other users.
+// Admins are moderators too.
+func (u *User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+type RefreshToken struct {
+	// Hash is SHA-256 of the token, the token itself is never stored.
+	Hash      string    `db:"token_hash"`
+	UserID    uint      `db:"user_id"`
+	Family    string    `db:"family"`
+	ExpiresAt time.Time `db:"expires_at"`
 }
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// Order is an order posts and comments are listed in.
+type Order int
+
+const (
+	// OrderOld lists oldest items first. It's the zero value, as lists
+	// are ordered by ID unless asked otherwise.
+	OrderOld Order = iota
+	// OrderNew lists newest items first.
+	OrderNew
+	// OrderTop lists items with the highest score first.
+	OrderTop
+	// OrderHot lists items by score decayed with age, so that new items
+	// with a few votes outrank old popular ones.
+	OrderHot
+	// OrderControversial lists items with many votes split evenly
+	// between upvotes and downvotes first.
+	OrderControversial
+	// OrderBest lists items by the lower bound of the Wilson score
+	// interval of their upvote ratio, so that a few lucky votes don't
+	// outrank many mostly positive ones.
+	OrderBest
+)
+
+// RankedOrders are the orders items are listed in by Rank.
+var RankedOrders = []Order{OrderTop, OrderHot, OrderControversial, OrderBest}
+
+// Ranked reports whether the order is by Rank, highest first, with
+// newest items first among equal ranks. Other orders are by ID only.
+func (o Order) Ranked() bool {
+	return o >= OrderTop
+}
+
+const (
+	// hotEpoch and hotDecay make a hot rank grow by one every 12.5 hours,
+	// so an item needs ten times the score to outrank one that much newer.
+	hotEpoch = 1134028003
+	hotDecay = 45000
+	// wilsonZ is the quantile of the 95% confidence level.
+	wilsonZ = 1.96
+)
+
+// Rank returns the rank of an item in a ranked order. It must match the
+// ranks Postgres stores, see migrations, so that storages agree on orders.
+func Rank(order Order, upvotes, downvotes int, createdAt time.Time) float64 {
+	switch order {
+	case OrderTop:
+		return float64(upvotes - downvotes)
+	case OrderHot:
+		score := float64(upvotes - downvotes)
+		age := float64(createdAt.UnixMicro())/1e6 - hotEpoch
+		return sign(score)*math.Log10(max(math.Abs(score), 1)) + age/hotDecay
+	case OrderControversial:
+		if upvotes <= 0 || downvotes <= 0 {
+			return 0
+		}
+		balance := float64(min(upvotes, downvotes)) / float64(max(upvotes, downvotes))
+		return math.Pow(float64(upvotes+downvotes), balance)
+	case OrderBest:
+		n := float64(upvotes + downvotes)
+		if n == 0 {
+			return 0
+		}
+		p := float64(upvotes) / n
+		z2 := wilsonZ * wilsonZ
+		return (p + z2/(2*n) - wilsonZ*math.Sqrt((p*(1-p)+z2/(4*n))/n)) / (1 + z2/n)
+	}
+	return 0
+}
+
+func sign(x float64) float64 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,40 @@
+package models
+
+// Cursor is an optional item ID bounding a Page.
+type Cursor struct {
+	ID    uint
+	Valid bool
+}
+
+// Page selects a window of items in Order, used for keyset pagination.
+// It only holds plain values, so it can be used as a map key.
+type Page struct {
+	// Limit is the maximum number of items to return.
+	Limit int
+	// After and Before exclusively bound the window. In ranked orders
+	// a cursor stands for the rank the item has now, so a window moves
+	// along with items being voted on.
+	After  Cursor
+	Before Cursor
+	// FromEnd selects the items closest to Before instead of
+	// those closest to After. Items are in Order either way.
+	FromEnd bool
+	// Order is the order of items, by ID unless it's ranked.
+	Order Order
+}
+
+// Contains reports whether id falls inside the window bounds. Ranked
+// orders need ranks to tell, so it only makes sense for orders by ID.
+func (p Page) Contains(id uint) bool {
+	after, before := p.After, p.Before
+	if p.Order == OrderNew {
+		after, before = before, after
+	}
+	if after.Valid && id <= after.ID {
+		return false
+	}
+	if before.Valid && id >= before.ID {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// PostRevision is a prior version of a post, replaced by an edit.
+// CreatedAt is when this version was written.
+type PostRevision struct {
+	ID        uint      `json:"id"`
+	PostID    uint      `json:"-" db:"post_id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
+
+// CommentRevision is a prior version of a comment, replaced by an edit.
+// CreatedAt is when this version was written.
+type CommentRevision struct {
+	ID        uint      `json:"id"`
+	CommentID uint      `json:"-" db:"comment_id"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"slices"
+)
+
+// SearchType is a kind of items search looks through.
+type SearchType string
+
+const (
+	SearchPost    SearchType = "post"
+	SearchComment SearchType = "comment"
+	SearchUser    SearchType = "user"
+)
+
+// SearchQuery selects a page of items matching a full-text query, best
+// matches first. Relevance is no key to paginate by, so pages are offsets.
+type SearchQuery struct {
+	// Text is a query of words every match must contain.
+	Text string
+	// Types are the kinds of items to look through, all if empty.
+	Types  []SearchType
+	Limit  int
+	Offset int
+}
+
+// SearchHit is an item matching a SearchQuery.
+type SearchHit struct {
+	Type SearchType `db:"type"`
+	ID   uint       `db:"id"`
+	// Rank is the relevance of the item, higher is better. Ranks are
+	// only comparable within a storage.
+	Rank float64 `db:"rank"`
+	// Snippet is HTML-escaped text around matched words, which are
+	// wrapped in <b> tags.
+	Snippet string `db:"snippet"`
+}
+
+// Includes reports whether q looks through items of type t.
+func (q SearchQuery) Includes(t SearchType) bool {
+	return len(q.Types) == 0 || slices.Contains(q.Types, t)
+}
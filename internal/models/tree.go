@@ -0,0 +1,35 @@
+package models
+
+// TreeQuery selects a part of a comment thread.
+type TreeQuery struct {
+	PostID uint
+	// RootID is the comment whose replies form the first level.
+	// If nil, top-level comments of the post do.
+	RootID *uint
+	// After skips first-level comments up to and including it.
+	After Cursor
+	// MaxDepth is the number of levels to load, at least one.
+	MaxDepth int
+	// Limit is the maximum number of replies loaded for every
+	// comment, and the maximum number of first-level comments.
+	Limit int
+}
+
+// CommentTreeNode is a comment positioned in its thread.
+type CommentTreeNode struct {
+	Comment
+	// Depth is the number of ancestors of the comment.
+	Depth int `db:"depth"`
+	// ChildCount is the number of direct replies, including
+	// ones that weren't loaded.
+	ChildCount int `db:"child_count"`
+}
+
+// CommentTree is a part of a comment thread flattened in pre-order,
+// so every comment directly precedes its replies.
+type CommentTree struct {
+	Nodes []*CommentTreeNode
+	// Remaining is the number of first-level comments after
+	// the cursor, including ones cut by the limit.
+	Remaining int
+}
@@ -0,0 +1,9 @@
+package models
+
+// Vote is a vote of a user on a post or a comment with TargetID. Value
+// is 1 for an upvote and -1 for a downvote.
+type Vote struct {
+	TargetID uint `db:"target_id"`
+	UserID   uint `db:"user_id"`
+	Value    int  `db:"value"`
+}
@@ -3,10 +3,22 @@ package server
 import "errors"
 
 var (
-	ErrInternal         = errors.New("internal server error")
-	ErrUserNotFound     = errors.New("no such user")
-	ErrPostNotFound     = errors.New("no such post")
-	ErrCommentNotFound  = errors.New("no such comment")
-	ErrCommentsDisabled = errors.New("comments are disabled on this post")
-	ErrUnauthorized     = errors.New("unauthorized")
+	ErrInternal              = errors.New("internal server error")
+	ErrUserNotFound          = errors.New("no such user")
+	ErrUsernameTaken         = errors.New("username is already taken")
+	ErrEmailTaken            = errors.New("email is already taken")
+	ErrPostNotFound          = errors.New("no such post")
+	ErrCommentNotFound       = errors.New("no such comment")
+	ErrCommentsDisabled      = errors.New("comments are disabled on this post")
+	ErrParentCommentMismatch = errors.New("parent comment belongs to another post")
+	ErrHubNotFound           = errors.New("no such hub")
+	ErrHubSlugTaken          = errors.New("hub slug is already taken")
+	ErrSelfFollow            = errors.New("users can't follow themselves")
+	ErrUnauthenticated       = errors.New("authentication required")
+	ErrUnauthorized          = errors.New("unauthorized")
+	ErrBadCredentials        = errors.New("invalid username or password")
+	ErrInvalidToken          = errors.New("invalid or expired token")
+	ErrTokenReused           = errors.New("refresh token was already used")
+	ErrInvalidCursor         = errors.New("invalid cursor")
+	ErrInvalidPage           = errors.New("invalid pagination arguments")
 )
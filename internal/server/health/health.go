@@ -0,0 +1,120 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// pingTimeout bounds a readiness check, so that probes of an
+// unresponsive database don't pile up.
+const pingTimeout = 2 * time.Second
+
+// Pinger is a storage that can check its connection.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Migrator is a storage with schema migrations.
+type Migrator interface {
+	// MigrationVersion returns the applied version and whether the last
+	// migration failed halfway.
+	MigrationVersion(ctx context.Context) (uint, bool, error)
+}
+
+// Component is the status of a single dependency.
+type Component struct {
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Version *uint  `json:"version,omitempty"`
+}
+
+// Report is the body of a probe response.
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components,omitempty"`
+}
+
+// Checks serves liveness and readiness probes.
+type Checks struct {
+	db           Pinger
+	shuttingDown atomic.Bool
+}
+
+func New(db Pinger) *Checks {
+	return &Checks{db: db}
+}
+
+// Shutdown makes the server report it's not ready, so that no new
+// traffic is routed to it while it drains.
+func (c *Checks) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Live reports that the process is up and serving requests.
+func (c *Checks) Live(w http.ResponseWriter, r *http.Request) {
+	writeReport(w, Report{Status: StatusOK})
+}
+
+// Ready reports whether the server can handle requests, with the status
+// of every component it depends on.
+func (c *Checks) Ready(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), pingTimeout)
+	defer cancel()
+
+	report := Report{
+		Status:     StatusOK,
+		Components: make(map[string]Component),
+	}
+	set := func(name string, component Component) {
+		if component.Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+		report.Components[name] = component
+	}
+
+	if c.shuttingDown.Load() {
+		set("server", Component{Status: StatusUnavailable, Error: "shutting down"})
+	} else {
+		set("server", Component{Status: StatusOK})
+	}
+
+	if err := c.db.Ping(ctx); err != nil {
+		set("storage", Component{Status: StatusUnavailable, Error: err.Error()})
+	} else {
+		set("storage", Component{Status: StatusOK})
+	}
+
+	if migrator, ok := c.db.(Migrator); ok {
+		set("migrations", migrations(ctx, migrator))
+	}
+
+	writeReport(w, report)
+}
+
+func migrations(ctx context.Context, migrator Migrator) Component {
+	version, dirty, err := migrator.MigrationVersion(ctx)
+	if err != nil {
+		return Component{Status: StatusUnavailable, Error: err.Error()}
+	}
+	if dirty {
+		return Component{Status: StatusUnavailable, Error: "last migration failed", Version: &version}
+	}
+	return Component{Status: StatusOK, Version: &version}
+}
+
+func writeReport(w http.ResponseWriter, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,110 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/server/health"
+	"github.com/rmntim/ozon-task/internal/storage/inmemory"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeStorage struct {
+	pingErr error
+	version uint
+	dirty   bool
+}
+
+func (s *fakeStorage) Ping(ctx context.Context) error {
+	return s.pingErr
+}
+
+func (s *fakeStorage) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	return s.version, s.dirty, nil
+}
+
+func probe(t *testing.T, handler http.HandlerFunc) (int, health.Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	var report health.Report
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatal("report should be JSON:", err)
+	}
+	return rec.Code, report
+}
+
+func TestChecks_Live(t *testing.T) {
+	checks := health.New(&fakeStorage{pingErr: errors.New("down")})
+
+	if code, report := probe(t, checks.Live); code != http.StatusOK || report.Status != health.StatusOK {
+		t.Error("server should be live regardless of dependencies")
+	}
+}
+
+func TestChecks_Ready(t *testing.T) {
+	checks := health.New(&fakeStorage{version: 8})
+
+	code, report := probe(t, checks.Ready)
+	if code != http.StatusOK || report.Status != health.StatusOK {
+		t.Fatal("server should be ready, got:", report)
+	}
+	if report.Components["storage"].Status != health.StatusOK {
+		t.Error("storage should be reported")
+	}
+	if migrations := report.Components["migrations"]; migrations.Version == nil || *migrations.Version != 8 {
+		t.Error("migration version should be reported")
+	}
+}
+
+func TestChecks_ReadyInMemory(t *testing.T) {
+	checks := health.New(inmemory.New())
+
+	code, report := probe(t, checks.Ready)
+	if code != http.StatusOK {
+		t.Error("server should be ready, got:", report)
+	}
+	if _, ok := report.Components["migrations"]; ok {
+		t.Error("storage without migrations should not report them")
+	}
+}
+
+func TestChecks_NotReady(t *testing.T) {
+	tests := []struct {
+		name      string
+		storage   *fakeStorage
+		component string
+	}{
+		{"storage down", &fakeStorage{pingErr: errors.New("connection refused")}, "storage"},
+		{"dirty migration", &fakeStorage{version: 8, dirty: true}, "migrations"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, report := probe(t, health.New(tt.storage).Ready)
+			if code != http.StatusServiceUnavailable || report.Status != health.StatusUnavailable {
+				t.Error("server should not be ready")
+			}
+			if c := report.Components[tt.component]; c.Status != health.StatusUnavailable || c.Error == "" {
+				t.Error("failing component should be reported with the error, got:", c)
+			}
+		})
+	}
+}
+
+func TestChecks_Shutdown(t *testing.T) {
+	checks := health.New(&fakeStorage{})
+	checks.Shutdown()
+
+	code, report := probe(t, checks.Ready)
+	if code != http.StatusServiceUnavailable || report.Components["server"].Status != health.StatusUnavailable {
+		t.Error("server should not be ready while shutting down")
+	}
+
+	if code, _ := probe(t, checks.Live); code != http.StatusOK {
+		t.Error("server should stay live while shutting down")
+	}
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"github.com/rmntim/ozon-task/internal/lib/logger/sl"
+	"github.com/rmntim/ozon-task/internal/server/middleware/requestid"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -18,6 +19,7 @@ func New(log *slog.Logger) func(http.Handler) http.Handler {
 				slog.String("path", r.URL.Path),
 				slog.String("remote_addr", r.RemoteAddr),
 				slog.String("user_agent", r.UserAgent()),
+				slog.String("request_id", requestid.FromContext(r.Context())),
 			)
 
 			ww := httptest.NewRecorder()
@@ -0,0 +1,62 @@
+package requestid
+
+import (
+	"context"
+	"github.com/rmntim/ozon-task/internal/lib/random"
+	"net/http"
+)
+
+// Header carries request ID both ways, so that a proxy in front of the
+// server can set it, and clients can report it along with errors.
+const Header = "X-Request-ID"
+
+const idLength = 16
+
+// maxLength bounds IDs taken from the request, since they end up in
+// the response and in every log line of the request.
+const maxLength = 64
+
+var ctxKey = &contextKey{"request_id"}
+
+type contextKey struct {
+	name string
+}
+
+// New tags every request with an ID, taken from the request header
+// if there's a valid one.
+func New() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(Header)
+			if !valid(id) {
+				id = random.NewRandomString(idLength)
+			}
+			w.Header().Set(Header, id)
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ctxKey, id)))
+		})
+	}
+}
+
+// valid reports whether id is non-empty, at most maxLength long and
+// made of `[A-Za-z0-9._-]` only.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range []byte(id) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// FromContext returns ID of the request, or an empty string if the
+// request didn't pass through the middleware.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey).(string)
+	return id
+}
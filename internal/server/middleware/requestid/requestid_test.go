@@ -0,0 +1,39 @@
+package requestid_test
+
+import (
+	"github.com/rmntim/ozon-task/internal/server/middleware/requestid"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var got string
+	handler := requestid.New()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = requestid.FromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got == "" || w.Header().Get(requestid.Header) != got {
+		t.Error("request should be tagged with a new ID")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(requestid.Header, "upstream")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if got != "upstream" {
+		t.Error("ID from the request should be kept")
+	}
+
+	for _, id := range []string{strings.Repeat("a", 65), "bad id", "line\nbreak", "<script>"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(requestid.Header, id)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if got == id || got == "" || w.Header().Get(requestid.Header) != got {
+			t.Errorf("invalid ID %q should be replaced with a new one", id)
+		}
+	}
+}
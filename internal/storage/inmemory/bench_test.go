@@ -0,0 +1,146 @@
+package inmemory_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/storage/inmemory"
+	"testing"
+)
+
+// Every post of a benchmark storage gets the same thread: threadRoots
+// top-level comments with threadReplies replies each. Only the number of
+// posts grows, so lookups should take the same time at every size.
+const (
+	threadRoots   = 10
+	threadReplies = 9
+	threadSize    = threadRoots * (1 + threadReplies)
+)
+
+type benchStorage struct {
+	*inmemory.Storage
+	user *models.User
+	// post is in the middle of the storage, root is its first comment.
+	post *models.Post
+	root *models.Comment
+}
+
+func newBenchStorage(b *testing.B, comments int) *benchStorage {
+	b.Helper()
+	ctx := context.Background()
+	s := &benchStorage{Storage: inmemory.New()}
+
+	user, err := s.CreateUser(ctx, "bench", "bench@example.com", "password")
+	if err != nil {
+		b.Fatal("user should be created:", err)
+	}
+	s.user = user
+
+	posts := comments / threadSize
+	for i := 0; i < posts; i++ {
+		post, err := s.CreatePost(ctx, "title", "content", user.ID, nil)
+		if err != nil {
+			b.Fatal("post should be created:", err)
+		}
+		for j := 0; j < threadRoots; j++ {
+			root, err := s.CreateComment(ctx, "root", user.ID, post.ID, nil)
+			if err != nil {
+				b.Fatal("comment should be created:", err)
+			}
+			for k := 0; k < threadReplies; k++ {
+				if _, err := s.CreateComment(ctx, "reply", user.ID, post.ID, &root.ID); err != nil {
+					b.Fatal("reply should be created:", err)
+				}
+			}
+			if i == posts/2 && j == 0 {
+				s.post, s.root = post, root
+			}
+		}
+	}
+
+	return s
+}
+
+func BenchmarkStorage(b *testing.B) {
+	ctx := context.Background()
+
+	for _, size := range []int{1_000, 10_000, 100_000, 1_000_000} {
+		s := newBenchStorage(b, size)
+		page := models.Page{Limit: 10, After: models.Cursor{ID: s.root.ID, Valid: true}}
+
+		b.Run(fmt.Sprintf("GetCommentById/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetCommentById(ctx, s.root.ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("GetComments/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetComments(ctx, page); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("GetCommentsForPost/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetCommentsForPost(ctx, s.post.ID, page, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("GetReplies/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetReplies(ctx, s.root.ID, models.Page{Limit: 10}, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("GetPostsFromUser/%d", size), func(b *testing.B) {
+			postPage := models.Page{Limit: 10, After: models.Cursor{ID: s.post.ID, Valid: true}}
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetPostsFromUser(ctx, s.user.ID, postPage); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("GetCommentTree/%d", size), func(b *testing.B) {
+			query := models.TreeQuery{PostID: s.post.ID, MaxDepth: 2, Limit: 10}
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetCommentTree(ctx, query); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("GetPostsHot/%d", size), func(b *testing.B) {
+			hotPage := models.Page{Limit: 10, After: models.Cursor{ID: s.post.ID, Valid: true}, Order: models.OrderHot}
+			for i := 0; i < b.N; i++ {
+				if _, err := s.GetPosts(ctx, hotPage); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("VoteComment/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.VoteComment(ctx, s.root.ID, s.user.ID, 1-2*(i%2)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("CreateComment/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := s.CreateComment(ctx, "reply", s.user.ID, s.post.ID, &s.root.ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
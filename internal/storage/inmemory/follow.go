@@ -0,0 +1,155 @@
+package inmemory
+
+import (
+	"context"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"slices"
+)
+
+// FollowUser makes the follower follow the user, unless they already do.
+func (s *Storage) FollowUser(ctx context.Context, userId uint, followerId uint) (*models.User, error) {
+	return s.setFollowing(userId, followerId, true)
+}
+
+// UnfollowUser makes the follower stop following the user, if they do.
+func (s *Storage) UnfollowUser(ctx context.Context, userId uint, followerId uint) (*models.User, error) {
+	return s.setFollowing(userId, followerId, false)
+}
+
+func (s *Storage) setFollowing(userId uint, followerId uint, following bool) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[uint64(userId)]
+	if !ok {
+		return nil, server.ErrUserNotFound
+	}
+	if _, ok := s.users[uint64(followerId)]; following && !ok {
+		return nil, server.ErrUserNotFound
+	}
+	if following && userId == followerId {
+		return nil, server.ErrSelfFollow
+	}
+
+	sub := &subscriptionRecord{Kind: subscriptionUser, TargetID: user.id, UserID: uint64(followerId), Subscribed: following}
+	if _, current := s.followers[user.id][sub.UserID]; current != following {
+		if err := s.write(record{Subscription: sub}); err != nil {
+			return nil, err
+		}
+		s.putSubscription(sub)
+	}
+
+	return s.userModel(user), nil
+}
+
+// GetFollowers returns a page of users following the user, by ID.
+func (s *Storage) GetFollowers(ctx context.Context, userId uint, page models.Page) ([]*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := paginate(sortedIds(s.followers[uint64(userId)]), page, nil)
+	return mapIds(ids, s.users, s.userModel), nil
+}
+
+// GetFollowing returns a page of users the user follows, by ID.
+func (s *Storage) GetFollowing(ctx context.Context, userId uint, page models.Page) ([]*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := paginate(sortedIds(s.following[uint64(userId)]), page, nil)
+	return mapIds(ids, s.users, s.userModel), nil
+}
+
+// GetFollowersByUserIds returns a page of followers for every user in userIds.
+func (s *Storage) GetFollowersByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Follow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.follows(s.followers, userIds, page), nil
+}
+
+// GetFollowingByUserIds returns a page of followed users for every user in userIds.
+func (s *Storage) GetFollowingByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Follow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.follows(s.following, userIds, page), nil
+}
+
+// follows returns a page of users from the sets of index for every user
+// in userIds. s.mu must be held for reading.
+func (s *Storage) follows(index map[uint64]map[uint64]struct{}, userIds []uint, page models.Page) []*models.Follow {
+	userIds = slices.Clone(userIds)
+	slices.Sort(userIds)
+
+	follows := make([]*models.Follow, 0)
+	for _, userId := range slices.Compact(userIds) {
+		ids := paginate(sortedIds(index[uint64(userId)]), page, nil)
+		for _, user := range mapIds(ids, s.users, s.userModel) {
+			follows = append(follows, &models.Follow{TargetID: userId, User: *user})
+		}
+	}
+	return follows
+}
+
+// GetFeed returns a page of posts by the users the user follows and
+// published to the hubs they are subscribed to, skipping deleted ones.
+// Ranked orders aren't supported, posts are ordered by ID.
+func (s *Storage) GetFeed(ctx context.Context, userId uint, page models.Page) ([]*models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// A post of the feed page is on the page of its author or of one of
+	// its hubs too, so only those pages are merged.
+	keep := func(id uint64) bool {
+		return s.posts[id].deletedAt == nil
+	}
+	ids := make([]uint64, 0)
+	for author := range s.following[uint64(userId)] {
+		ids = append(ids, paginate(s.postsByAuthor[author], page, keep)...)
+	}
+	for hub := range s.subscribedHubs[uint64(userId)] {
+		ids = append(ids, paginate(s.postsByHub[hub], page, keep)...)
+	}
+	slices.Sort(ids)
+
+	return mapIds(paginate(slices.Compact(ids), page, nil), s.posts, s.postModel), nil
+}
+
+// putSubscription subscribes or unsubscribes the user.
+// s.mu must be held for writing.
+func (s *Storage) putSubscription(sub *subscriptionRecord) {
+	switch sub.Kind {
+	case subscriptionHub:
+		setMember(s.hubSubscribers, sub.TargetID, sub.UserID, sub.Subscribed)
+		setMember(s.subscribedHubs, sub.UserID, sub.TargetID, sub.Subscribed)
+	case subscriptionUser:
+		setMember(s.followers, sub.TargetID, sub.UserID, sub.Subscribed)
+		setMember(s.following, sub.UserID, sub.TargetID, sub.Subscribed)
+	}
+}
+
+// setMember adds member to the set of key in index, or removes it.
+func setMember(index map[uint64]map[uint64]struct{}, key, member uint64, present bool) {
+	set, ok := index[key]
+	if !ok {
+		set = make(map[uint64]struct{})
+		index[key] = set
+	}
+	if present {
+		set[member] = struct{}{}
+	} else {
+		delete(set, member)
+	}
+}
+
+// sortedIds returns members of set in ascending order.
+func sortedIds(set map[uint64]struct{}) []uint64 {
+	ids := make([]uint64, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,151 @@
+package inmemory
+
+import (
+	"context"
+	"github.com/rmntim/ozon-task/internal/lib/validation"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"slices"
+	"time"
+)
+
+type Hub struct {
+	id          uint64
+	slug        string
+	title       string
+	description string
+	createdAt   time.Time
+}
+
+// CreateHub creates a hub with a unique slug.
+func (s *Storage) CreateHub(ctx context.Context, slug string, title string, description string) (*models.Hub, error) {
+	// Postgres limits lengths with column types, and so must we.
+	if errs := validation.Hub(slug, title, description); errs != nil {
+		return nil, errs
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.bySlug[slug]; ok {
+		return nil, server.ErrHubSlugTaken
+	}
+
+	hub := &Hub{
+		id:          s.hubsSeq,
+		slug:        slug,
+		title:       title,
+		description: description,
+		createdAt:   time.Now(),
+	}
+
+	if err := s.write(record{Hub: hub.record()}); err != nil {
+		return nil, err
+	}
+	s.putHub(hub)
+
+	return s.hubModel(hub), nil
+}
+
+func (s *Storage) GetHubById(ctx context.Context, id uint) (*models.Hub, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hub, ok := s.hubs[uint64(id)]
+	if !ok {
+		return nil, server.ErrHubNotFound
+	}
+
+	return s.hubModel(hub), nil
+}
+
+func (s *Storage) GetHubBySlug(ctx context.Context, slug string) (*models.Hub, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.bySlug[slug]
+	if !ok {
+		return nil, server.ErrHubNotFound
+	}
+
+	return s.hubModel(s.hubs[id]), nil
+}
+
+// SubscribeHub subscribes the user to the hub, unless they already are.
+func (s *Storage) SubscribeHub(ctx context.Context, hubId uint, userId uint) (*models.Hub, error) {
+	return s.setHubSubscription(hubId, userId, true)
+}
+
+// UnsubscribeHub unsubscribes the user from the hub, if they are subscribed.
+func (s *Storage) UnsubscribeHub(ctx context.Context, hubId uint, userId uint) (*models.Hub, error) {
+	return s.setHubSubscription(hubId, userId, false)
+}
+
+func (s *Storage) setHubSubscription(hubId uint, userId uint, subscribed bool) (*models.Hub, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hub, ok := s.hubs[uint64(hubId)]
+	if !ok {
+		return nil, server.ErrHubNotFound
+	}
+	if _, ok := s.users[uint64(userId)]; subscribed && !ok {
+		return nil, server.ErrUserNotFound
+	}
+
+	sub := &subscriptionRecord{Kind: subscriptionHub, TargetID: hub.id, UserID: uint64(userId), Subscribed: subscribed}
+	if _, current := s.hubSubscribers[hub.id][sub.UserID]; current != subscribed {
+		if err := s.write(record{Subscription: sub}); err != nil {
+			return nil, err
+		}
+		s.putSubscription(sub)
+	}
+
+	return s.hubModel(hub), nil
+}
+
+// GetPostsFromHub returns a page of posts published to the hub.
+func (s *Storage) GetPostsFromHub(ctx context.Context, hubId uint, page models.Page) ([]*models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := s.orderedPage(votePost, s.postsByHub[uint64(hubId)], s.ranks.hubs, uint64(hubId), page, nil)
+	return mapIds(ids, s.posts, s.postModel), nil
+}
+
+// hubsOf returns distinct IDs of hubs in ascending order, or
+// server.ErrHubNotFound if some of them don't exist. s.mu must be held.
+func (s *Storage) hubsOf(hubIds []uint) ([]uint64, error) {
+	ids := make([]uint64, 0, len(hubIds))
+	for _, id := range hubIds {
+		if _, ok := s.hubs[uint64(id)]; !ok {
+			return nil, server.ErrHubNotFound
+		}
+		ids = append(ids, uint64(id))
+	}
+	slices.Sort(ids)
+	return slices.Compact(ids), nil
+}
+
+// putHub stores a new hub or replaces a stored one.
+// s.mu must be held for writing.
+func (s *Storage) putHub(hub *Hub) {
+	if _, ok := s.hubs[hub.id]; !ok {
+		s.hubIds = append(s.hubIds, hub.id)
+		s.hubsSeq = max(s.hubsSeq, hub.id+1)
+	}
+	s.hubs[hub.id] = hub
+	s.bySlug[hub.slug] = hub.id
+}
+
+// hubModel converts a stored hub to a model. s.mu must be held.
+func (s *Storage) hubModel(hub *Hub) *models.Hub {
+	return &models.Hub{
+		ID:               uint(hub.id),
+		Slug:             hub.slug,
+		Title:            hub.title,
+		Description:      hub.description,
+		CreatedAt:        hub.createdAt,
+		SubscribersCount: len(s.hubSubscribers[hub.id]),
+	}
+}
@@ -1,10 +1,14 @@
 package inmemory
 
 import (
+	"cmp"
 	"context"
+	"github.com/rmntim/ozon-task/internal/lib/password"
+	"github.com/rmntim/ozon-task/internal/lib/validation"
 	"github.com/rmntim/ozon-task/internal/models"
 	"github.com/rmntim/ozon-task/internal/server"
-	"sync/atomic"
+	"slices"
+	"sync"
 	"time"
 )
 
@@ -12,7 +16,10 @@ type User struct {
 	id           uint64
 	username     string
 	email        string
+	role         models.Role
 	passwordHash []byte
+	// sessionVersion is bumped to revoke all sessions of the user.
+	sessionVersion uint64
 }
 
 type Post struct {
@@ -22,6 +29,10 @@ type Post struct {
 	createdAt         time.Time
 	authorId          uint64
 	commentsAvailable bool
+	editedAt          *time.Time
+	deletedAt         *time.Time
+	// hubIds are the hubs the post is published to, in ascending order.
+	hubIds []uint64
 }
 
 type Comment struct {
@@ -31,99 +42,219 @@ type Comment struct {
 	createdAt       time.Time
 	postId          uint64
 	parentCommentId *uint
+	editedAt        *time.Time
+	deletedAt       *time.Time
+	// depth is the number of ancestors of the comment.
+	depth int
 }
 
+// votes are the votes on a single post or comment, with counters.
+type votes struct {
+	byUser    map[uint64]int
+	upvotes   int
+	downvotes int
+}
+
+// Storage keeps everything in maps guarded by a single lock. IDs are
+// handed out under the lock, so every ID list below is sorted both by
+// ID and by creation time, and pages are cut out of it with binary search.
+//
+// Stored objects are never modified in place: updates store a copy.
 type Storage struct {
-	users    Map[uint64, *User]
-	usersSeq atomic.Uint64
+	mu sync.RWMutex
+
+	users      map[uint64]*User
+	userIds    []uint64
+	byUsername map[string]uint64
+	byEmail    map[string]uint64
+	usersSeq   uint64
+
+	posts    map[uint64]*Post
+	postIds  []uint64
+	postsSeq uint64
+
+	comments    map[uint64]*Comment
+	commentIds  []uint64
+	commentsSeq uint64
+
+	hubs    map[uint64]*Hub
+	hubIds  []uint64
+	bySlug  map[string]uint64
+	hubsSeq uint64
+
+	postsByAuthor   map[uint64][]uint64
+	commentsByPost  map[uint64][]uint64
+	rootsByPost     map[uint64][]uint64
+	repliesByParent map[uint64][]uint64
+	postsByHub      map[uint64][]uint64
+
+	postRevisions       map[uint64][]*models.PostRevision
+	postRevisionsSeq    uint64
+	commentRevisions    map[uint64][]*models.CommentRevision
+	commentRevisionsSeq uint64
+
+	postVotes    map[uint64]*votes
+	commentVotes map[uint64]*votes
+
+	// hubSubscribers are the users subscribed to every hub, and
+	// subscribedHubs are the hubs every user is subscribed to.
+	hubSubscribers map[uint64]map[uint64]struct{}
+	subscribedHubs map[uint64]map[uint64]struct{}
+	// followers are the users following every user, and following
+	// are the users every user follows.
+	followers map[uint64]map[uint64]struct{}
+	following map[uint64]map[uint64]struct{}
+
+	search *searchIndex
+
+	// ranks is nil while Open loads the storage, and built at once
+	// afterwards, see buildRanks.
+	ranks *ranks
 
-	posts    Map[uint64, *Post]
-	postsSeq atomic.Uint64
+	refreshTokensMu sync.Mutex
+	refreshTokens   map[string]*RefreshToken
 
-	comments    Map[uint64, *Comment]
-	commentsSeq atomic.Uint64
+	// wal logs every change if the storage is persistent, see Open.
+	wal        *wal
+	opts       Options
+	snapshotMu sync.Mutex
+}
+
+type RefreshToken struct {
+	token models.RefreshToken
+	used  bool
 }
 
 func New() *Storage {
 	return &Storage{
-		users:    Map[uint64, *User]{},
-		posts:    Map[uint64, *Post]{},
-		comments: Map[uint64, *Comment]{},
+		users:      make(map[uint64]*User),
+		byUsername: make(map[string]uint64),
+		byEmail:    make(map[string]uint64),
+		posts:      make(map[uint64]*Post),
+		comments:   make(map[uint64]*Comment),
+		hubs:       make(map[uint64]*Hub),
+		bySlug:     make(map[string]uint64),
+
+		postsByAuthor:   make(map[uint64][]uint64),
+		commentsByPost:  make(map[uint64][]uint64),
+		rootsByPost:     make(map[uint64][]uint64),
+		repliesByParent: make(map[uint64][]uint64),
+		postsByHub:      make(map[uint64][]uint64),
+
+		postRevisions:    make(map[uint64][]*models.PostRevision),
+		commentRevisions: make(map[uint64][]*models.CommentRevision),
+
+		postVotes:    make(map[uint64]*votes),
+		commentVotes: make(map[uint64]*votes),
+
+		hubSubscribers: make(map[uint64]map[uint64]struct{}),
+		subscribedHubs: make(map[uint64]map[uint64]struct{}),
+		followers:      make(map[uint64]map[uint64]struct{}),
+		following:      make(map[uint64]map[uint64]struct{}),
+
+		search: newSearchIndex(),
+		ranks:  newRanks(),
+
+		refreshTokens: make(map[string]*RefreshToken),
 	}
 }
 
-func (s *Storage) CreateUser(ctx context.Context, username string, email string, password string) (*models.User, error) {
-	id := s.usersSeq.Load()
+func (s *Storage) CreateUser(ctx context.Context, username string, email string, pass string) (*models.User, error) {
+	passwordHash, err := password.Hash(pass)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byUsername[username]; ok {
+		return nil, server.ErrUsernameTaken
+	}
+	if _, ok := s.byEmail[email]; ok {
+		return nil, server.ErrEmailTaken
+	}
 
 	user := &User{
-		id:           id,
+		id:           s.usersSeq,
 		username:     username,
 		email:        email,
-		passwordHash: []byte(password + "_hashed"), // again, don't care about security here
+		role:         models.RoleUser,
+		passwordHash: passwordHash,
 	}
 
-	s.users.Store(id, user)
-	s.usersSeq.Add(1)
-
-	postsIds := make([]uint, 0)
-	s.posts.Range(func(id uint64, p *Post) bool {
-		if p.authorId == id {
-			postsIds = append(postsIds, uint(p.id))
-		}
-		return true
-	})
+	if err := s.write(record{User: user.record()}); err != nil {
+		return nil, err
+	}
+	s.putUser(user)
 
-	return &models.User{
-		ID:       uint(user.id),
-		Username: user.username,
-		Email:    user.email,
-		PostsIDs: postsIds,
-	}, nil
+	return s.userModel(user), nil
 }
 
-func (s *Storage) CreatePost(ctx context.Context, title string, content string, authorId uint) (*models.Post, error) {
-	id := s.postsSeq.Load()
+// CreatePost creates a post published to hubs in hubIds.
+func (s *Storage) CreatePost(ctx context.Context, title string, content string, authorId uint, hubIds []uint) (*models.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[uint64(authorId)]; !ok {
+		return nil, server.ErrUserNotFound
+	}
+	hubs, err := s.hubsOf(hubIds)
+	if err != nil {
+		return nil, err
+	}
 
 	post := &Post{
-		id:                id,
+		id:                s.postsSeq,
 		title:             title,
 		content:           content,
 		createdAt:         time.Now(),
 		authorId:          uint64(authorId),
 		commentsAvailable: true,
+		hubIds:            hubs,
 	}
 
-	_, err := s.GetUserById(ctx, authorId)
-	if err != nil {
+	if err := s.write(record{Post: post.record()}); err != nil {
 		return nil, err
 	}
+	s.putPost(post)
 
-	s.posts.Store(id, post)
-	s.postsSeq.Add(1)
-
-	commentsIds := make([]uint, 0)
-	s.comments.Range(func(id uint64, c *Comment) bool {
-		if c.postId == id {
-			commentsIds = append(commentsIds, uint(c.id))
-		}
-		return true
-	})
-
-	return &models.Post{
-		ID:          uint(post.id),
-		Title:       post.title,
-		CreatedAt:   post.createdAt,
-		Content:     post.content,
-		AuthorID:    uint(post.authorId),
-		CommentsIDs: commentsIds,
-	}, nil
+	return s.postModel(post), nil
 }
 
 func (s *Storage) CreateComment(ctx context.Context, content string, authorId uint, postId uint, parentCommentId *uint) (*models.Comment, error) {
-	id := s.commentsSeq.Load()
+	// Postgres limits comment length with the column type, and so must we.
+	if errs := validation.Comment(content); errs != nil {
+		return nil, errs
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[uint64(authorId)]; !ok {
+		return nil, server.ErrUserNotFound
+	}
+
+	post, ok := s.posts[uint64(postId)]
+	if !ok {
+		return nil, server.ErrPostNotFound
+	}
+	if !post.commentsAvailable {
+		return nil, server.ErrCommentsDisabled
+	}
+
+	if parentCommentId != nil {
+		parent, ok := s.comments[uint64(*parentCommentId)]
+		if !ok {
+			return nil, server.ErrCommentNotFound
+		}
+		if parent.postId != uint64(postId) {
+			return nil, server.ErrParentCommentMismatch
+		}
+	}
 
 	comment := &Comment{
-		id:              id,
+		id:              s.commentsSeq,
 		content:         content,
 		authorId:        uint64(authorId),
 		createdAt:       time.Now(),
@@ -131,299 +262,797 @@ func (s *Storage) CreateComment(ctx context.Context, content string, authorId ui
 		parentCommentId: parentCommentId,
 	}
 
-	_, err := s.GetUserById(ctx, authorId)
-	if err != nil {
+	if err := s.write(record{Comment: comment.record()}); err != nil {
 		return nil, err
 	}
+	s.putComment(comment)
 
-	_, err = s.GetPostById(ctx, postId)
-	if err != nil {
-		return nil, err
+	return s.commentModel(comment), nil
+}
+
+func (s *Storage) GetUserById(ctx context.Context, id uint) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[uint64(id)]
+	if !ok {
+		return nil, server.ErrUserNotFound
 	}
 
-	if parentCommentId != nil {
-		_, err := s.GetCommentById(ctx, *parentCommentId)
-		if err != nil {
-			return nil, err
-		}
+	return s.userModel(user), nil
+}
+
+// GetUserByUsername returns the user along with their password hash.
+func (s *Storage) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.byUsername[username]
+	if !ok {
+		return nil, server.ErrUserNotFound
 	}
 
-	s.comments.Store(id, comment)
-	s.commentsSeq.Add(1)
+	found := s.users[id]
+	user := s.userModel(found)
+	user.PasswordHash = found.passwordHash
 
-	commentsIds := make([]uint, 0)
-	s.comments.Range(func(id uint64, c *Comment) bool {
-		if c.postId == id {
-			commentsIds = append(commentsIds, uint(c.id))
-		}
-		return true
-	})
+	return user, nil
+}
 
-	return &models.Comment{
-		ID:              uint(comment.id),
-		Content:         comment.content,
-		AuthorID:        uint(comment.authorId),
-		CreatedAt:       comment.createdAt,
-		PostID:          uint(comment.postId),
-		ParentCommentID: parentCommentId,
-		RepliesIDs:      commentsIds,
-	}, nil
+func (s *Storage) SetUserRole(ctx context.Context, userId uint, role models.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[uint64(userId)]
+	if !ok {
+		return server.ErrUserNotFound
+	}
+
+	updated := *user
+	updated.role = role
+	if err := s.write(record{User: updated.record()}); err != nil {
+		return err
+	}
+	s.putUser(&updated)
+
+	return nil
 }
 
-func (s *Storage) GetUserById(ctx context.Context, id uint) (*models.User, error) {
-	user, ok := s.users.Load(uint64(id))
+func (s *Storage) GetUsers(ctx context.Context, page models.Page) ([]*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return mapIds(paginate(s.userIds, page, nil), s.users, s.userModel), nil
+}
+
+func (s *Storage) GetPostById(ctx context.Context, id uint) (*models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	post, ok := s.posts[uint64(id)]
 	if !ok {
-		return nil, server.ErrUserNotFound
+		return nil, server.ErrPostNotFound
 	}
 
-	postsIds := make([]uint, 0)
-	s.posts.Range(func(id uint64, p *Post) bool {
-		if p.authorId == id {
-			postsIds = append(postsIds, uint(p.id))
-		}
-		return true
-	})
+	return s.postModel(post), nil
+}
 
-	return &models.User{
-		ID:       uint(user.id),
-		Username: user.username,
-		Email:    user.email,
-		PostsIDs: postsIds,
-	}, nil
+func (s *Storage) GetPosts(ctx context.Context, page models.Page) ([]*models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := s.orderedPage(votePost, s.postIds, s.ranks.posts, 0, page, nil)
+	return mapIds(ids, s.posts, s.postModel), nil
 }
 
-func (s *Storage) GetUsers(ctx context.Context, limit int, offset int) ([]*models.User, error) {
-	users := make([]*models.User, limit)
+func (s *Storage) GetCommentById(ctx context.Context, id uint) (*models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	for i := 0; i < limit; i++ {
-		user, ok := s.users.Load(uint64(offset + i))
-		if !ok {
-			break
-		}
+	comment, ok := s.comments[uint64(id)]
+	if !ok {
+		return nil, server.ErrCommentNotFound
+	}
 
-		postsIds := make([]uint, 0)
-		s.posts.Range(func(id uint64, p *Post) bool {
-			if p.authorId == id {
-				postsIds = append(postsIds, uint(p.id))
-			}
-			return true
-		})
+	return s.commentModel(comment), nil
+}
 
-		users[i] = &models.User{
-			ID:       uint(user.id),
-			Username: user.username,
-			Email:    user.email,
-			PostsIDs: postsIds,
-		}
+func (s *Storage) GetComments(ctx context.Context, page models.Page) ([]*models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return mapIds(paginate(s.commentIds, page, nil), s.comments, s.commentModel), nil
+}
+
+func (s *Storage) ToggleComments(ctx context.Context, postId uint, userId uint) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[uint64(postId)]
+	if !ok || post.deletedAt != nil {
+		return false, server.ErrPostNotFound
+	}
+
+	if post.authorId != uint64(userId) {
+		return false, server.ErrUnauthorized
 	}
 
-	return users, nil
+	updated := *post
+	updated.commentsAvailable = !post.commentsAvailable
+	if err := s.write(record{Post: updated.record()}); err != nil {
+		return false, err
+	}
+	s.putPost(&updated)
+
+	return updated.commentsAvailable, nil
 }
 
-func (s *Storage) GetPostById(ctx context.Context, id uint) (*models.Post, error) {
-	post, ok := s.posts.Load(uint64(id))
+func (s *Storage) UpdatePost(ctx context.Context, id uint, userId uint, title string, content string) (*models.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[uint64(id)]
+	if !ok || post.deletedAt != nil {
+		return nil, server.ErrPostNotFound
+	}
+
+	if post.authorId != uint64(userId) {
+		return nil, server.ErrUnauthorized
+	}
+
+	revision := &models.PostRevision{
+		ID:        uint(s.postRevisionsSeq + 1),
+		PostID:    uint(post.id),
+		Title:     post.title,
+		Content:   post.content,
+		CreatedAt: versionTime(post.createdAt, post.editedAt),
+	}
+
+	now := time.Now()
+	updated := *post
+	updated.title = title
+	updated.content = content
+	updated.editedAt = &now
+
+	if err := s.write(record{Post: updated.record(), PostRevision: postRevisionRecord(revision)}); err != nil {
+		return nil, err
+	}
+	s.addPostRevision(revision)
+	s.putPost(&updated)
+
+	return s.postModel(&updated), nil
+}
+
+func (s *Storage) UpdateComment(ctx context.Context, id uint, userId uint, content string) (*models.Comment, error) {
+	if errs := validation.Comment(content); errs != nil {
+		return nil, errs
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[uint64(id)]
+	if !ok || comment.deletedAt != nil {
+		return nil, server.ErrCommentNotFound
+	}
+
+	if comment.authorId != uint64(userId) {
+		return nil, server.ErrUnauthorized
+	}
+
+	revision := &models.CommentRevision{
+		ID:        uint(s.commentRevisionsSeq + 1),
+		CommentID: uint(comment.id),
+		Content:   comment.content,
+		CreatedAt: versionTime(comment.createdAt, comment.editedAt),
+	}
+
+	now := time.Now()
+	updated := *comment
+	updated.content = content
+	updated.editedAt = &now
+
+	if err := s.write(record{Comment: updated.record(), CommentRevision: commentRevisionRecord(revision)}); err != nil {
+		return nil, err
+	}
+	s.addCommentRevision(revision)
+	s.putComment(&updated)
+
+	return s.commentModel(&updated), nil
+}
+
+// DeletePost marks the post as deleted and disables comments on it.
+func (s *Storage) DeletePost(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[uint64(id)]
+	if !ok {
+		return server.ErrPostNotFound
+	}
+	if post.deletedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	updated := *post
+	updated.deletedAt = &now
+	updated.commentsAvailable = false
+	if err := s.write(record{Post: updated.record()}); err != nil {
+		return err
+	}
+	s.putPost(&updated)
+
+	return nil
+}
+
+// DeleteComment marks the comment as deleted, keeping its replies in place.
+func (s *Storage) DeleteComment(ctx context.Context, id uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[uint64(id)]
 	if !ok {
+		return server.ErrCommentNotFound
+	}
+	if comment.deletedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	updated := *comment
+	updated.deletedAt = &now
+	if err := s.write(record{Comment: updated.record()}); err != nil {
+		return err
+	}
+	s.putComment(&updated)
+
+	return nil
+}
+
+// VotePost sets the vote of the user on the post, or retracts it if
+// value is 0. Deleted posts can't be voted on.
+func (s *Storage) VotePost(ctx context.Context, postId uint, userId uint, value int) (*models.Post, error) {
+	if errs := validation.Vote(value); errs != nil {
+		return nil, errs
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	post, ok := s.posts[uint64(postId)]
+	if !ok || post.deletedAt != nil {
 		return nil, server.ErrPostNotFound
 	}
+	if _, ok := s.users[uint64(userId)]; !ok {
+		return nil, server.ErrUserNotFound
+	}
 
-	commentsIds := make([]uint, 0)
-	s.comments.Range(func(id uint64, c *Comment) bool {
-		if c.postId == id {
-			commentsIds = append(commentsIds, uint(c.id))
+	vote := &voteRecord{Kind: votePost, TargetID: post.id, UserID: uint64(userId), Value: value}
+	if s.postVotes[post.id].of(vote.UserID) != value {
+		if err := s.write(record{Vote: vote}); err != nil {
+			return nil, err
 		}
-		return true
-	})
+		s.putVote(vote)
+	}
 
-	return &models.Post{
-		ID:          uint(post.id),
-		Title:       post.title,
-		CreatedAt:   post.createdAt,
-		Content:     post.content,
-		AuthorID:    uint(post.authorId),
-		CommentsIDs: commentsIds,
-	}, nil
+	return s.postModel(post), nil
 }
 
-func (s *Storage) GetPosts(ctx context.Context, limit int, offset int) ([]*models.Post, error) {
-	posts := make([]*models.Post, limit)
+// VoteComment sets the vote of the user on the comment, or retracts it
+// if value is 0. Deleted comments can't be voted on.
+func (s *Storage) VoteComment(ctx context.Context, commentId uint, userId uint, value int) (*models.Comment, error) {
+	if errs := validation.Vote(value); errs != nil {
+		return nil, errs
+	}
 
-	for i := 0; i < limit; i++ {
-		post, ok := s.posts.Load(uint64(offset + i))
-		if !ok {
-			break
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	comment, ok := s.comments[uint64(commentId)]
+	if !ok || comment.deletedAt != nil {
+		return nil, server.ErrCommentNotFound
+	}
+	if _, ok := s.users[uint64(userId)]; !ok {
+		return nil, server.ErrUserNotFound
+	}
+
+	vote := &voteRecord{Kind: voteComment, TargetID: comment.id, UserID: uint64(userId), Value: value}
+	if s.commentVotes[comment.id].of(vote.UserID) != value {
+		if err := s.write(record{Vote: vote}); err != nil {
+			return nil, err
 		}
+		s.putVote(vote)
+	}
 
-		commentsIds := make([]uint, 0)
-		s.comments.Range(func(id uint64, c *Comment) bool {
-			if c.postId == id {
-				commentsIds = append(commentsIds, uint(c.id))
-			}
-			return true
-		})
+	return s.commentModel(comment), nil
+}
+
+// GetPostVotes returns votes of the user on posts in postIds.
+func (s *Storage) GetPostVotes(ctx context.Context, userId uint, postIds []uint) ([]*models.Vote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return userVotes(s.postVotes, userId, postIds), nil
+}
+
+// GetCommentVotes returns votes of the user on comments in commentIds.
+func (s *Storage) GetCommentVotes(ctx context.Context, userId uint, commentIds []uint) ([]*models.Vote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return userVotes(s.commentVotes, userId, commentIds), nil
+}
 
-		posts[i] = &models.Post{
-			ID:          uint(post.id),
-			Title:       post.title,
-			CreatedAt:   post.createdAt,
-			Content:     post.content,
-			AuthorID:    uint(post.authorId),
-			CommentsIDs: commentsIds,
+func userVotes(index map[uint64]*votes, userId uint, targetIds []uint) []*models.Vote {
+	res := make([]*models.Vote, 0)
+	for _, id := range targetIds {
+		if value := index[uint64(id)].of(uint64(userId)); value != 0 {
+			res = append(res, &models.Vote{TargetID: id, UserID: userId, Value: value})
 		}
 	}
+	return res
+}
 
-	return posts, nil
+// Ping always succeeds, as there's nothing to connect to.
+func (s *Storage) Ping(ctx context.Context) error {
+	return nil
 }
 
-func (s *Storage) GetCommentById(ctx context.Context, id uint) (*models.Comment, error) {
-	comment, ok := s.comments.Load(uint64(id))
-	if !ok {
-		return nil, server.ErrCommentNotFound
+// versionTime returns when the current version of a post or comment was written.
+func versionTime(createdAt time.Time, editedAt *time.Time) time.Time {
+	if editedAt != nil {
+		return *editedAt
 	}
+	return createdAt
+}
 
-	commentsIds := make([]uint, 0)
-	s.comments.Range(func(id uint64, c *Comment) bool {
-		if c.postId == id {
-			commentsIds = append(commentsIds, uint(c.id))
-		}
-		return true
+func (s *Storage) GetPostsFromUser(ctx context.Context, userId uint, page models.Page) ([]*models.Post, error) {
+	return s.GetPostsByUserIds(ctx, []uint{userId}, page)
+}
+
+func (s *Storage) GetReplies(ctx context.Context, commentId uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	return s.GetRepliesByCommentIds(ctx, []uint{commentId}, page, includeDeleted)
+}
+
+func (s *Storage) GetCommentsForPost(ctx context.Context, postId uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	return s.GetCommentsByPostIds(ctx, []uint{postId}, page, includeDeleted)
+}
+
+func (s *Storage) GetUsersByIds(ctx context.Context, ids []uint) ([]*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return mapIds(ids, s.users, s.userModel), nil
+}
+
+func (s *Storage) GetPostsByIds(ctx context.Context, ids []uint) ([]*models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return mapIds(ids, s.posts, s.postModel), nil
+}
+
+func (s *Storage) GetCommentsByIds(ctx context.Context, ids []uint) ([]*models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return mapIds(ids, s.comments, s.commentModel), nil
+}
+
+// GetPostsByUserIds returns a page of posts for every user in userIds.
+func (s *Storage) GetPostsByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Post, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := paginateGroups(userIds, func(userId uint64) []uint64 {
+		return paginate(s.postsByAuthor[userId], page, nil)
 	})
+	return mapIds(ids, s.posts, s.postModel), nil
+}
 
-	return &models.Comment{
-		ID:              uint(comment.id),
-		Content:         comment.content,
-		AuthorID:        uint(comment.authorId),
-		CreatedAt:       comment.createdAt,
-		PostID:          uint(comment.postId),
-		ParentCommentID: comment.parentCommentId,
-		RepliesIDs:      commentsIds,
-	}, nil
+// GetCommentsByPostIds returns a page of comments for every post in postIds.
+// Deleted comments are skipped unless includeDeleted is set.
+func (s *Storage) GetCommentsByPostIds(ctx context.Context, postIds []uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keep := s.keepComment(includeDeleted)
+	ids := paginateGroups(postIds, func(postId uint64) []uint64 {
+		return s.orderedPage(voteComment, s.commentsByPost[postId], s.ranks.comments, postId, page, keep)
+	})
+	return mapIds(ids, s.comments, s.commentModel), nil
 }
 
-func (s *Storage) GetComments(ctx context.Context, limit int, offset int) ([]*models.Comment, error) {
-	comments := make([]*models.Comment, limit)
+// GetRepliesByCommentIds returns a page of replies for every comment in commentIds.
+// Deleted replies are skipped unless includeDeleted is set.
+func (s *Storage) GetRepliesByCommentIds(ctx context.Context, commentIds []uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	for i := 0; i < limit; i++ {
-		comment, ok := s.comments.Load(uint64(offset + i))
-		if !ok {
-			break
-		}
+	keep := s.keepComment(includeDeleted)
+	ids := paginateGroups(commentIds, func(commentId uint64) []uint64 {
+		return s.orderedPage(voteComment, s.repliesByParent[commentId], s.ranks.replies, commentId, page, keep)
+	})
+	return mapIds(ids, s.comments, s.commentModel), nil
+}
 
-		commentsIds := make([]uint, 0)
-		s.comments.Range(func(id uint64, c *Comment) bool {
-			if c.postId == id {
-				commentsIds = append(commentsIds, uint(c.id))
-			}
-			return true
+// keepComment returns a paginate filter that skips deleted comments,
+// or nil if they are included. s.mu must be held while it's used.
+func (s *Storage) keepComment(includeDeleted bool) func(id uint64) bool {
+	if includeDeleted {
+		return nil
+	}
+	return func(id uint64) bool {
+		return s.comments[id].deletedAt == nil
+	}
+}
+
+func (s *Storage) GetCommentTree(ctx context.Context, query models.TreeQuery) (*models.CommentTree, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var firstLevel []uint64
+	if query.RootID == nil {
+		firstLevel = s.rootsByPost[uint64(query.PostID)]
+	} else if root, ok := s.comments[uint64(*query.RootID)]; ok && root.postId == uint64(query.PostID) {
+		firstLevel = s.repliesByParent[root.id]
+	}
+	firstLevel = firstLevel[lowerBound(firstLevel, query.After):]
+
+	tree := &models.CommentTree{
+		Nodes:     make([]*models.CommentTreeNode, 0),
+		Remaining: len(firstLevel),
+	}
+
+	var visit func(id uint64, level int)
+	visit = func(id uint64, level int) {
+		comment := s.comments[id]
+		replies := s.repliesByParent[id]
+		tree.Nodes = append(tree.Nodes, &models.CommentTreeNode{
+			Comment:    *s.commentModel(comment),
+			Depth:      comment.depth,
+			ChildCount: len(replies),
 		})
 
-		comments[i] = &models.Comment{
-			ID:              uint(comment.id),
-			Content:         comment.content,
-			AuthorID:        uint(comment.authorId),
-			CreatedAt:       comment.createdAt,
-			PostID:          uint(comment.postId),
-			ParentCommentID: comment.parentCommentId,
-			RepliesIDs:      commentsIds,
+		if level >= query.MaxDepth {
+			return
 		}
+		for _, reply := range replies[:min(len(replies), query.Limit)] {
+			visit(reply, level+1)
+		}
+	}
+
+	for _, id := range firstLevel[:min(len(firstLevel), query.Limit)] {
+		visit(id, 1)
 	}
 
-	return comments, nil
+	return tree, nil
 }
 
-func (s *Storage) ToggleComments(ctx context.Context, postId uint, userId uint) (bool, error) {
-	post, ok := s.posts.Load(uint64(postId))
+// GetPostRevisionsByPostIds returns revisions of every post in postIds, oldest first.
+func (s *Storage) GetPostRevisionsByPostIds(ctx context.Context, postIds []uint) ([]*models.PostRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := make([]*models.PostRevision, 0)
+	for _, id := range postIds {
+		revisions = append(revisions, s.postRevisions[uint64(id)]...)
+	}
+	slices.SortFunc(revisions, func(a, b *models.PostRevision) int { return cmp.Compare(a.ID, b.ID) })
+
+	return revisions, nil
+}
+
+// GetCommentRevisionsByCommentIds returns revisions of every comment in commentIds, oldest first.
+func (s *Storage) GetCommentRevisionsByCommentIds(ctx context.Context, commentIds []uint) ([]*models.CommentRevision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	revisions := make([]*models.CommentRevision, 0)
+	for _, id := range commentIds {
+		revisions = append(revisions, s.commentRevisions[uint64(id)]...)
+	}
+	slices.SortFunc(revisions, func(a, b *models.CommentRevision) int { return cmp.Compare(a.ID, b.ID) })
+
+	return revisions, nil
+}
+
+func (s *Storage) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	s.refreshTokensMu.Lock()
+	defer s.refreshTokensMu.Unlock()
+
+	t := &RefreshToken{token: *token}
+	if err := s.write(record{RefreshToken: t.record()}); err != nil {
+		return err
+	}
+	s.refreshTokens[token.Hash] = t
+
+	return nil
+}
+
+// UseRefreshToken marks the token as used and returns it. If the token
+// was already used, it's returned along with server.ErrTokenReused.
+func (s *Storage) UseRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	s.refreshTokensMu.Lock()
+	defer s.refreshTokensMu.Unlock()
+
+	t, ok := s.refreshTokens[hash]
 	if !ok {
-		return false, server.ErrPostNotFound
+		return nil, server.ErrInvalidToken
 	}
 
-	if post.authorId != uint64(userId) {
-		return false, server.ErrUnauthorized
+	token := t.token
+	if t.used {
+		return &token, server.ErrTokenReused
+	}
+
+	used := *t
+	used.used = true
+	if err := s.write(record{RefreshToken: used.record()}); err != nil {
+		return nil, err
+	}
+	s.refreshTokens[hash] = &used
+
+	return &token, nil
+}
+
+func (s *Storage) RevokeRefreshTokens(ctx context.Context, family string) error {
+	s.refreshTokensMu.Lock()
+	defer s.refreshTokensMu.Unlock()
+
+	if err := s.write(record{RevokedFamily: family}); err != nil {
+		return err
+	}
+	s.revokeRefreshTokens(family)
+
+	return nil
+}
+
+// GetSessionVersion returns the version session tokens of the user must
+// carry to be valid.
+func (s *Storage) GetSessionVersion(ctx context.Context, userId uint) (uint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[uint64(userId)]
+	if !ok {
+		return 0, server.ErrUserNotFound
+	}
+
+	return uint(user.sessionVersion), nil
+}
+
+// RevokeSessions bumps the session version of the user, so that tokens
+// issued before are no longer valid.
+func (s *Storage) RevokeSessions(ctx context.Context, userId uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[uint64(userId)]
+	if !ok {
+		return server.ErrUserNotFound
 	}
 
-	post.commentsAvailable = !post.commentsAvailable
-	s.posts.Store(uint64(postId), post)
+	updated := *user
+	updated.sessionVersion++
+	if err := s.write(record{User: updated.record()}); err != nil {
+		return err
+	}
+	s.putUser(&updated)
 
-	return post.commentsAvailable, nil
+	return nil
 }
 
-func (s *Storage) GetPostsFromUser(ctx context.Context, userId uint) ([]*models.Post, error) {
-	posts := make([]*models.Post, 0)
+// putUser stores a new user or replaces a stored one.
+// s.mu must be held for writing.
+func (s *Storage) putUser(user *User) {
+	if _, ok := s.users[user.id]; !ok {
+		s.userIds = append(s.userIds, user.id)
+		s.usersSeq = max(s.usersSeq, user.id+1)
+	}
+	s.users[user.id] = user
+	s.byUsername[user.username] = user.id
+	s.byEmail[user.email] = user.id
+	s.search.put(docKey{models.SearchUser, user.id}, "", user.username)
+}
 
-	s.posts.Range(func(id uint64, p *Post) bool {
-		if p.authorId == uint64(userId) {
-			commentsIds := make([]uint, 0)
-			s.comments.Range(func(id uint64, c *Comment) bool {
-				if c.postId == id {
-					commentsIds = append(commentsIds, uint(c.id))
-				}
-				return true
-			})
+// putPost stores a new post or replaces a stored one.
+// s.mu must be held for writing.
+func (s *Storage) putPost(post *Post) {
+	_, stored := s.posts[post.id]
+	s.posts[post.id] = post
+	s.indexPost(post)
+	if stored {
+		return
+	}
 
-			posts = append(posts, &models.Post{
-				ID:          uint(p.id),
-				Title:       p.title,
-				CreatedAt:   p.createdAt,
-				Content:     p.content,
-				AuthorID:    uint(p.authorId),
-				CommentsIDs: commentsIds,
-			})
+	s.postIds = append(s.postIds, post.id)
+	s.postsByAuthor[post.authorId] = append(s.postsByAuthor[post.authorId], post.id)
+	for _, hubId := range post.hubIds {
+		s.postsByHub[hubId] = append(s.postsByHub[hubId], post.id)
+	}
+	s.postsSeq = max(s.postsSeq, post.id+1)
+	if s.ranks != nil {
+		rank := s.ranker(votePost, post.id)
+		s.ranks.posts.insert(0, post.id, rank)
+		for _, hubId := range post.hubIds {
+			s.ranks.hubs.insert(hubId, post.id, rank)
 		}
-		return true
-	})
+	}
+}
 
-	return posts, nil
-}
-
-func (s *Storage) GetReplies(ctx context.Context, commentId uint) ([]*models.Comment, error) {
-	replies := make([]*models.Comment, 0)
-	s.comments.Range(func(id uint64, c *Comment) bool {
-		if c.parentCommentId != nil && *c.parentCommentId == commentId {
-			commentsIds := make([]uint, 0)
-			s.comments.Range(func(id uint64, c *Comment) bool {
-				if c.postId == id {
-					commentsIds = append(commentsIds, uint(c.id))
-				}
-				return true
-			})
-			replies = append(replies, &models.Comment{
-				ID:              uint(c.id),
-				Content:         c.content,
-				AuthorID:        uint(c.authorId),
-				CreatedAt:       c.createdAt,
-				PostID:          uint(c.postId),
-				ParentCommentID: c.parentCommentId,
-				RepliesIDs:      commentsIds,
-			})
+// putComment stores a new comment or replaces a stored one, setting its
+// depth. The parent must already be stored. s.mu must be held for writing.
+func (s *Storage) putComment(comment *Comment) {
+	comment.depth = 0
+	if comment.parentCommentId != nil {
+		comment.depth = s.comments[uint64(*comment.parentCommentId)].depth + 1
+	}
+
+	_, stored := s.comments[comment.id]
+	s.comments[comment.id] = comment
+	s.indexComment(comment)
+	if stored {
+		return
+	}
+
+	s.commentIds = append(s.commentIds, comment.id)
+	s.commentsByPost[comment.postId] = append(s.commentsByPost[comment.postId], comment.id)
+	if comment.parentCommentId == nil {
+		s.rootsByPost[comment.postId] = append(s.rootsByPost[comment.postId], comment.id)
+	} else {
+		parentId := uint64(*comment.parentCommentId)
+		s.repliesByParent[parentId] = append(s.repliesByParent[parentId], comment.id)
+	}
+	s.commentsSeq = max(s.commentsSeq, comment.id+1)
+	if s.ranks != nil {
+		rank := s.ranker(voteComment, comment.id)
+		s.ranks.comments.insert(comment.postId, comment.id, rank)
+		if comment.parentCommentId != nil {
+			s.ranks.replies.insert(uint64(*comment.parentCommentId), comment.id, rank)
 		}
-		return true
-	})
+	}
+}
+
+// s.mu must be held for writing.
+func (s *Storage) addPostRevision(revision *models.PostRevision) {
+	postId := uint64(revision.PostID)
+	s.postRevisions[postId] = append(s.postRevisions[postId], revision)
+	s.postRevisionsSeq = max(s.postRevisionsSeq, uint64(revision.ID))
+}
+
+// s.mu must be held for writing.
+func (s *Storage) addCommentRevision(revision *models.CommentRevision) {
+	commentId := uint64(revision.CommentID)
+	s.commentRevisions[commentId] = append(s.commentRevisions[commentId], revision)
+	s.commentRevisionsSeq = max(s.commentRevisionsSeq, uint64(revision.ID))
+}
+
+// putVote replaces the vote of the user, updating counters of its target.
+// s.mu must be held for writing.
+func (s *Storage) putVote(vote *voteRecord) {
+	index := s.postVotes
+	if vote.Kind == voteComment {
+		index = s.commentVotes
+	}
 
-	return replies, nil
-}
-
-func (s *Storage) GetCommentsForPost(ctx context.Context, postId uint) ([]*models.Comment, error) {
-	comments := make([]*models.Comment, 0)
-	s.comments.Range(func(id uint64, c *Comment) bool {
-		if c.postId == uint64(postId) {
-			commentsIds := make([]uint, 0)
-			s.comments.Range(func(id uint64, c *Comment) bool {
-				if c.postId == id {
-					commentsIds = append(commentsIds, uint(c.id))
-				}
-				return true
-			})
-			comments = append(comments, &models.Comment{
-				ID:              uint(c.id),
-				Content:         c.content,
-				AuthorID:        uint(c.authorId),
-				CreatedAt:       c.createdAt,
-				PostID:          uint(c.postId),
-				ParentCommentID: c.parentCommentId,
-				RepliesIDs:      commentsIds,
-			})
+	v, ok := index[vote.TargetID]
+	if !ok {
+		v = &votes{byUser: make(map[uint64]int)}
+		index[vote.TargetID] = v
+	}
+
+	old := s.ranker(vote.Kind, vote.TargetID)
+	v.count(v.byUser[vote.UserID], -1)
+	v.count(vote.Value, 1)
+	if vote.Value == 0 {
+		delete(v.byUser, vote.UserID)
+	} else {
+		v.byUser[vote.UserID] = vote.Value
+	}
+	s.rerank(vote.Kind, vote.TargetID, old)
+}
+
+// of returns the vote of the user, or 0 if there's none.
+func (v *votes) of(userId uint64) int {
+	if v == nil {
+		return 0
+	}
+	return v.byUser[userId]
+}
+
+func (v *votes) count(value int, delta int) {
+	switch value {
+	case 1:
+		v.upvotes += delta
+	case -1:
+		v.downvotes += delta
+	}
+}
+
+// counts returns upvotes and downvotes.
+func (v *votes) counts() (int, int) {
+	if v == nil {
+		return 0, 0
+	}
+	return v.upvotes, v.downvotes
+}
+
+// s.refreshTokensMu must be held.
+func (s *Storage) revokeRefreshTokens(family string) {
+	for hash, t := range s.refreshTokens {
+		if t.token.Family == family {
+			delete(s.refreshTokens, hash)
 		}
-		return true
-	})
+	}
+}
+
+// userModel converts a stored user to a model. s.mu must be held.
+func (s *Storage) userModel(user *User) *models.User {
+	return &models.User{
+		ID:       uint(user.id),
+		Username: user.username,
+		Email:    user.email,
+		Role:     user.role,
+		PostsIDs: idArray(s.postsByAuthor[user.id]),
 
-	return comments, nil
+		FollowersCount: len(s.followers[user.id]),
+	}
+}
+
+// postModel converts a stored post to a model. s.mu must be held.
+func (s *Storage) postModel(post *Post) *models.Post {
+	upvotes, downvotes := s.postVotes[post.id].counts()
+	return &models.Post{
+		ID:                uint(post.id),
+		Title:             post.title,
+		CreatedAt:         post.createdAt,
+		Content:           post.content,
+		CommentsAvailable: post.commentsAvailable,
+		AuthorID:          uint(post.authorId),
+		EditedAt:          post.editedAt,
+		DeletedAt:         post.deletedAt,
+		CommentsIDs:       idArray(s.commentsByPost[post.id]),
+		Upvotes:           upvotes,
+		Downvotes:         downvotes,
+	}
+}
+
+// commentModel converts a stored comment to a model. s.mu must be held.
+func (s *Storage) commentModel(comment *Comment) *models.Comment {
+	upvotes, downvotes := s.commentVotes[comment.id].counts()
+	return &models.Comment{
+		ID:              uint(comment.id),
+		Content:         comment.content,
+		AuthorID:        uint(comment.authorId),
+		CreatedAt:       comment.createdAt,
+		PostID:          uint(comment.postId),
+		ParentCommentID: comment.parentCommentId,
+		EditedAt:        comment.editedAt,
+		DeletedAt:       comment.deletedAt,
+		RepliesIDs:      idArray(s.repliesByParent[comment.id]),
+		Upvotes:         upvotes,
+		Downvotes:       downvotes,
+	}
+}
+
+// idArray copies an index entry, so that models don't share it.
+func idArray(ids []uint64) models.IDArray {
+	res := make(models.IDArray, len(ids))
+	for i, id := range ids {
+		res[i] = uint(id)
+	}
+	return res
+}
+
+// mapIds converts objects with the given ids to models, skipping missing ones.
+func mapIds[I uint | uint64, T, M any](ids []I, objects map[uint64]*T, model func(*T) *M) []*M {
+	res := make([]*M, 0, len(ids))
+	for _, id := range ids {
+		if obj, ok := objects[uint64(id)]; ok {
+			res = append(res, model(obj))
+		}
+	}
+	return res
 }
@@ -2,8 +2,16 @@ package inmemory_test
 
 import (
 	"context"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/lib/password"
+	"github.com/rmntim/ozon-task/internal/lib/validation"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
 	"github.com/rmntim/ozon-task/internal/storage/inmemory"
+	"github.com/rmntim/ozon-task/internal/storage/storagetest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -16,7 +24,7 @@ func TestStorage_CreateComment(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	post, err := s.CreatePost(ctx, "test", "test", user.ID)
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
 	if err != nil {
 		t.Error("post should be created")
 	}
@@ -60,7 +68,7 @@ func TestStorage_GetCommentById(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	post, err := s.CreatePost(ctx, "test", "test", user.ID)
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
 	if err != nil {
 		t.Error("post should be created")
 	}
@@ -89,7 +97,7 @@ func TestStorage_CreatePost(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	post, err := s.CreatePost(ctx, "test", "test", user.ID)
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
 	if err != nil {
 		t.Error("post should be created")
 	}
@@ -124,7 +132,7 @@ func TestStorage_GetPostById(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	post, err := s.CreatePost(ctx, "test", "test", user.ID)
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
 	if err != nil {
 		t.Error("post should be created")
 	}
@@ -193,7 +201,7 @@ func TestStorage_GetComments(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	post, err := s.CreatePost(ctx, "test", "test", user.ID)
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
 	if err != nil {
 		t.Error("post should be created")
 	}
@@ -203,7 +211,7 @@ func TestStorage_GetComments(t *testing.T) {
 		t.Error("comment should be created")
 	}
 
-	comments, err := s.GetComments(ctx, 10, 0)
+	comments, err := s.GetComments(ctx, models.Page{Limit: 10})
 	if err != nil {
 		t.Error("comments should be found")
 	}
@@ -226,7 +234,7 @@ func TestStorage_GetCommentsForPost(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	post, err := s.CreatePost(ctx, "test", "test", user.ID)
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
 	if err != nil {
 		t.Error("post should be created")
 	}
@@ -236,7 +244,7 @@ func TestStorage_GetCommentsForPost(t *testing.T) {
 		t.Error("comment should be created")
 	}
 
-	comments, err := s.GetCommentsForPost(ctx, post.ID)
+	comments, err := s.GetCommentsForPost(ctx, post.ID, models.Page{Limit: 10}, true)
 	if err != nil {
 		t.Error("comments should be found")
 	}
@@ -259,12 +267,12 @@ func TestStorage_GetPosts(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	post, err := s.CreatePost(ctx, "test", "test", user.ID)
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
 	if err != nil {
 		t.Error("post should be created")
 	}
 
-	posts, err := s.GetPosts(ctx, 10, 0)
+	posts, err := s.GetPosts(ctx, models.Page{Limit: 10})
 	if err != nil {
 		t.Error("posts should be found")
 	}
@@ -287,12 +295,12 @@ func TestStorage_GetPostsFromUser(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	post, err := s.CreatePost(ctx, "test", "test", user.ID)
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
 	if err != nil {
 		t.Error("post should be created")
 	}
 
-	posts, err := s.GetPostsFromUser(ctx, user.ID)
+	posts, err := s.GetPostsFromUser(ctx, user.ID, models.Page{Limit: 10})
 	if err != nil {
 		t.Error("posts should be found")
 	}
@@ -315,7 +323,7 @@ func TestStorage_GetReplies(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	post, err := s.CreatePost(ctx, "test", "test", user.ID)
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
 	if err != nil {
 		t.Error("post should be created")
 	}
@@ -330,7 +338,7 @@ func TestStorage_GetReplies(t *testing.T) {
 		t.Error("reply should be created")
 	}
 
-	replies, err := s.GetReplies(ctx, comment.ID)
+	replies, err := s.GetReplies(ctx, comment.ID, models.Page{Limit: 10}, true)
 	if err != nil {
 		t.Error("replies should be found")
 	}
@@ -353,7 +361,7 @@ func TestStorage_GetUsers(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	users, err := s.GetUsers(ctx, 10, 0)
+	users, err := s.GetUsers(ctx, models.Page{Limit: 10})
 	if err != nil {
 		t.Error("users should be found")
 	}
@@ -376,7 +384,7 @@ func TestStorage_ToggleComments(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	post, err := s.CreatePost(ctx, "test", "test", user.ID)
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
 	if err != nil {
 		t.Error("post should be created")
 	}
@@ -400,7 +408,7 @@ func TestStorage_ToggleCommentsUnauthorized(t *testing.T) {
 		t.Error("user should be created")
 	}
 
-	post, err := s.CreatePost(ctx, "test", "test", user.ID)
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
 	if err != nil {
 		t.Error("post should be created")
 	}
@@ -410,3 +418,446 @@ func TestStorage_ToggleCommentsUnauthorized(t *testing.T) {
 		t.Error("should return error")
 	}
 }
+
+func TestStorage_GetUsersByIds(t *testing.T) {
+	s := inmemory.New()
+
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Error("user should be created")
+	}
+
+	users, err := s.GetUsersByIds(ctx, []uint{user.ID, 42})
+	if err != nil {
+		t.Error("users should be found")
+	}
+
+	if len(users) != 1 {
+		t.Error("only existing users should be returned")
+	}
+
+	if !reflect.DeepEqual(users[0], user) {
+		t.Error("users should be equal")
+	}
+}
+
+func TestStorage_GetRepliesByCommentIds(t *testing.T) {
+	s := inmemory.New()
+
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Error("user should be created")
+	}
+
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
+	if err != nil {
+		t.Error("post should be created")
+	}
+
+	first, err := s.CreateComment(ctx, "test", user.ID, post.ID, nil)
+	if err != nil {
+		t.Error("comment should be created")
+	}
+
+	second, err := s.CreateComment(ctx, "test", user.ID, post.ID, nil)
+	if err != nil {
+		t.Error("comment should be created")
+	}
+
+	if _, err := s.CreateComment(ctx, "test", user.ID, post.ID, &first.ID); err != nil {
+		t.Error("reply should be created")
+	}
+
+	if _, err := s.CreateComment(ctx, "test", user.ID, post.ID, &second.ID); err != nil {
+		t.Error("reply should be created")
+	}
+
+	replies, err := s.GetRepliesByCommentIds(ctx, []uint{first.ID, second.ID}, models.Page{Limit: 10}, true)
+	if err != nil {
+		t.Error("replies should be found")
+	}
+
+	if len(replies) != 2 {
+		t.Error("replies for both comments should be returned")
+	}
+}
+
+func TestStorage_GetPostsPage(t *testing.T) {
+	s := inmemory.New()
+
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Error("user should be created")
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := s.CreatePost(ctx, "test", "test", user.ID, nil); err != nil {
+			t.Error("post should be created")
+		}
+	}
+
+	posts, err := s.GetPosts(ctx, models.Page{Limit: 2, After: models.Cursor{ID: 1, Valid: true}})
+	if err != nil {
+		t.Error("posts should be found")
+	}
+
+	if len(posts) != 2 || posts[0].ID != 2 || posts[1].ID != 3 {
+		t.Error("posts should be the two following the cursor")
+	}
+
+	posts, err = s.GetPosts(ctx, models.Page{Limit: 2, Before: models.Cursor{ID: 4, Valid: true}, FromEnd: true})
+	if err != nil {
+		t.Error("posts should be found")
+	}
+
+	if len(posts) != 2 || posts[0].ID != 2 || posts[1].ID != 3 {
+		t.Error("posts should be the two preceding the cursor in ascending order")
+	}
+}
+
+func TestStorage_GetCommentTree(t *testing.T) {
+	s := inmemory.New()
+
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Error("user should be created")
+	}
+
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
+	if err != nil {
+		t.Error("post should be created")
+	}
+
+	// 0
+	// ├── 1
+	// │   └── 2
+	// └── 3
+	// 4
+	root, _ := s.CreateComment(ctx, "test", user.ID, post.ID, nil)
+	reply, _ := s.CreateComment(ctx, "test", user.ID, post.ID, &root.ID)
+	_, _ = s.CreateComment(ctx, "test", user.ID, post.ID, &reply.ID)
+	_, _ = s.CreateComment(ctx, "test", user.ID, post.ID, &root.ID)
+	_, _ = s.CreateComment(ctx, "test", user.ID, post.ID, nil)
+
+	tree, err := s.GetCommentTree(ctx, models.TreeQuery{PostID: post.ID, MaxDepth: 2, Limit: 1})
+	if err != nil {
+		t.Error("tree should be found")
+	}
+
+	if tree.Remaining != 2 {
+		t.Error("both top-level comments should be counted")
+	}
+
+	if len(tree.Nodes) != 2 {
+		t.Fatal("tree should be cut by depth and limit")
+	}
+
+	if tree.Nodes[0].ID != 0 || tree.Nodes[0].Depth != 0 || tree.Nodes[0].ChildCount != 2 {
+		t.Error("first node should be the root with two replies")
+	}
+
+	if tree.Nodes[1].ID != 1 || tree.Nodes[1].Depth != 1 || tree.Nodes[1].ChildCount != 1 {
+		t.Error("second node should be the first reply")
+	}
+
+	tree, err = s.GetCommentTree(ctx, models.TreeQuery{PostID: post.ID, RootID: &root.ID, After: models.Cursor{ID: 1, Valid: true}, MaxDepth: 5, Limit: 10})
+	if err != nil {
+		t.Error("tree should be found")
+	}
+
+	if len(tree.Nodes) != 1 || tree.Nodes[0].ID != 3 {
+		t.Error("only replies after the cursor should be loaded")
+	}
+}
+
+func TestStorage_GetUserByUsername(t *testing.T) {
+	s := inmemory.New()
+
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Error("user should be created")
+	}
+
+	found, err := s.GetUserByUsername(ctx, "test")
+	if err != nil {
+		t.Fatal("user should be found")
+	}
+
+	if found.ID != user.ID {
+		t.Error("user ids should be equal")
+	}
+
+	if !password.Check(found.PasswordHash, "test") {
+		t.Error("password hash should match the password")
+	}
+
+	if _, err := s.GetUserByUsername(ctx, "unknown"); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("should return ErrUserNotFound")
+	}
+}
+
+func TestStorage_SetUserRole(t *testing.T) {
+	s := inmemory.New()
+
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+
+	if user.IsAdmin() {
+		t.Error("new user should not be admin")
+	}
+
+	if err := s.SetUserRole(ctx, user.ID, models.RoleAdmin); err != nil {
+		t.Fatal("role should be set")
+	}
+
+	user, err = s.GetUserById(ctx, user.ID)
+	if err != nil {
+		t.Fatal("user should be found")
+	}
+
+	if !user.IsAdmin() {
+		t.Error("user should be admin")
+	}
+
+	if err := s.SetUserRole(ctx, 42, models.RoleAdmin); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("role of non-existent user should not be set")
+	}
+}
+
+func TestStorage_UpdatePost(t *testing.T) {
+	s := inmemory.New()
+
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+
+	post, err := s.CreatePost(ctx, "title", "content", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created")
+	}
+
+	if _, err := s.UpdatePost(ctx, post.ID, user.ID+1, "new title", "new content"); !errors.Is(err, server.ErrUnauthorized) {
+		t.Error("post should not be updated by other user")
+	}
+
+	if _, err := s.UpdatePost(ctx, 42, user.ID, "new title", "new content"); !errors.Is(err, server.ErrPostNotFound) {
+		t.Error("non-existent post should not be updated")
+	}
+
+	updated, err := s.UpdatePost(ctx, post.ID, user.ID, "new title", "new content")
+	if err != nil {
+		t.Fatal("post should be updated")
+	}
+
+	if updated.Title != "new title" || updated.Content != "new content" {
+		t.Error("post should have new title and content")
+	}
+
+	if updated.EditedAt == nil {
+		t.Error("post edit time should be set")
+	}
+
+	revisions, err := s.GetPostRevisionsByPostIds(ctx, []uint{post.ID})
+	if err != nil {
+		t.Fatal("revisions should be found")
+	}
+
+	if len(revisions) != 1 || revisions[0].Title != "title" || revisions[0].Content != "content" {
+		t.Error("previous version should be kept as a revision")
+	}
+
+	if !revisions[0].CreatedAt.Equal(post.CreatedAt) {
+		t.Error("revision should be created at post creation time")
+	}
+}
+
+func TestStorage_UpdateComment(t *testing.T) {
+	s := inmemory.New()
+
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+
+	post, err := s.CreatePost(ctx, "title", "content", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created")
+	}
+
+	comment, err := s.CreateComment(ctx, "first", user.ID, post.ID, nil)
+	if err != nil {
+		t.Fatal("comment should be created")
+	}
+
+	if _, err := s.UpdateComment(ctx, comment.ID, user.ID+1, "second"); !errors.Is(err, server.ErrUnauthorized) {
+		t.Error("comment should not be updated by other user")
+	}
+
+	first, err := s.UpdateComment(ctx, comment.ID, user.ID, "second")
+	if err != nil {
+		t.Fatal("comment should be updated")
+	}
+
+	second, err := s.UpdateComment(ctx, comment.ID, user.ID, "third")
+	if err != nil {
+		t.Fatal("comment should be updated")
+	}
+
+	if second.Content != "third" {
+		t.Error("comment should have new content")
+	}
+
+	revisions, err := s.GetCommentRevisionsByCommentIds(ctx, []uint{comment.ID})
+	if err != nil {
+		t.Fatal("revisions should be found")
+	}
+
+	if len(revisions) != 2 || revisions[0].Content != "first" || revisions[1].Content != "second" {
+		t.Error("every previous version should be kept, oldest first")
+	}
+
+	if !revisions[1].CreatedAt.Equal(*first.EditedAt) {
+		t.Error("revision should be created at previous edit time")
+	}
+}
+
+func TestStorage_DeleteComment(t *testing.T) {
+	s := inmemory.New()
+
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+
+	post, err := s.CreatePost(ctx, "title", "content", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created")
+	}
+
+	comment, err := s.CreateComment(ctx, "comment", user.ID, post.ID, nil)
+	if err != nil {
+		t.Fatal("comment should be created")
+	}
+
+	reply, err := s.CreateComment(ctx, "reply", user.ID, post.ID, &comment.ID)
+	if err != nil {
+		t.Fatal("reply should be created")
+	}
+
+	if err := s.DeleteComment(ctx, comment.ID); err != nil {
+		t.Fatal("comment should be deleted")
+	}
+
+	if err := s.DeleteComment(ctx, 42); !errors.Is(err, server.ErrCommentNotFound) {
+		t.Error("non-existent comment should not be deleted")
+	}
+
+	deleted, err := s.GetCommentById(ctx, comment.ID)
+	if err != nil {
+		t.Fatal("deleted comment should still be found")
+	}
+
+	if deleted.DeletedAt == nil {
+		t.Error("comment deletion time should be set")
+	}
+
+	comments, err := s.GetCommentsForPost(ctx, post.ID, models.Page{Limit: 10}, false)
+	if err != nil {
+		t.Fatal("comments should be found")
+	}
+
+	if len(comments) != 1 || comments[0].ID != reply.ID {
+		t.Error("deleted comment should be skipped")
+	}
+
+	comments, err = s.GetCommentsForPost(ctx, post.ID, models.Page{Limit: 10}, true)
+	if err != nil {
+		t.Fatal("comments should be found")
+	}
+
+	if len(comments) != 2 {
+		t.Error("deleted comment should be included")
+	}
+
+	replies, err := s.GetReplies(ctx, comment.ID, models.Page{Limit: 10}, false)
+	if err != nil {
+		t.Fatal("replies should be found")
+	}
+
+	if len(replies) != 1 || replies[0].ID != reply.ID {
+		t.Error("replies of deleted comment should stay in place")
+	}
+
+	if _, err := s.UpdateComment(ctx, comment.ID, user.ID, "new"); !errors.Is(err, server.ErrCommentNotFound) {
+		t.Error("deleted comment should not be updated")
+	}
+}
+
+func TestStorage_DeletePost(t *testing.T) {
+	s := inmemory.New()
+
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+
+	post, err := s.CreatePost(ctx, "title", "content", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created")
+	}
+
+	if err := s.DeletePost(ctx, post.ID); err != nil {
+		t.Fatal("post should be deleted")
+	}
+
+	deleted, err := s.GetPostById(ctx, post.ID)
+	if err != nil {
+		t.Fatal("deleted post should still be found")
+	}
+
+	if deleted.DeletedAt == nil {
+		t.Error("post deletion time should be set")
+	}
+
+	if _, err := s.CreateComment(ctx, "comment", user.ID, post.ID, nil); !errors.Is(err, server.ErrCommentsDisabled) {
+		t.Error("deleted post should not be commented")
+	}
+}
+
+func TestStorage_CreateCommentTooLong(t *testing.T) {
+	s := inmemory.New()
+
+	ctx := context.Background()
+	user, err := s.CreateUser(ctx, "test", "test", "test")
+	if err != nil {
+		t.Fatal("user should be created")
+	}
+	post, err := s.CreatePost(ctx, "test", "test", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created")
+	}
+
+	var errs validation.Errors
+	if _, err := s.CreateComment(ctx, strings.Repeat("a", 2001), user.ID, post.ID, nil); !errors.As(err, &errs) {
+		t.Error("comment over 2000 characters should be rejected")
+	}
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return inmemory.New()
+	})
+}
@@ -0,0 +1,128 @@
+package inmemory
+
+import (
+	"slices"
+
+	"github.com/rmntim/ozon-task/internal/models"
+)
+
+// paginate cuts out the window selected by page from ids, which must be
+// sorted. Bounds are found with binary search, so a page costs
+// O(log n + limit) unless keep rejects many items. keep may be nil.
+// Ranked orders aren't indexed by ids, so they are taken for OrderOld.
+func paginate(ids []uint64, page models.Page, keep func(id uint64) bool) []uint64 {
+	if page.Order == models.OrderNew {
+		// Newest first is the other way round of ids, which are searched
+		// with swapped bounds and the window reversed.
+		page.After, page.Before, page.FromEnd = page.Before, page.After, !page.FromEnd
+		page.Order = models.OrderOld
+		res := slices.Clone(paginate(ids, page, keep))
+		slices.Reverse(res)
+		return res
+	}
+
+	lo, hi := lowerBound(ids, page.After), upperBound(ids, page.Before)
+	return window(ids[lo:max(lo, hi)], page, keep)
+}
+
+// paginateRanked cuts out the window selected by page from keys sorted
+// in a ranked order. Cursors are placed with keyOf, and one pointing at
+// a missing item selects nothing. keep may be nil.
+func paginateRanked(keys []rankKey, page models.Page, keyOf func(id uint64) (rankKey, bool), keep func(id uint64) bool) []uint64 {
+	lo, hi := 0, len(keys)
+	if page.After.Valid {
+		after, ok := keyOf(uint64(page.After.ID))
+		if !ok {
+			return nil
+		}
+		i, found := slices.BinarySearchFunc(keys, after, compareRankKeys)
+		if found {
+			i++
+		}
+		lo = i
+	}
+	if page.Before.Valid {
+		before, ok := keyOf(uint64(page.Before.ID))
+		if !ok {
+			return nil
+		}
+		hi, _ = slices.BinarySearchFunc(keys, before, compareRankKeys)
+	}
+
+	var keepKey func(k rankKey) bool
+	if keep != nil {
+		keepKey = func(k rankKey) bool { return keep(k.id) }
+	}
+	keys = window(keys[lo:max(lo, hi)], page, keepKey)
+
+	ids := make([]uint64, len(keys))
+	for i, k := range keys {
+		ids[i] = k.id
+	}
+	return ids
+}
+
+// window returns up to page.Limit items kept by keep from either end of
+// items, depending on page.FromEnd. keep may be nil.
+func window[T any](items []T, page models.Page, keep func(T) bool) []T {
+	if keep == nil {
+		if len(items) > page.Limit {
+			if page.FromEnd {
+				return items[len(items)-page.Limit:]
+			}
+			return items[:page.Limit]
+		}
+		return items
+	}
+
+	res := make([]T, 0, min(len(items), page.Limit))
+	if page.FromEnd {
+		for i := len(items) - 1; i >= 0 && len(res) < page.Limit; i-- {
+			if keep(items[i]) {
+				res = append(res, items[i])
+			}
+		}
+		slices.Reverse(res)
+		return res
+	}
+	for i := 0; i < len(items) && len(res) < page.Limit; i++ {
+		if keep(items[i]) {
+			res = append(res, items[i])
+		}
+	}
+	return res
+}
+
+// paginateGroups collects the page of every group, got with pageOf,
+// ordered by group and in page order within a group.
+func paginateGroups(groups []uint, pageOf func(group uint64) []uint64) []uint64 {
+	groups = slices.Clone(groups)
+	slices.Sort(groups)
+
+	ids := make([]uint64, 0)
+	for _, group := range slices.Compact(groups) {
+		ids = append(ids, pageOf(uint64(group))...)
+	}
+	return ids
+}
+
+// lowerBound returns the index of the first id after the cursor.
+func lowerBound(ids []uint64, after models.Cursor) int {
+	if !after.Valid {
+		return 0
+	}
+	i, found := slices.BinarySearch(ids, uint64(after.ID))
+	if found {
+		i++
+	}
+	return i
+}
+
+// upperBound returns the index of the first id not before the cursor.
+func upperBound(ids []uint64, before models.Cursor) int {
+	if !before.Valid {
+		return len(ids)
+	}
+	i, _ := slices.BinarySearch(ids, uint64(before.ID))
+	return i
+}
@@ -0,0 +1,399 @@
+package inmemory
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rmntim/ozon-task/internal/lib/logger/sl"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Options configures persistence of the storage.
+type Options struct {
+	// Path is the snapshot file. Write-ahead log segments are kept next
+	// to it, named Path + ".wal.N".
+	Path string
+	// Format is `gob` or `json`.
+	Format string
+	// SnapshotInterval is how often Run takes a snapshot. If it's zero,
+	// snapshots are only taken on Close.
+	SnapshotInterval time.Duration
+	// SyncInterval is how often Run fsyncs the log, that is how much
+	// of the latest changes a crash may lose. If it's zero, every
+	// change is fsynced before it's applied.
+	SyncInterval time.Duration
+}
+
+// Open loads the storage from the snapshot and the write-ahead log,
+// then logs every change. Run must be called to keep the log synced and
+// take snapshots, and Close to take the last one.
+func Open(opts Options) (*Storage, error) {
+	const op = "storage.inmemory.Open"
+
+	if opts.Format != formatGob && opts.Format != formatJSON {
+		return nil, fmt.Errorf("%s: unknown snapshot format: %s", op, opts.Format)
+	}
+
+	s := New()
+	s.opts = opts
+	// Rank indexes are built once everything is loaded.
+	s.ranks = nil
+
+	segment, err := s.loadSnapshot()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	segments, err := walSegments(opts.Path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	next := segment
+	for _, n := range segments {
+		if n < segment {
+			continue
+		}
+		if err := s.replay(walSegmentPath(opts.Path, n)); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		next = n + 1
+	}
+	s.buildRanks()
+
+	s.wal, err = openWAL(opts.Path, opts.Format, next, opts.SyncInterval == 0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s, nil
+}
+
+// Run fsyncs the write-ahead log and takes snapshots as configured until
+// ctx is done. It returns at once if the storage isn't persistent.
+func (s *Storage) Run(ctx context.Context, log *slog.Logger) {
+	if s.wal == nil {
+		return
+	}
+	log = log.With(slog.String("op", "storage.inmemory.Run"))
+
+	var syncs, snapshots <-chan time.Time
+	if s.opts.SyncInterval > 0 {
+		ticker := time.NewTicker(s.opts.SyncInterval)
+		defer ticker.Stop()
+		syncs = ticker.C
+	}
+	if s.opts.SnapshotInterval > 0 {
+		ticker := time.NewTicker(s.opts.SnapshotInterval)
+		defer ticker.Stop()
+		snapshots = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncs:
+			if err := s.wal.sync(); err != nil {
+				log.Error("failed to sync write-ahead log", sl.Err(err))
+			}
+		case <-snapshots:
+			if err := s.Snapshot(); err != nil {
+				log.Error("failed to take snapshot", sl.Err(err))
+			}
+		}
+	}
+}
+
+// Close takes the last snapshot and closes the write-ahead log. The
+// storage must not be changed afterwards.
+func (s *Storage) Close() error {
+	const op = "storage.inmemory.Close"
+
+	if s.wal == nil {
+		return nil
+	}
+
+	if err := s.Snapshot(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.wal.close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// Snapshot writes the whole storage to the snapshot file and removes log
+// segments it covers. Changes are blocked only while the storage is
+// copied, not while it's written.
+func (s *Storage) Snapshot() error {
+	const op = "storage.inmemory.Snapshot"
+
+	if s.wal == nil {
+		return nil
+	}
+
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	snap, err := s.capture()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := writeSnapshot(s.opts.Path, s.opts.Format, snap); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	segments, err := walSegments(s.opts.Path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	for _, n := range segments {
+		if n >= snap.Segment {
+			break
+		}
+		if err := os.Remove(walSegmentPath(s.opts.Path, n)); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// capture copies the storage and starts a new log segment, so that the
+// copy holds exactly the changes logged to earlier segments.
+func (s *Storage) capture() (*snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.refreshTokensMu.Lock()
+	defer s.refreshTokensMu.Unlock()
+
+	snap := &snapshot{
+		Users:    make([]userRecord, 0, len(s.userIds)),
+		Hubs:     make([]hubRecord, 0, len(s.hubIds)),
+		Posts:    make([]postRecord, 0, len(s.postIds)),
+		Comments: make([]commentRecord, 0, len(s.commentIds)),
+	}
+	for _, id := range s.userIds {
+		snap.Users = append(snap.Users, *s.users[id].record())
+	}
+	for _, id := range s.hubIds {
+		snap.Hubs = append(snap.Hubs, *s.hubs[id].record())
+	}
+	for _, id := range s.postIds {
+		snap.Posts = append(snap.Posts, *s.posts[id].record())
+		for _, revision := range s.postRevisions[id] {
+			snap.PostRevisions = append(snap.PostRevisions, *postRevisionRecord(revision))
+		}
+	}
+	for _, id := range s.commentIds {
+		snap.Comments = append(snap.Comments, *s.comments[id].record())
+		for _, revision := range s.commentRevisions[id] {
+			snap.CommentRevisions = append(snap.CommentRevisions, *commentRevisionRecord(revision))
+		}
+	}
+	snap.Votes = append(snap.Votes, voteRecords(votePost, s.postVotes)...)
+	snap.Votes = append(snap.Votes, voteRecords(voteComment, s.commentVotes)...)
+	snap.Subscriptions = append(snap.Subscriptions, subscriptionRecords(subscriptionHub, s.hubSubscribers)...)
+	snap.Subscriptions = append(snap.Subscriptions, subscriptionRecords(subscriptionUser, s.followers)...)
+	for _, t := range s.refreshTokens {
+		snap.RefreshTokens = append(snap.RefreshTokens, *t.record())
+	}
+
+	segment, err := s.wal.rotate()
+	if err != nil {
+		return nil, err
+	}
+	snap.Segment = segment
+
+	return snap, nil
+}
+
+// write logs the change before it's applied.
+// s.mu or s.refreshTokensMu must be held, depending on the change.
+func (s *Storage) write(rec record) error {
+	if s.wal == nil {
+		return nil
+	}
+	if err := s.wal.append(rec); err != nil {
+		return fmt.Errorf("storage.inmemory.write: %w", err)
+	}
+	return nil
+}
+
+// loadSnapshot applies the snapshot file if there is one and returns
+// the first log segment written after it.
+func (s *Storage) loadSnapshot() (uint64, error) {
+	f, err := os.Open(s.opts.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var snap snapshot
+	if err := newDecoder(s.opts.Format, bufio.NewReader(f)).Decode(&snap); err != nil {
+		return 0, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+
+	for i := range snap.Users {
+		s.putUser(snap.Users[i].user())
+	}
+	for i := range snap.Hubs {
+		s.putHub(snap.Hubs[i].hub())
+	}
+	for i := range snap.Posts {
+		s.putPost(snap.Posts[i].post())
+	}
+	for i := range snap.PostRevisions {
+		s.addPostRevision(snap.PostRevisions[i].revision())
+	}
+	for i := range snap.Comments {
+		s.putComment(snap.Comments[i].comment())
+	}
+	for i := range snap.CommentRevisions {
+		s.addCommentRevision(snap.CommentRevisions[i].revision())
+	}
+	for i := range snap.Votes {
+		s.putVote(&snap.Votes[i])
+	}
+	for i := range snap.Subscriptions {
+		s.putSubscription(&snap.Subscriptions[i])
+	}
+	for i := range snap.RefreshTokens {
+		t := snap.RefreshTokens[i].refreshToken()
+		s.refreshTokens[t.token.Hash] = t
+	}
+
+	return snap.Segment, nil
+}
+
+// replay applies every record of the log segment. A record cut short by
+// a crash ends the segment.
+func (s *Storage) replay(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := newDecoder(s.opts.Format, bufio.NewReader(f))
+	for {
+		var rec record
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", filepath.Base(path), err)
+		}
+		s.apply(&rec)
+	}
+}
+
+func (s *Storage) apply(rec *record) {
+	if rec.User != nil {
+		s.putUser(rec.User.user())
+	}
+	if rec.Hub != nil {
+		s.putHub(rec.Hub.hub())
+	}
+	if rec.Post != nil {
+		s.putPost(rec.Post.post())
+	}
+	if rec.PostRevision != nil {
+		s.addPostRevision(rec.PostRevision.revision())
+	}
+	if rec.Comment != nil {
+		s.putComment(rec.Comment.comment())
+	}
+	if rec.CommentRevision != nil {
+		s.addCommentRevision(rec.CommentRevision.revision())
+	}
+	if rec.RefreshToken != nil {
+		t := rec.RefreshToken.refreshToken()
+		s.refreshTokens[t.token.Hash] = t
+	}
+	if rec.RevokedFamily != "" {
+		s.revokeRefreshTokens(rec.RevokedFamily)
+	}
+	if rec.Vote != nil {
+		s.putVote(rec.Vote)
+	}
+	if rec.Subscription != nil {
+		s.putSubscription(rec.Subscription)
+	}
+}
+
+// voteRecords lists every vote in index.
+func voteRecords(kind string, index map[uint64]*votes) []voteRecord {
+	var res []voteRecord
+	for target, v := range index {
+		for user, value := range v.byUser {
+			res = append(res, voteRecord{Kind: kind, TargetID: target, UserID: user, Value: value})
+		}
+	}
+	return res
+}
+
+// subscriptionRecords lists every subscription in index of subscribers
+// by target.
+func subscriptionRecords(kind string, index map[uint64]map[uint64]struct{}) []subscriptionRecord {
+	var res []subscriptionRecord
+	for target, users := range index {
+		for user := range users {
+			res = append(res, subscriptionRecord{Kind: kind, TargetID: target, UserID: user, Subscribed: true})
+		}
+	}
+	return res
+}
+
+// writeSnapshot replaces the snapshot file atomically.
+func writeSnapshot(path, format string, snap *snapshot) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	w := bufio.NewWriter(f)
+	if err := newEncoder(format, w).Encode(snap); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir makes renames and removals in the directory durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
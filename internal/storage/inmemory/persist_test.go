@@ -0,0 +1,351 @@
+package inmemory_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"github.com/rmntim/ozon-task/internal/storage/inmemory"
+	"github.com/rmntim/ozon-task/internal/storage/storagetest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var formats = []string{"gob", "json"}
+
+func openStorage(t *testing.T, path, format string) *inmemory.Storage {
+	t.Helper()
+	s, err := inmemory.Open(inmemory.Options{Path: path, Format: format})
+	if err != nil {
+		t.Fatal("storage should be opened:", err)
+	}
+	return s
+}
+
+// fill makes every kind of change the storage logs.
+func fill(t *testing.T, s *inmemory.Storage) {
+	t.Helper()
+	ctx := context.Background()
+
+	user, err := s.CreateUser(ctx, "test", "test@example.com", "password")
+	if err != nil {
+		t.Fatal("user should be created:", err)
+	}
+	if err := s.SetUserRole(ctx, user.ID, models.RoleModerator); err != nil {
+		t.Fatal("role should be set:", err)
+	}
+	if err := s.RevokeSessions(ctx, user.ID); err != nil {
+		t.Fatal("sessions should be revoked:", err)
+	}
+
+	hub, err := s.CreateHub(ctx, "test", "title", "description")
+	if err != nil {
+		t.Fatal("hub should be created:", err)
+	}
+
+	post, err := s.CreatePost(ctx, "title", "content", user.ID, []uint{hub.ID})
+	if err != nil {
+		t.Fatal("post should be created:", err)
+	}
+	if _, err := s.UpdatePost(ctx, post.ID, user.ID, "new title", "new content"); err != nil {
+		t.Fatal("post should be updated:", err)
+	}
+
+	// The first comment has ID 0, which a reply must still point at.
+	comment, err := s.CreateComment(ctx, "comment", user.ID, post.ID, nil)
+	if err != nil {
+		t.Fatal("comment should be created:", err)
+	}
+	reply, err := s.CreateComment(ctx, "reply", user.ID, post.ID, &comment.ID)
+	if err != nil {
+		t.Fatal("reply should be created:", err)
+	}
+	if _, err := s.CreateComment(ctx, "nested", user.ID, post.ID, &reply.ID); err != nil {
+		t.Fatal("nested reply should be created:", err)
+	}
+	if _, err := s.UpdateComment(ctx, comment.ID, user.ID, "new comment"); err != nil {
+		t.Fatal("comment should be updated:", err)
+	}
+
+	// User 0 voting on post 0 and comment 0 is a record of zero IDs.
+	voter, err := s.CreateUser(ctx, "voter", "voter@example.com", "password")
+	if err != nil {
+		t.Fatal("user should be created:", err)
+	}
+	for _, vote := range []struct {
+		user, value int
+	}{{int(user.ID), 1}, {int(voter.ID), -1}, {int(voter.ID), 1}} {
+		if _, err := s.VotePost(ctx, post.ID, uint(vote.user), vote.value); err != nil {
+			t.Fatal("post should be voted on:", err)
+		}
+	}
+	for _, vote := range []struct {
+		user, value int
+	}{{int(user.ID), -1}, {int(user.ID), 0}, {int(voter.ID), 1}} {
+		if _, err := s.VoteComment(ctx, comment.ID, uint(vote.user), vote.value); err != nil {
+			t.Fatal("comment should be voted on:", err)
+		}
+	}
+
+	// User 0 unsubscribing from hub 0 is a record of zero IDs too.
+	for _, userId := range []uint{user.ID, voter.ID} {
+		if _, err := s.SubscribeHub(ctx, hub.ID, userId); err != nil {
+			t.Fatal("hub should be subscribed to:", err)
+		}
+	}
+	if _, err := s.UnsubscribeHub(ctx, hub.ID, user.ID); err != nil {
+		t.Fatal("hub should be unsubscribed from:", err)
+	}
+
+	if _, err := s.FollowUser(ctx, user.ID, voter.ID); err != nil {
+		t.Fatal("user should be followed:", err)
+	}
+	if _, err := s.FollowUser(ctx, voter.ID, user.ID); err != nil {
+		t.Fatal("user should be followed:", err)
+	}
+
+	if err := s.DeleteComment(ctx, reply.ID); err != nil {
+		t.Fatal("comment should be deleted:", err)
+	}
+	if _, err := s.ToggleComments(ctx, post.ID, user.ID); err != nil {
+		t.Fatal("comments should be toggled:", err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	for _, token := range []models.RefreshToken{
+		{Hash: "used", UserID: user.ID, Family: "a", ExpiresAt: expiresAt},
+		{Hash: "fresh", UserID: user.ID, Family: "b", ExpiresAt: expiresAt},
+		{Hash: "revoked", UserID: user.ID, Family: "c", ExpiresAt: expiresAt},
+	} {
+		if err := s.CreateRefreshToken(ctx, &token); err != nil {
+			t.Fatal("refresh token should be created:", err)
+		}
+	}
+	if _, err := s.UseRefreshToken(ctx, "used"); err != nil {
+		t.Fatal("refresh token should be used:", err)
+	}
+	if err := s.RevokeRefreshTokens(ctx, "c"); err != nil {
+		t.Fatal("refresh tokens should be revoked:", err)
+	}
+}
+
+// dump describes everything fill stored, except refresh tokens, which
+// can't be read without being used.
+func dump(t *testing.T, s *inmemory.Storage) string {
+	t.Helper()
+	ctx := context.Background()
+	page := models.Page{Limit: 100}
+	var b strings.Builder
+
+	users, _ := s.GetUsers(ctx, page)
+	for _, u := range users {
+		version, _ := s.GetSessionVersion(ctx, u.ID)
+		fmt.Fprintln(&b, "user", u.ID, u.Username, u.Email, u.Role, u.PostsIDs, u.FollowersCount, version)
+
+		followers, _ := s.GetFollowers(ctx, u.ID, page)
+		for _, f := range followers {
+			fmt.Fprintln(&b, "follower", u.ID, f.ID)
+		}
+		following, _ := s.GetFollowing(ctx, u.ID, page)
+		for _, f := range following {
+			fmt.Fprintln(&b, "following", u.ID, f.ID)
+		}
+		feed, _ := s.GetFeed(ctx, u.ID, page)
+		for _, p := range feed {
+			fmt.Fprintln(&b, "feed", u.ID, p.ID)
+		}
+	}
+
+	posts, _ := s.GetPosts(ctx, page)
+	for _, p := range posts {
+		fmt.Fprintln(&b, "post", p.ID, p.Title, p.Content, p.AuthorID, p.CommentsAvailable,
+			p.CreatedAt.UnixNano(), p.EditedAt != nil, p.DeletedAt != nil, p.CommentsIDs, p.Upvotes, p.Downvotes)
+		revisions, _ := s.GetPostRevisionsByPostIds(ctx, []uint{p.ID})
+		for _, r := range revisions {
+			fmt.Fprintln(&b, "post revision", r.ID, r.PostID, r.Title, r.Content, r.CreatedAt.UnixNano())
+		}
+	}
+
+	if hub, err := s.GetHubById(ctx, 0); err == nil {
+		fmt.Fprintln(&b, "hub", hub.ID, hub.Slug, hub.Title, hub.Description, hub.CreatedAt.UnixNano(), hub.SubscribersCount)
+	}
+	if hub, err := s.GetHubBySlug(ctx, "test"); err == nil {
+		fmt.Fprintln(&b, "hub by slug", hub.ID)
+	}
+	hubPosts, _ := s.GetPostsFromHub(ctx, 0, page)
+	for _, p := range hubPosts {
+		fmt.Fprintln(&b, "hub post", p.ID)
+	}
+
+	comments, _ := s.GetComments(ctx, page)
+	for _, c := range comments {
+		fmt.Fprintln(&b, "comment", c.ID, c.Content, c.AuthorID, c.PostID, c.ParentCommentID != nil,
+			c.CreatedAt.UnixNano(), c.EditedAt != nil, c.DeletedAt != nil, c.RepliesIDs, c.Upvotes, c.Downvotes)
+		if c.ParentCommentID != nil {
+			fmt.Fprintln(&b, "parent", *c.ParentCommentID)
+		}
+		revisions, _ := s.GetCommentRevisionsByCommentIds(ctx, []uint{c.ID})
+		for _, r := range revisions {
+			fmt.Fprintln(&b, "comment revision", r.ID, r.CommentID, r.Content, r.CreatedAt.UnixNano())
+		}
+	}
+
+	for _, u := range users {
+		postVotes, _ := s.GetPostVotes(ctx, u.ID, []uint{0})
+		for _, v := range postVotes {
+			fmt.Fprintln(&b, "post vote", v.TargetID, v.UserID, v.Value)
+		}
+		commentVotes, _ := s.GetCommentVotes(ctx, u.ID, []uint{0})
+		for _, v := range commentVotes {
+			fmt.Fprintln(&b, "comment vote", v.TargetID, v.UserID, v.Value)
+		}
+	}
+
+	tree, _ := s.GetCommentTree(ctx, models.TreeQuery{PostID: 0, MaxDepth: 10, Limit: 10})
+	for _, node := range tree.Nodes {
+		fmt.Fprintln(&b, "node", node.ID, node.Depth, node.ChildCount)
+	}
+
+	for _, order := range models.RankedOrders {
+		page := models.Page{Limit: 100, Order: order}
+		posts, _ := s.GetPosts(ctx, page)
+		for _, p := range posts {
+			fmt.Fprintln(&b, "ranked post", order, p.ID)
+		}
+		comments, _ := s.GetCommentsForPost(ctx, 0, page, true)
+		for _, c := range comments {
+			fmt.Fprintln(&b, "ranked comment", order, c.ID)
+		}
+		hubPosts, _ := s.GetPostsFromHub(ctx, 0, page)
+		for _, p := range hubPosts {
+			fmt.Fprintln(&b, "ranked hub post", order, p.ID)
+		}
+	}
+
+	return b.String()
+}
+
+// checkRefreshTokens checks tokens stored by fill.
+func checkRefreshTokens(t *testing.T, s *inmemory.Storage) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := s.UseRefreshToken(ctx, "used"); !errors.Is(err, server.ErrTokenReused) {
+		t.Error("used refresh token should stay used, got:", err)
+	}
+	if token, err := s.UseRefreshToken(ctx, "fresh"); err != nil || token.Family != "b" {
+		t.Error("fresh refresh token should be usable, got:", err)
+	}
+	if _, err := s.UseRefreshToken(ctx, "revoked"); !errors.Is(err, server.ErrInvalidToken) {
+		t.Error("revoked refresh token should stay revoked, got:", err)
+	}
+}
+
+func TestStorage_RestoreFromSnapshot(t *testing.T) {
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "storage.snapshot")
+
+			s := openStorage(t, path, format)
+			fill(t, s)
+			want := dump(t, s)
+			if err := s.Close(); err != nil {
+				t.Fatal("storage should be closed:", err)
+			}
+
+			if segments, _ := filepath.Glob(path + ".wal.*"); len(segments) != 1 {
+				t.Error("only the empty segment after the snapshot should be left, got:", segments)
+			}
+
+			restored := openStorage(t, path, format)
+			defer restored.Close()
+			if got := dump(t, restored); got != want {
+				t.Errorf("restored storage should be the same\ngot:\n%s\nwant:\n%s", got, want)
+			}
+			checkRefreshTokens(t, restored)
+
+			if user, err := restored.CreateUser(context.Background(), "other", "other@example.com", "password"); err != nil || user.ID != 2 {
+				t.Error("IDs should continue after restored ones")
+			}
+		})
+	}
+}
+
+func TestStorage_RestoreFromLog(t *testing.T) {
+	for _, format := range formats {
+		t.Run(format, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "storage.snapshot")
+			ctx := context.Background()
+
+			// The storage is never closed, as if the process crashed.
+			s := openStorage(t, path, format)
+			fill(t, s)
+			if err := s.Snapshot(); err != nil {
+				t.Fatal("snapshot should be taken:", err)
+			}
+			if _, err := s.CreatePost(ctx, "after", "snapshot", 0, nil); err != nil {
+				t.Fatal("post should be created:", err)
+			}
+			want := dump(t, s)
+
+			restored := openStorage(t, path, format)
+			defer restored.Close()
+			if got := dump(t, restored); got != want {
+				t.Errorf("restored storage should be the same\ngot:\n%s\nwant:\n%s", got, want)
+			}
+			checkRefreshTokens(t, restored)
+		})
+	}
+}
+
+func TestStorage_RestoreTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.snapshot")
+	ctx := context.Background()
+
+	s := openStorage(t, path, "json")
+	user, err := s.CreateUser(ctx, "test", "test@example.com", "password")
+	if err != nil {
+		t.Fatal("user should be created:", err)
+	}
+
+	segment, err := os.OpenFile(path+".wal.0", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal("log segment should exist:", err)
+	}
+	if _, err := segment.WriteString(`{"Post":{"ID":0,"Tit`); err != nil {
+		t.Fatal(err)
+	}
+	segment.Close()
+
+	restored := openStorage(t, path, "json")
+	defer restored.Close()
+	if _, err := restored.GetUserById(ctx, user.ID); err != nil {
+		t.Error("records before the torn one should be restored")
+	}
+	if _, err := restored.GetPostById(ctx, 0); !errors.Is(err, server.ErrPostNotFound) {
+		t.Error("torn record should be skipped")
+	}
+}
+
+func TestOpen_UnknownFormat(t *testing.T) {
+	if _, err := inmemory.Open(inmemory.Options{Path: filepath.Join(t.TempDir(), "s"), Format: "xml"}); err == nil {
+		t.Error("unknown format should be rejected")
+	}
+}
+
+func TestConformancePersistent(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		s := openStorage(t, filepath.Join(t.TempDir(), "storage.snapshot"), "gob")
+		t.Cleanup(func() {
+			if err := s.Close(); err != nil {
+				t.Error("storage should be closed:", err)
+			}
+		})
+		return s
+	})
+}
@@ -0,0 +1,183 @@
+package inmemory
+
+import (
+	"cmp"
+	"github.com/rmntim/ozon-task/internal/models"
+	"slices"
+	"time"
+)
+
+// rankKey places an item in a ranked order.
+type rankKey struct {
+	rank float64
+	id   uint64
+}
+
+// compareRankKeys sorts higher ranks first, and newer items first
+// among equal ranks.
+func compareRankKeys(a, b rankKey) int {
+	if c := cmp.Compare(b.rank, a.rank); c != 0 {
+		return c
+	}
+	return cmp.Compare(b.id, a.id)
+}
+
+type rankGroup struct {
+	order models.Order
+	group uint64
+}
+
+// rankIndex keeps items of every group sorted by every ranked order.
+// Ranks only change with votes, so an item is moved when it's voted on
+// rather than the group sorted on every read.
+type rankIndex map[rankGroup][]rankKey
+
+// ranker returns the rank of an item in a ranked order.
+type ranker func(order models.Order) float64
+
+func rankerOf(upvotes, downvotes int, createdAt time.Time) ranker {
+	return func(order models.Order) float64 {
+		return models.Rank(order, upvotes, downvotes, createdAt)
+	}
+}
+
+// insert places item id into group under every ranked order.
+func (ix rankIndex) insert(group, id uint64, rank ranker) {
+	for _, order := range models.RankedOrders {
+		g, key := rankGroup{order, group}, rankKey{rank(order), id}
+		i, _ := slices.BinarySearchFunc(ix[g], key, compareRankKeys)
+		ix[g] = slices.Insert(ix[g], i, key)
+	}
+}
+
+// remove takes item id out of group, old being the ranker it was
+// placed with.
+func (ix rankIndex) remove(group, id uint64, old ranker) {
+	for _, order := range models.RankedOrders {
+		g := rankGroup{order, group}
+		if i, found := slices.BinarySearchFunc(ix[g], rankKey{old(order), id}, compareRankKeys); found {
+			ix[g] = slices.Delete(ix[g], i, i+1)
+		}
+	}
+}
+
+// move places item id of group by rank instead of old.
+func (ix rankIndex) move(group, id uint64, old, rank ranker) {
+	ix.remove(group, id, old)
+	ix.insert(group, id, rank)
+}
+
+// ranks are the rank indexes of posts and comments.
+type ranks struct {
+	// posts are all in group 0, and also grouped by hub in hubs.
+	posts rankIndex
+	hubs  rankIndex
+	// comments are grouped by post, and replies by parent comment.
+	comments rankIndex
+	replies  rankIndex
+}
+
+func newRanks() *ranks {
+	return &ranks{
+		posts:    make(rankIndex),
+		hubs:     make(rankIndex),
+		comments: make(rankIndex),
+		replies:  make(rankIndex),
+	}
+}
+
+// buildRanks indexes everything stored at once, which is faster than
+// moving items one by one while the storage is loaded.
+// s.mu must be held for writing.
+func (s *Storage) buildRanks() {
+	r := newRanks()
+	for _, id := range s.postIds {
+		post, rank := s.posts[id], s.ranker(votePost, id)
+		for _, order := range models.RankedOrders {
+			key := rankKey{rank(order), id}
+			g := rankGroup{order, 0}
+			r.posts[g] = append(r.posts[g], key)
+			for _, hubId := range post.hubIds {
+				g := rankGroup{order, hubId}
+				r.hubs[g] = append(r.hubs[g], key)
+			}
+		}
+	}
+	for _, id := range s.commentIds {
+		comment, rank := s.comments[id], s.ranker(voteComment, id)
+		for _, order := range models.RankedOrders {
+			key := rankKey{rank(order), id}
+			g := rankGroup{order, comment.postId}
+			r.comments[g] = append(r.comments[g], key)
+			if comment.parentCommentId != nil {
+				g := rankGroup{order, uint64(*comment.parentCommentId)}
+				r.replies[g] = append(r.replies[g], key)
+			}
+		}
+	}
+	for _, ix := range []rankIndex{r.posts, r.hubs, r.comments, r.replies} {
+		for _, keys := range ix {
+			slices.SortFunc(keys, compareRankKeys)
+		}
+	}
+	s.ranks = r
+}
+
+// ranker returns the ranker of a stored post or comment, depending on
+// kind, with its current votes. s.mu must be held.
+func (s *Storage) ranker(kind string, id uint64) ranker {
+	if kind == voteComment {
+		upvotes, downvotes := s.commentVotes[id].counts()
+		return rankerOf(upvotes, downvotes, s.comments[id].createdAt)
+	}
+	upvotes, downvotes := s.postVotes[id].counts()
+	return rankerOf(upvotes, downvotes, s.posts[id].createdAt)
+}
+
+// rankKey returns the place of a post or comment, depending on kind, in
+// a ranked order, or false if there's no such item. s.mu must be held.
+func (s *Storage) rankKey(kind string, id uint64, order models.Order) (rankKey, bool) {
+	if kind == voteComment {
+		if _, ok := s.comments[id]; !ok {
+			return rankKey{}, false
+		}
+	} else if _, ok := s.posts[id]; !ok {
+		return rankKey{}, false
+	}
+	return rankKey{s.ranker(kind, id)(order), id}, true
+}
+
+// rerank moves a post or comment, depending on kind, in rank indexes
+// after its votes change. old is its ranker before the change.
+// s.mu must be held for writing.
+func (s *Storage) rerank(kind string, id uint64, old ranker) {
+	if s.ranks == nil {
+		return
+	}
+
+	rank := s.ranker(kind, id)
+	if kind == votePost {
+		s.ranks.posts.move(0, id, old, rank)
+		for _, hubId := range s.posts[id].hubIds {
+			s.ranks.hubs.move(hubId, id, old, rank)
+		}
+		return
+	}
+	comment := s.comments[id]
+	s.ranks.comments.move(comment.postId, id, old, rank)
+	if comment.parentCommentId != nil {
+		s.ranks.replies.move(uint64(*comment.parentCommentId), id, old, rank)
+	}
+}
+
+// orderedPage cuts out page from the group of posts or comments,
+// depending on kind, that is listed by ID in ids and by rank in ranked.
+// keep may be nil. s.mu must be held.
+func (s *Storage) orderedPage(kind string, ids []uint64, ranked rankIndex, group uint64, page models.Page, keep func(id uint64) bool) []uint64 {
+	if !page.Order.Ranked() {
+		return paginate(ids, page, keep)
+	}
+	return paginateRanked(ranked[rankGroup{page.Order, group}], page, func(id uint64) (rankKey, bool) {
+		return s.rankKey(kind, id, page.Order)
+	}, keep)
+}
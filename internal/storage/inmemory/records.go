@@ -0,0 +1,293 @@
+package inmemory
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"github.com/rmntim/ozon-task/internal/models"
+	"io"
+	"time"
+)
+
+const (
+	formatGob  = "gob"
+	formatJSON = "json"
+)
+
+// Kinds of vote targets.
+const (
+	votePost    = "post"
+	voteComment = "comment"
+)
+
+// Kinds of subscription targets.
+const (
+	subscriptionHub  = "hub"
+	subscriptionUser = "user"
+)
+
+// record is a single change in the write-ahead log. Records hold whole
+// objects rather than operations, so replaying them doesn't depend on
+// anything but the order they were logged in.
+type record struct {
+	User            *userRecord         `json:",omitempty"`
+	Hub             *hubRecord          `json:",omitempty"`
+	Post            *postRecord         `json:",omitempty"`
+	PostRevision    *postRevision       `json:",omitempty"`
+	Comment         *commentRecord      `json:",omitempty"`
+	CommentRevision *commentRevision    `json:",omitempty"`
+	RefreshToken    *refreshTokenRecord `json:",omitempty"`
+	RevokedFamily   string              `json:",omitempty"`
+	Vote            *voteRecord         `json:",omitempty"`
+	Subscription    *subscriptionRecord `json:",omitempty"`
+}
+
+// snapshot is the whole storage. Objects are listed in the order they
+// were created, so that they can be stored one by one.
+type snapshot struct {
+	// Segment is the first write-ahead log segment not included.
+	Segment          uint64
+	Users            []userRecord
+	Hubs             []hubRecord
+	Posts            []postRecord
+	PostRevisions    []postRevision
+	Comments         []commentRecord
+	CommentRevisions []commentRevision
+	Votes            []voteRecord
+	Subscriptions    []subscriptionRecord
+	RefreshTokens    []refreshTokenRecord
+}
+
+type userRecord struct {
+	ID             uint64
+	Username       string
+	Email          string
+	Role           models.Role
+	PasswordHash   []byte
+	SessionVersion uint64
+}
+
+type hubRecord struct {
+	ID          uint64
+	Slug        string
+	Title       string
+	Description string
+	CreatedAt   time.Time
+}
+
+type postRecord struct {
+	ID                uint64
+	Title             string
+	Content           string
+	CreatedAt         time.Time
+	AuthorID          uint64
+	CommentsAvailable bool
+	EditedAt          *time.Time
+	DeletedAt         *time.Time
+	HubIDs            []uint64
+}
+
+type commentRecord struct {
+	ID        uint64
+	Content   string
+	AuthorID  uint64
+	CreatedAt time.Time
+	PostID    uint64
+	// Gob flattens pointers and skips zero values, so a pointer to
+	// parent 0 would come back as nil.
+	IsReply         bool
+	ParentCommentID uint
+	EditedAt        *time.Time
+	DeletedAt       *time.Time
+}
+
+// postRevision and commentRevision mirror the models, which hide IDs of
+// the post and the comment from JSON.
+type postRevision struct {
+	ID        uint
+	PostID    uint
+	Title     string
+	Content   string
+	CreatedAt time.Time
+}
+
+type commentRevision struct {
+	ID        uint
+	CommentID uint
+	Content   string
+	CreatedAt time.Time
+}
+
+// voteRecord is a vote on a post or a comment, depending on Kind. Value
+// 0 retracts the vote. Kind is never empty, so gob doesn't drop a vote
+// of user 0 on target 0.
+type voteRecord struct {
+	Kind     string
+	TargetID uint64
+	UserID   uint64
+	Value    int
+}
+
+// subscriptionRecord subscribes a user to a target, a hub or another
+// user to follow depending on Kind, or unsubscribes them if Subscribed
+// is false. Kind is never empty, for the same reason as in voteRecord.
+type subscriptionRecord struct {
+	Kind       string
+	TargetID   uint64
+	UserID     uint64
+	Subscribed bool
+}
+
+type refreshTokenRecord struct {
+	Token models.RefreshToken
+	Used  bool
+}
+
+func (u *User) record() *userRecord {
+	return &userRecord{
+		ID:             u.id,
+		Username:       u.username,
+		Email:          u.email,
+		Role:           u.role,
+		PasswordHash:   u.passwordHash,
+		SessionVersion: u.sessionVersion,
+	}
+}
+
+func (r *userRecord) user() *User {
+	return &User{
+		id:             r.ID,
+		username:       r.Username,
+		email:          r.Email,
+		role:           r.Role,
+		passwordHash:   r.PasswordHash,
+		sessionVersion: r.SessionVersion,
+	}
+}
+
+func (h *Hub) record() *hubRecord {
+	return &hubRecord{
+		ID:          h.id,
+		Slug:        h.slug,
+		Title:       h.title,
+		Description: h.description,
+		CreatedAt:   h.createdAt,
+	}
+}
+
+func (r *hubRecord) hub() *Hub {
+	return &Hub{
+		id:          r.ID,
+		slug:        r.Slug,
+		title:       r.Title,
+		description: r.Description,
+		createdAt:   r.CreatedAt,
+	}
+}
+
+func (p *Post) record() *postRecord {
+	return &postRecord{
+		ID:                p.id,
+		Title:             p.title,
+		Content:           p.content,
+		CreatedAt:         p.createdAt,
+		AuthorID:          p.authorId,
+		CommentsAvailable: p.commentsAvailable,
+		EditedAt:          p.editedAt,
+		DeletedAt:         p.deletedAt,
+		HubIDs:            p.hubIds,
+	}
+}
+
+func (r *postRecord) post() *Post {
+	return &Post{
+		id:                r.ID,
+		title:             r.Title,
+		content:           r.Content,
+		createdAt:         r.CreatedAt,
+		authorId:          r.AuthorID,
+		commentsAvailable: r.CommentsAvailable,
+		editedAt:          r.EditedAt,
+		deletedAt:         r.DeletedAt,
+		hubIds:            r.HubIDs,
+	}
+}
+
+func (c *Comment) record() *commentRecord {
+	r := &commentRecord{
+		ID:        c.id,
+		Content:   c.content,
+		AuthorID:  c.authorId,
+		CreatedAt: c.createdAt,
+		PostID:    c.postId,
+		EditedAt:  c.editedAt,
+		DeletedAt: c.deletedAt,
+	}
+	if c.parentCommentId != nil {
+		r.IsReply = true
+		r.ParentCommentID = *c.parentCommentId
+	}
+	return r
+}
+
+func (r *commentRecord) comment() *Comment {
+	c := &Comment{
+		id:        r.ID,
+		content:   r.Content,
+		authorId:  r.AuthorID,
+		createdAt: r.CreatedAt,
+		postId:    r.PostID,
+		editedAt:  r.EditedAt,
+		deletedAt: r.DeletedAt,
+	}
+	if r.IsReply {
+		parentId := r.ParentCommentID
+		c.parentCommentId = &parentId
+	}
+	return c
+}
+
+func postRevisionRecord(r *models.PostRevision) *postRevision {
+	return &postRevision{ID: r.ID, PostID: r.PostID, Title: r.Title, Content: r.Content, CreatedAt: r.CreatedAt}
+}
+
+func (r *postRevision) revision() *models.PostRevision {
+	return &models.PostRevision{ID: r.ID, PostID: r.PostID, Title: r.Title, Content: r.Content, CreatedAt: r.CreatedAt}
+}
+
+func commentRevisionRecord(r *models.CommentRevision) *commentRevision {
+	return &commentRevision{ID: r.ID, CommentID: r.CommentID, Content: r.Content, CreatedAt: r.CreatedAt}
+}
+
+func (r *commentRevision) revision() *models.CommentRevision {
+	return &models.CommentRevision{ID: r.ID, CommentID: r.CommentID, Content: r.Content, CreatedAt: r.CreatedAt}
+}
+
+func (t *RefreshToken) record() *refreshTokenRecord {
+	return &refreshTokenRecord{Token: t.token, Used: t.used}
+}
+
+func (r *refreshTokenRecord) refreshToken() *RefreshToken {
+	return &RefreshToken{token: r.Token, used: r.Used}
+}
+
+type encoder interface {
+	Encode(v any) error
+}
+
+type decoder interface {
+	Decode(v any) error
+}
+
+func newEncoder(format string, w io.Writer) encoder {
+	if format == formatJSON {
+		return json.NewEncoder(w)
+	}
+	return gob.NewEncoder(w)
+}
+
+func newDecoder(format string, r io.Reader) decoder {
+	if format == formatJSON {
+		return json.NewDecoder(r)
+	}
+	return gob.NewDecoder(r)
+}
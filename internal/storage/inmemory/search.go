@@ -0,0 +1,287 @@
+package inmemory
+
+import (
+	"cmp"
+	"context"
+	"github.com/rmntim/ozon-task/internal/lib/validation"
+	"github.com/rmntim/ozon-task/internal/models"
+	"math"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+const (
+	// bm25K1 and bm25B are the usual BM25 parameters: how fast repeated
+	// words stop adding to the rank, and how much long texts are damped.
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// titleWeight is how many times a word of a post title counts.
+	titleWeight = 2
+	// A snippet is snippetWords words starting snippetLead words
+	// before the first match.
+	snippetWords = 20
+	snippetLead  = 5
+)
+
+// token is a normalized word found at text[start:end].
+type token struct {
+	word       string
+	start, end int
+}
+
+// tokenize splits text into words, which are runs of letters and digits.
+func tokenize(text string) []token {
+	tokens := make([]token, 0)
+	start := -1
+	for i, r := range text {
+		inWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			tokens = append(tokens, token{normalize(text[start:i]), start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{normalize(text[start:]), start, len(text)})
+	}
+	return tokens
+}
+
+// normalize lowercases a word and spells ё as е, as Russian texts
+// use them interchangeably.
+func normalize(word string) string {
+	return strings.ReplaceAll(strings.ToLower(word), "ё", "е")
+}
+
+type docKey struct {
+	kind models.SearchType
+	id   uint64
+}
+
+// searchIndex is an inverted index from words to the documents they
+// occur in. There is no stemming, so only exact words match.
+type searchIndex struct {
+	// postings are the weighted number of occurrences of a word in
+	// every document containing it.
+	postings map[string]map[docKey]int
+	// docs are the indexed documents, whose words are needed to remove them.
+	docs        map[docKey]*indexedDoc
+	totalLength int
+}
+
+type indexedDoc struct {
+	counts map[string]int
+	// length is the weighted number of words.
+	length int
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[docKey]int),
+		docs:     make(map[docKey]*indexedDoc),
+	}
+}
+
+// put indexes the document, replacing its previous version. Words of
+// title count titleWeight times.
+func (ix *searchIndex) put(doc docKey, title, body string) {
+	ix.remove(doc)
+
+	indexed := &indexedDoc{counts: make(map[string]int)}
+	for _, t := range tokenize(title) {
+		indexed.counts[t.word] += titleWeight
+		indexed.length += titleWeight
+	}
+	for _, t := range tokenize(body) {
+		indexed.counts[t.word]++
+		indexed.length++
+	}
+	if indexed.length == 0 {
+		return
+	}
+
+	ix.docs[doc] = indexed
+	ix.totalLength += indexed.length
+	for word, n := range indexed.counts {
+		if ix.postings[word] == nil {
+			ix.postings[word] = make(map[docKey]int)
+		}
+		ix.postings[word][doc] = n
+	}
+}
+
+func (ix *searchIndex) remove(doc docKey) {
+	indexed, ok := ix.docs[doc]
+	if !ok {
+		return
+	}
+	for word := range indexed.counts {
+		delete(ix.postings[word], doc)
+		if len(ix.postings[word]) == 0 {
+			delete(ix.postings, word)
+		}
+	}
+	ix.totalLength -= indexed.length
+	delete(ix.docs, doc)
+}
+
+type scoredDoc struct {
+	doc  docKey
+	rank float64
+}
+
+// match returns documents containing every word and accepted by include,
+// ranked with BM25.
+func (ix *searchIndex) match(words []string, include func(doc docKey) bool) []scoredDoc {
+	if len(words) == 0 {
+		return nil
+	}
+	// Candidates come from the rarest word, so that as few documents as
+	// possible are checked for the other ones.
+	rarest := slices.MinFunc(words, func(a, b string) int {
+		return cmp.Compare(len(ix.postings[a]), len(ix.postings[b]))
+	})
+
+	n := float64(len(ix.docs))
+	avgLength := float64(ix.totalLength) / n
+	matches := make([]scoredDoc, 0)
+candidates:
+	for doc := range ix.postings[rarest] {
+		if !include(doc) {
+			continue
+		}
+		norm := 1 - bm25B + bm25B*float64(ix.docs[doc].length)/avgLength
+
+		rank := 0.0
+		for _, word := range words {
+			tf := float64(ix.postings[word][doc])
+			if tf == 0 {
+				continue candidates
+			}
+			df := float64(len(ix.postings[word]))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			rank += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+		matches = append(matches, scoredDoc{doc, rank})
+	}
+	return matches
+}
+
+// queryWords returns the distinct words of a search query.
+func queryWords(query string) []string {
+	words := make([]string, 0)
+	for _, t := range tokenize(query) {
+		if !slices.Contains(words, t.word) {
+			words = append(words, t.word)
+		}
+	}
+	return words
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// snippet cuts out the words of text around the first of words, and
+// wraps every one of words in <b> tags.
+func snippet(text string, words []string) string {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	first := slices.IndexFunc(tokens, func(t token) bool { return slices.Contains(words, t.word) })
+	from := max(0, first-snippetLead)
+	to := min(len(tokens), from+snippetWords)
+
+	// Text before the first word and after the last one is only kept
+	// when the snippet starts or ends with the text.
+	var b strings.Builder
+	prev := 0
+	if from > 0 {
+		prev = tokens[from].start
+	}
+	for _, t := range tokens[from:to] {
+		b.WriteString(htmlEscaper.Replace(text[prev:t.start]))
+		if slices.Contains(words, t.word) {
+			b.WriteString("<b>" + htmlEscaper.Replace(text[t.start:t.end]) + "</b>")
+		} else {
+			b.WriteString(htmlEscaper.Replace(text[t.start:t.end]))
+		}
+		prev = t.end
+	}
+	if to == len(tokens) {
+		b.WriteString(htmlEscaper.Replace(text[prev:]))
+	}
+	return b.String()
+}
+
+// Search finds posts, comments and users containing every word of the
+// query, best matches first. Deleted posts and comments aren't indexed.
+func (s *Storage) Search(ctx context.Context, query models.SearchQuery) ([]*models.SearchHit, error) {
+	if errs := validation.Search(query.Text); errs != nil {
+		return nil, errs
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	words := queryWords(query.Text)
+	matches := s.search.match(words, func(doc docKey) bool { return query.Includes(doc.kind) })
+	slices.SortFunc(matches, func(a, b scoredDoc) int {
+		if c := cmp.Compare(b.rank, a.rank); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.doc.kind, b.doc.kind); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.doc.id, b.doc.id)
+	})
+	matches = matches[min(query.Offset, len(matches)):min(query.Offset+query.Limit, len(matches))]
+
+	hits := make([]*models.SearchHit, len(matches))
+	for i, m := range matches {
+		hits[i] = &models.SearchHit{
+			Type:    m.doc.kind,
+			ID:      uint(m.doc.id),
+			Rank:    m.rank,
+			Snippet: snippet(s.searchText(m.doc), words),
+		}
+	}
+	return hits, nil
+}
+
+// searchText returns the text of an indexed document. s.mu must be held.
+func (s *Storage) searchText(doc docKey) string {
+	switch doc.kind {
+	case models.SearchPost:
+		post := s.posts[doc.id]
+		return post.title + " " + post.content
+	case models.SearchComment:
+		return s.comments[doc.id].content
+	}
+	return s.users[doc.id].username
+}
+
+// indexPost indexes the post, or removes it from the search index if
+// it's deleted. s.mu must be held for writing.
+func (s *Storage) indexPost(post *Post) {
+	doc := docKey{models.SearchPost, post.id}
+	if post.deletedAt != nil {
+		s.search.remove(doc)
+		return
+	}
+	s.search.put(doc, post.title, post.content)
+}
+
+// indexComment indexes the comment, or removes it from the search index
+// if it's deleted. s.mu must be held for writing.
+func (s *Storage) indexComment(comment *Comment) {
+	doc := docKey{models.SearchComment, comment.id}
+	if comment.deletedAt != nil {
+		s.search.remove(doc)
+		return
+	}
+	s.search.put(doc, "", comment.content)
+}
@@ -0,0 +1,137 @@
+package inmemory
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// wal is the write-ahead log. It's split into numbered segments, so that
+// segments covered by a snapshot can be removed while changes go on.
+type wal struct {
+	mu      sync.Mutex
+	path    string
+	format  string
+	segment uint64
+	// syncEach fsyncs every record instead of leaving it to sync.
+	syncEach bool
+
+	file *os.File
+	buf  *bufio.Writer
+	enc  encoder
+}
+
+func openWAL(path, format string, segment uint64, syncEach bool) (*wal, error) {
+	w := &wal{path: path, format: format, syncEach: syncEach}
+	if err := w.open(segment); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open starts a new segment. w.mu must be held, unless w isn't shared yet.
+func (w *wal) open(segment uint64) error {
+	file, err := os.OpenFile(walSegmentPath(w.path, segment), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(w.path)); err != nil {
+		file.Close()
+		return err
+	}
+
+	w.segment = segment
+	w.file = file
+	w.buf = bufio.NewWriter(file)
+	// Gob streams carry type information once, so every segment
+	// needs its own encoder to be decodable on its own.
+	w.enc = newEncoder(w.format, w.buf)
+	return nil
+}
+
+// append writes the record through to the file, so that only a crash of
+// the machine, not of the process, can lose it before the next sync.
+func (w *wal) append(rec record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.enc.Encode(rec); err != nil {
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if w.syncEach {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+func (w *wal) sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Sync()
+}
+
+// rotate closes the current segment and starts the next one,
+// returning its number.
+func (w *wal) rotate() (uint64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.closeSegment(); err != nil {
+		return 0, err
+	}
+	if err := w.open(w.segment + 1); err != nil {
+		return 0, err
+	}
+	return w.segment, nil
+}
+
+func (w *wal) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.closeSegment()
+}
+
+// w.mu must be held.
+func (w *wal) closeSegment() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+func walSegmentPath(path string, segment uint64) string {
+	return fmt.Sprintf("%s.wal.%d", path, segment)
+}
+
+// walSegments returns numbers of existing segments in ascending order.
+func walSegments(path string) ([]uint64, error) {
+	matches, err := filepath.Glob(path + ".wal.*")
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]uint64, 0, len(matches))
+	for _, match := range matches {
+		n, err := strconv.ParseUint(strings.TrimPrefix(match, path+".wal."), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, n)
+	}
+	slices.Sort(segments)
+
+	return segments, nil
+}
@@ -0,0 +1,396 @@
+package instrumented
+
+import (
+	"context"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"time"
+)
+
+// Observer records a call of a storage method, see metrics.Metrics.
+type Observer interface {
+	ObserveStorage(method string, start time.Time, err error)
+}
+
+// Storage times every call of the wrapped storage.
+type Storage struct {
+	db       storage.Storage
+	observer Observer
+}
+
+var _ storage.Storage = &Storage{}
+
+func New(db storage.Storage, observer Observer) *Storage {
+	return &Storage{db: db, observer: observer}
+}
+
+func (s *Storage) CreateUser(ctx context.Context, username string, email string, password string) (*models.User, error) {
+	start := time.Now()
+	res, err := s.db.CreateUser(ctx, username, email, password)
+	s.observer.ObserveStorage("CreateUser", start, err)
+	return res, err
+}
+
+func (s *Storage) CreatePost(ctx context.Context, title string, content string, authorId uint, hubIds []uint) (*models.Post, error) {
+	start := time.Now()
+	res, err := s.db.CreatePost(ctx, title, content, authorId, hubIds)
+	s.observer.ObserveStorage("CreatePost", start, err)
+	return res, err
+}
+
+func (s *Storage) CreateComment(ctx context.Context, content string, authorId uint, postId uint, parentCommentId *uint) (*models.Comment, error) {
+	start := time.Now()
+	res, err := s.db.CreateComment(ctx, content, authorId, postId, parentCommentId)
+	s.observer.ObserveStorage("CreateComment", start, err)
+	return res, err
+}
+
+func (s *Storage) GetUserById(ctx context.Context, id uint) (*models.User, error) {
+	start := time.Now()
+	res, err := s.db.GetUserById(ctx, id)
+	s.observer.ObserveStorage("GetUserById", start, err)
+	return res, err
+}
+
+func (s *Storage) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	start := time.Now()
+	res, err := s.db.GetUserByUsername(ctx, username)
+	s.observer.ObserveStorage("GetUserByUsername", start, err)
+	return res, err
+}
+
+func (s *Storage) SetUserRole(ctx context.Context, userId uint, role models.Role) error {
+	start := time.Now()
+	err := s.db.SetUserRole(ctx, userId, role)
+	s.observer.ObserveStorage("SetUserRole", start, err)
+	return err
+}
+
+func (s *Storage) GetUsers(ctx context.Context, page models.Page) ([]*models.User, error) {
+	start := time.Now()
+	res, err := s.db.GetUsers(ctx, page)
+	s.observer.ObserveStorage("GetUsers", start, err)
+	return res, err
+}
+
+func (s *Storage) GetPostById(ctx context.Context, id uint) (*models.Post, error) {
+	start := time.Now()
+	res, err := s.db.GetPostById(ctx, id)
+	s.observer.ObserveStorage("GetPostById", start, err)
+	return res, err
+}
+
+func (s *Storage) GetPosts(ctx context.Context, page models.Page) ([]*models.Post, error) {
+	start := time.Now()
+	res, err := s.db.GetPosts(ctx, page)
+	s.observer.ObserveStorage("GetPosts", start, err)
+	return res, err
+}
+
+func (s *Storage) GetCommentById(ctx context.Context, id uint) (*models.Comment, error) {
+	start := time.Now()
+	res, err := s.db.GetCommentById(ctx, id)
+	s.observer.ObserveStorage("GetCommentById", start, err)
+	return res, err
+}
+
+func (s *Storage) GetComments(ctx context.Context, page models.Page) ([]*models.Comment, error) {
+	start := time.Now()
+	res, err := s.db.GetComments(ctx, page)
+	s.observer.ObserveStorage("GetComments", start, err)
+	return res, err
+}
+
+func (s *Storage) ToggleComments(ctx context.Context, postId uint, userId uint) (bool, error) {
+	start := time.Now()
+	res, err := s.db.ToggleComments(ctx, postId, userId)
+	s.observer.ObserveStorage("ToggleComments", start, err)
+	return res, err
+}
+
+func (s *Storage) UpdatePost(ctx context.Context, id uint, userId uint, title string, content string) (*models.Post, error) {
+	start := time.Now()
+	res, err := s.db.UpdatePost(ctx, id, userId, title, content)
+	s.observer.ObserveStorage("UpdatePost", start, err)
+	return res, err
+}
+
+func (s *Storage) UpdateComment(ctx context.Context, id uint, userId uint, content string) (*models.Comment, error) {
+	start := time.Now()
+	res, err := s.db.UpdateComment(ctx, id, userId, content)
+	s.observer.ObserveStorage("UpdateComment", start, err)
+	return res, err
+}
+
+func (s *Storage) DeletePost(ctx context.Context, id uint) error {
+	start := time.Now()
+	err := s.db.DeletePost(ctx, id)
+	s.observer.ObserveStorage("DeletePost", start, err)
+	return err
+}
+
+func (s *Storage) DeleteComment(ctx context.Context, id uint) error {
+	start := time.Now()
+	err := s.db.DeleteComment(ctx, id)
+	s.observer.ObserveStorage("DeleteComment", start, err)
+	return err
+}
+
+func (s *Storage) VotePost(ctx context.Context, postId uint, userId uint, value int) (*models.Post, error) {
+	start := time.Now()
+	res, err := s.db.VotePost(ctx, postId, userId, value)
+	s.observer.ObserveStorage("VotePost", start, err)
+	return res, err
+}
+
+func (s *Storage) VoteComment(ctx context.Context, commentId uint, userId uint, value int) (*models.Comment, error) {
+	start := time.Now()
+	res, err := s.db.VoteComment(ctx, commentId, userId, value)
+	s.observer.ObserveStorage("VoteComment", start, err)
+	return res, err
+}
+
+func (s *Storage) GetPostVotes(ctx context.Context, userId uint, postIds []uint) ([]*models.Vote, error) {
+	start := time.Now()
+	res, err := s.db.GetPostVotes(ctx, userId, postIds)
+	s.observer.ObserveStorage("GetPostVotes", start, err)
+	return res, err
+}
+
+func (s *Storage) GetCommentVotes(ctx context.Context, userId uint, commentIds []uint) ([]*models.Vote, error) {
+	start := time.Now()
+	res, err := s.db.GetCommentVotes(ctx, userId, commentIds)
+	s.observer.ObserveStorage("GetCommentVotes", start, err)
+	return res, err
+}
+
+func (s *Storage) GetPostsFromUser(ctx context.Context, userId uint, page models.Page) ([]*models.Post, error) {
+	start := time.Now()
+	res, err := s.db.GetPostsFromUser(ctx, userId, page)
+	s.observer.ObserveStorage("GetPostsFromUser", start, err)
+	return res, err
+}
+
+func (s *Storage) GetReplies(ctx context.Context, commentId uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	start := time.Now()
+	res, err := s.db.GetReplies(ctx, commentId, page, includeDeleted)
+	s.observer.ObserveStorage("GetReplies", start, err)
+	return res, err
+}
+
+func (s *Storage) GetCommentsForPost(ctx context.Context, postId uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	start := time.Now()
+	res, err := s.db.GetCommentsForPost(ctx, postId, page, includeDeleted)
+	s.observer.ObserveStorage("GetCommentsForPost", start, err)
+	return res, err
+}
+
+func (s *Storage) GetUsersByIds(ctx context.Context, ids []uint) ([]*models.User, error) {
+	start := time.Now()
+	res, err := s.db.GetUsersByIds(ctx, ids)
+	s.observer.ObserveStorage("GetUsersByIds", start, err)
+	return res, err
+}
+
+func (s *Storage) GetPostsByIds(ctx context.Context, ids []uint) ([]*models.Post, error) {
+	start := time.Now()
+	res, err := s.db.GetPostsByIds(ctx, ids)
+	s.observer.ObserveStorage("GetPostsByIds", start, err)
+	return res, err
+}
+
+func (s *Storage) GetCommentsByIds(ctx context.Context, ids []uint) ([]*models.Comment, error) {
+	start := time.Now()
+	res, err := s.db.GetCommentsByIds(ctx, ids)
+	s.observer.ObserveStorage("GetCommentsByIds", start, err)
+	return res, err
+}
+
+func (s *Storage) GetPostsByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Post, error) {
+	start := time.Now()
+	res, err := s.db.GetPostsByUserIds(ctx, userIds, page)
+	s.observer.ObserveStorage("GetPostsByUserIds", start, err)
+	return res, err
+}
+
+func (s *Storage) GetCommentsByPostIds(ctx context.Context, postIds []uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	start := time.Now()
+	res, err := s.db.GetCommentsByPostIds(ctx, postIds, page, includeDeleted)
+	s.observer.ObserveStorage("GetCommentsByPostIds", start, err)
+	return res, err
+}
+
+func (s *Storage) GetRepliesByCommentIds(ctx context.Context, commentIds []uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	start := time.Now()
+	res, err := s.db.GetRepliesByCommentIds(ctx, commentIds, page, includeDeleted)
+	s.observer.ObserveStorage("GetRepliesByCommentIds", start, err)
+	return res, err
+}
+
+func (s *Storage) CreateHub(ctx context.Context, slug string, title string, description string) (*models.Hub, error) {
+	start := time.Now()
+	res, err := s.db.CreateHub(ctx, slug, title, description)
+	s.observer.ObserveStorage("CreateHub", start, err)
+	return res, err
+}
+
+func (s *Storage) GetHubById(ctx context.Context, id uint) (*models.Hub, error) {
+	start := time.Now()
+	res, err := s.db.GetHubById(ctx, id)
+	s.observer.ObserveStorage("GetHubById", start, err)
+	return res, err
+}
+
+func (s *Storage) GetHubBySlug(ctx context.Context, slug string) (*models.Hub, error) {
+	start := time.Now()
+	res, err := s.db.GetHubBySlug(ctx, slug)
+	s.observer.ObserveStorage("GetHubBySlug", start, err)
+	return res, err
+}
+
+func (s *Storage) SubscribeHub(ctx context.Context, hubId uint, userId uint) (*models.Hub, error) {
+	start := time.Now()
+	res, err := s.db.SubscribeHub(ctx, hubId, userId)
+	s.observer.ObserveStorage("SubscribeHub", start, err)
+	return res, err
+}
+
+func (s *Storage) UnsubscribeHub(ctx context.Context, hubId uint, userId uint) (*models.Hub, error) {
+	start := time.Now()
+	res, err := s.db.UnsubscribeHub(ctx, hubId, userId)
+	s.observer.ObserveStorage("UnsubscribeHub", start, err)
+	return res, err
+}
+
+func (s *Storage) GetPostsFromHub(ctx context.Context, hubId uint, page models.Page) ([]*models.Post, error) {
+	start := time.Now()
+	res, err := s.db.GetPostsFromHub(ctx, hubId, page)
+	s.observer.ObserveStorage("GetPostsFromHub", start, err)
+	return res, err
+}
+
+func (s *Storage) FollowUser(ctx context.Context, userId uint, followerId uint) (*models.User, error) {
+	start := time.Now()
+	res, err := s.db.FollowUser(ctx, userId, followerId)
+	s.observer.ObserveStorage("FollowUser", start, err)
+	return res, err
+}
+
+func (s *Storage) UnfollowUser(ctx context.Context, userId uint, followerId uint) (*models.User, error) {
+	start := time.Now()
+	res, err := s.db.UnfollowUser(ctx, userId, followerId)
+	s.observer.ObserveStorage("UnfollowUser", start, err)
+	return res, err
+}
+
+func (s *Storage) GetFollowers(ctx context.Context, userId uint, page models.Page) ([]*models.User, error) {
+	start := time.Now()
+	res, err := s.db.GetFollowers(ctx, userId, page)
+	s.observer.ObserveStorage("GetFollowers", start, err)
+	return res, err
+}
+
+func (s *Storage) GetFollowing(ctx context.Context, userId uint, page models.Page) ([]*models.User, error) {
+	start := time.Now()
+	res, err := s.db.GetFollowing(ctx, userId, page)
+	s.observer.ObserveStorage("GetFollowing", start, err)
+	return res, err
+}
+
+func (s *Storage) GetFollowersByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Follow, error) {
+	start := time.Now()
+	res, err := s.db.GetFollowersByUserIds(ctx, userIds, page)
+	s.observer.ObserveStorage("GetFollowersByUserIds", start, err)
+	return res, err
+}
+
+func (s *Storage) GetFollowingByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Follow, error) {
+	start := time.Now()
+	res, err := s.db.GetFollowingByUserIds(ctx, userIds, page)
+	s.observer.ObserveStorage("GetFollowingByUserIds", start, err)
+	return res, err
+}
+
+func (s *Storage) GetFeed(ctx context.Context, userId uint, page models.Page) ([]*models.Post, error) {
+	start := time.Now()
+	res, err := s.db.GetFeed(ctx, userId, page)
+	s.observer.ObserveStorage("GetFeed", start, err)
+	return res, err
+}
+
+func (s *Storage) GetCommentTree(ctx context.Context, query models.TreeQuery) (*models.CommentTree, error) {
+	start := time.Now()
+	res, err := s.db.GetCommentTree(ctx, query)
+	s.observer.ObserveStorage("GetCommentTree", start, err)
+	return res, err
+}
+
+func (s *Storage) Search(ctx context.Context, query models.SearchQuery) ([]*models.SearchHit, error) {
+	start := time.Now()
+	res, err := s.db.Search(ctx, query)
+	s.observer.ObserveStorage("Search", start, err)
+	return res, err
+}
+
+func (s *Storage) GetPostRevisionsByPostIds(ctx context.Context, postIds []uint) ([]*models.PostRevision, error) {
+	start := time.Now()
+	res, err := s.db.GetPostRevisionsByPostIds(ctx, postIds)
+	s.observer.ObserveStorage("GetPostRevisionsByPostIds", start, err)
+	return res, err
+}
+
+func (s *Storage) GetCommentRevisionsByCommentIds(ctx context.Context, commentIds []uint) ([]*models.CommentRevision, error) {
+	start := time.Now()
+	res, err := s.db.GetCommentRevisionsByCommentIds(ctx, commentIds)
+	s.observer.ObserveStorage("GetCommentRevisionsByCommentIds", start, err)
+	return res, err
+}
+
+func (s *Storage) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	start := time.Now()
+	err := s.db.CreateRefreshToken(ctx, token)
+	s.observer.ObserveStorage("CreateRefreshToken", start, err)
+	return err
+}
+
+func (s *Storage) UseRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	start := time.Now()
+	res, err := s.db.UseRefreshToken(ctx, hash)
+	s.observer.ObserveStorage("UseRefreshToken", start, err)
+	return res, err
+}
+
+func (s *Storage) RevokeRefreshTokens(ctx context.Context, family string) error {
+	start := time.Now()
+	err := s.db.RevokeRefreshTokens(ctx, family)
+	s.observer.ObserveStorage("RevokeRefreshTokens", start, err)
+	return err
+}
+
+func (s *Storage) GetSessionVersion(ctx context.Context, userId uint) (uint, error) {
+	start := time.Now()
+	res, err := s.db.GetSessionVersion(ctx, userId)
+	s.observer.ObserveStorage("GetSessionVersion", start, err)
+	return res, err
+}
+
+func (s *Storage) RevokeSessions(ctx context.Context, userId uint) error {
+	start := time.Now()
+	err := s.db.RevokeSessions(ctx, userId)
+	s.observer.ObserveStorage("RevokeSessions", start, err)
+	return err
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := s.db.Ping(ctx)
+	s.observer.ObserveStorage("Ping", start, err)
+	return err
+}
+
+func (s *Storage) Close() error {
+	start := time.Now()
+	err := s.db.Close()
+	s.observer.ObserveStorage("Close", start, err)
+	return err
+}
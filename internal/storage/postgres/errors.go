@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"errors"
+	"github.com/lib/pq"
+	"github.com/rmntim/ozon-task/internal/server"
+)
+
+// SQLSTATE codes the storage knows how to handle. Codes starting with OZ
+// are raised by triggers, see migrations.
+const (
+	codeForeignKeyViolation = "23503"
+	codeUniqueViolation     = "23505"
+	codeCheckViolation      = "23514"
+	codeCommentsDisabled    = "OZ001"
+	codeParentMismatch      = "OZ002"
+	codeParentNotFound      = "OZ003"
+)
+
+// constraintErrors are domain errors for violations of named constraints.
+var constraintErrors = map[string]error{
+	"users_username_key":              server.ErrUsernameTaken,
+	"users_email_key":                 server.ErrEmailTaken,
+	"posts_author_id_fkey":            server.ErrUserNotFound,
+	"comments_author_id_fkey":         server.ErrUserNotFound,
+	"comments_post_id_fkey":           server.ErrPostNotFound,
+	"comments_parent_comment_id_fkey": server.ErrCommentNotFound,
+	"post_votes_post_id_fkey":         server.ErrPostNotFound,
+	"post_votes_user_id_fkey":         server.ErrUserNotFound,
+	"comment_votes_comment_id_fkey":   server.ErrCommentNotFound,
+	"comment_votes_user_id_fkey":      server.ErrUserNotFound,
+	"hubs_slug_key":                   server.ErrHubSlugTaken,
+	"post_hubs_hub_id_fkey":           server.ErrHubNotFound,
+	"hub_subscriptions_hub_id_fkey":   server.ErrHubNotFound,
+	"hub_subscriptions_user_id_fkey":  server.ErrUserNotFound,
+	"follows_follower_id_fkey":        server.ErrUserNotFound,
+	"follows_followee_id_fkey":        server.ErrUserNotFound,
+	"follows_not_self":                server.ErrSelfFollow,
+}
+
+// domainError translates an error raised by the database to the same
+// error in-memory storage returns, or nil if there's none.
+func domainError(err error) error {
+	var pgErr *pq.Error
+	if !errors.As(err, &pgErr) {
+		return nil
+	}
+
+	switch pgErr.Code {
+	case codeForeignKeyViolation, codeUniqueViolation, codeCheckViolation:
+		return constraintErrors[pgErr.Constraint]
+	case codeCommentsDisabled:
+		return server.ErrCommentsDisabled
+	case codeParentMismatch:
+		return server.ErrParentCommentMismatch
+	case codeParentNotFound:
+		return server.ErrCommentNotFound
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/rmntim/ozon-task/internal/models"
+)
+
+// pageBounds converts page cursors to nullable query parameters.
+func pageBounds(page models.Page) (after, before *uint) {
+	return nullableID(page.After), nullableID(page.Before)
+}
+
+// nullableID converts cursor to a nullable query parameter.
+func nullableID(c models.Cursor) *uint {
+	if !c.Valid {
+		return nil
+	}
+	return &c.ID
+}
+
+// pageOrder returns the direction rows have to be fetched in,
+// so that LIMIT keeps the ones closest to the right bound.
+func pageOrder(page models.Page) string {
+	if page.FromEnd {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// rankColumns are the columns posts and comments are sorted by in
+// ranked orders. They are generated from vote counters and indexed.
+var rankColumns = map[models.Order]string{
+	models.OrderTop:           "score",
+	models.OrderHot:           "hot",
+	models.OrderControversial: "controversy",
+	models.OrderBest:          "confidence",
+}
+
+// orderedPage returns conditions keeping rows of table, aliased as alias,
+// between page cursors passed as parameters number after and before, and
+// the ORDER BY list rows have to be fetched in, so that LIMIT keeps the
+// ones closest to the right bound. In ranked orders a cursor is compared
+// with the current rank of the row it points at, and one pointing at a
+// missing row selects nothing.
+func orderedPage(page models.Page, table, alias string, after, before int) (where, orderBy string) {
+	desc := page.Order != models.OrderOld
+	next, prev := ">", "<"
+	if desc {
+		next, prev = "<", ">"
+	}
+	dir := "ASC"
+	if desc != page.FromEnd {
+		dir = "DESC"
+	}
+
+	column, ranked := rankColumns[page.Order]
+	bound := func(param int, op string) string {
+		if !ranked {
+			return fmt.Sprintf("($%[1]d::int IS NULL OR %[2]s.id %[3]s $%[1]d)", param, alias, op)
+		}
+		return fmt.Sprintf("($%[1]d::int IS NULL OR (%[2]s.%[3]s, %[2]s.id) %[4]s (SELECT %[3]s, id FROM %[5]s WHERE id = $%[1]d))",
+			param, alias, column, op, table)
+	}
+	where = bound(after, next) + " AND " + bound(before, prev)
+
+	if !ranked {
+		return where, fmt.Sprintf("%s.id %s", alias, dir)
+	}
+	return where, fmt.Sprintf("%[1]s.%[2]s %[3]s, %[1]s.id %[3]s", alias, column, dir)
+}
+
+// groupOrder returns the ORDER BY list sorting rows numbered as n in
+// fetch order within groups by column, so that every group is in page
+// order.
+func groupOrder(page models.Page, column string) string {
+	if page.FromEnd {
+		return column + ", n DESC"
+	}
+	return column + ", n"
+}
+
+// inPageOrder restores page order of rows fetched with pageOrder or orderedPage.
+func inPageOrder[T any](items []T, page models.Page) []T {
+	if page.FromEnd {
+		slices.Reverse(items)
+	}
+	return items
+}
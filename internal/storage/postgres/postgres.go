@@ -5,18 +5,23 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/XSAM/otelsql"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
+	"github.com/rmntim/ozon-task/internal/lib/password"
+	"github.com/rmntim/ozon-task/internal/lib/validation"
 	"github.com/rmntim/ozon-task/internal/models"
 	"github.com/rmntim/ozon-task/internal/server"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 type Storage struct {
-	db *sqlx.DB
+	db  *sqlx.DB
+	url string
 }
 
 // New creates new postgres storage instance and pings it to check connection.
@@ -25,17 +30,26 @@ func New(username, password, address, database string) (*Storage, error) {
 
 	dbUrl := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", username, password, address, database)
 
-	db, err := sqlx.Open("postgres", dbUrl)
+	// Every statement gets a span with its text, see tracing.Setup.
+	sqlDB, err := otelsql.Open("postgres", dbUrl,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitConnectorConnect: true,
+			OmitRows:             true,
+		}),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	db := sqlx.NewDb(sqlDB, "postgres")
 
 	err = db.Ping()
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return &Storage{db: db}, nil
+	return &Storage{db: db, url: dbUrl}, nil
 }
 
 // Migrate runs migrations.
@@ -64,11 +78,56 @@ func (s *Storage) Migrate() error {
 	return nil
 }
 
-func (s *Storage) CreateUser(ctx context.Context, username string, email string, password string) (*models.User, error) {
+func (s *Storage) Ping(ctx context.Context) error {
+	const op = "storage.postgres.Ping"
+
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// MigrationVersion returns the applied migration version and whether
+// the last migration failed halfway.
+func (s *Storage) MigrationVersion(ctx context.Context) (uint, bool, error) {
+	const op = "storage.postgres.MigrationVersion"
+
+	var migration struct {
+		Version uint `db:"version"`
+		Dirty   bool `db:"dirty"`
+	}
+	err := s.db.GetContext(ctx, &migration, `SELECT version, dirty FROM schema_migrations LIMIT 1`)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return migration.Version, migration.Dirty, nil
+}
+
+// Stats returns connection pool statistics.
+func (s *Storage) Stats() sql.DBStats {
+	return s.db.Stats()
+}
+
+// Close closes the connection pool.
+func (s *Storage) Close() error {
+	const op = "storage.postgres.Close"
+
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) CreateUser(ctx context.Context, username string, email string, pass string) (*models.User, error) {
 	const op = "storage.postgres.CreateUser"
 
-	// FIXME: i dont want to bother with password hashing, lets just imagine it works
-	passwordHash := []byte(password + "_hashed")
+	passwordHash, err := password.Hash(pass)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
 
 	stmt, err := s.db.PreparexContext(ctx, "INSERT INTO users (username, email, password_hash) VALUES ($1, $2, $3) RETURNING id")
 	if err != nil {
@@ -79,24 +138,45 @@ func (s *Storage) CreateUser(ctx context.Context, username string, email string,
 	var id uint
 	err = stmt.QueryRow(username, email, passwordHash).Scan(&id)
 	if err != nil {
+		if domainErr := domainError(err); domainErr != nil {
+			return nil, domainErr
+		}
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return s.GetUserById(ctx, id)
 }
 
-func (s *Storage) CreatePost(ctx context.Context, title string, content string, authorId uint) (*models.Post, error) {
+// CreatePost creates a post published to hubs in hubIds.
+func (s *Storage) CreatePost(ctx context.Context, title string, content string, authorId uint, hubIds []uint) (*models.Post, error) {
 	const op = "storage.postgres.CreatePost"
 
-	stmt, err := s.db.PreparexContext(ctx, "INSERT INTO posts (title, content, author_id) VALUES ($1, $2, $3) RETURNING id")
+	tx, err := s.db.BeginTxx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
-	defer stmt.Close()
+	defer tx.Rollback()
 
 	var id uint
-	err = stmt.QueryRow(title, content, authorId).Scan(&id)
+	err = tx.QueryRowxContext(ctx, "INSERT INTO posts (title, content, author_id) VALUES ($1, $2, $3) RETURNING id", title, content, authorId).Scan(&id)
 	if err != nil {
+		if domainErr := domainError(err); domainErr != nil {
+			return nil, domainErr
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if len(hubIds) > 0 {
+		if _, err := tx.ExecContext(ctx,
+			"INSERT INTO post_hubs (hub_id, post_id) SELECT DISTINCT unnest($1::int[]), $2", pq.Array(hubIds), id); err != nil {
+			if domainErr := domainError(err); domainErr != nil {
+				return nil, domainErr
+			}
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -115,9 +195,8 @@ func (s *Storage) CreateComment(ctx context.Context, content string, authorId ui
 	var id uint
 	err = stmt.QueryRow(content, authorId, postId, parentCommentId).Scan(&id)
 	if err != nil {
-		var pgErr *pq.Error
-		if errors.As(err, &pgErr) && pgErr.Code == "P0001" {
-			return nil, server.ErrCommentsDisabled
+		if domainErr := domainError(err); domainErr != nil {
+			return nil, domainErr
 		}
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -129,7 +208,22 @@ func (s *Storage) GetUserById(ctx context.Context, id uint) (*models.User, error
 	const op = "storage.postgres.GetUserById"
 
 	var user models.User
-	if err := s.db.QueryRowxContext(ctx, "SELECT id, username, email FROM users WHERE id = $1", id).StructScan(&user); err != nil {
+	if err := s.db.QueryRowxContext(ctx, "SELECT id, username, email, role, followers_count FROM users WHERE id = $1", id).StructScan(&user); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, server.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &user, nil
+}
+
+// GetUserByUsername returns the user along with their password hash.
+func (s *Storage) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	const op = "storage.postgres.GetUserByUsername"
+
+	var user models.User
+	if err := s.db.QueryRowxContext(ctx, "SELECT id, username, email, role, followers_count, password_hash FROM users WHERE username = $1", username).StructScan(&user); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, server.ErrUserNotFound
 		}
@@ -139,15 +233,40 @@ func (s *Storage) GetUserById(ctx context.Context, id uint) (*models.User, error
 	return &user, nil
 }
 
-func (s *Storage) GetUsers(ctx context.Context, limit int, offset int) ([]*models.User, error) {
+func (s *Storage) SetUserRole(ctx context.Context, userId uint, role models.Role) error {
+	const op = "storage.postgres.SetUserRole"
+
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET role = $1 WHERE id = $2", role, userId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return server.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) GetUsers(ctx context.Context, page models.Page) ([]*models.User, error) {
 	const op = "storage.postgres.GetUsers"
 
-	var users []*models.User
-	if err := s.db.SelectContext(ctx, &users, "SELECT id, username, email FROM users LIMIT $1 OFFSET $2", limit, offset); err != nil {
+	after, before := pageBounds(page)
+
+	users := make([]*models.User, 0)
+	if err := s.db.SelectContext(ctx, &users, fmt.Sprintf(
+		`SELECT id, username, email, role, followers_count
+				FROM users
+				WHERE ($1::int IS NULL OR id > $1) AND ($2::int IS NULL OR id < $2)
+				ORDER BY id %s LIMIT $3`, pageOrder(page)), after, before, page.Limit); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return users, nil
+	return inPageOrder(users, page), nil
 }
 
 func (s *Storage) GetPostById(ctx context.Context, id uint) (*models.Post, error) {
@@ -155,11 +274,11 @@ func (s *Storage) GetPostById(ctx context.Context, id uint) (*models.Post, error
 
 	var post models.Post
 	if err := s.db.QueryRowxContext(ctx,
-		`SELECT p.id, p.title, p.created_at, p.content, p.author_id, array_agg(c.id) as comments_ids
+		`SELECT p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes, array_agg(c.id) as comments_ids
 				FROM posts p
 					LEFT JOIN comments c ON p.id = c.post_id
 				WHERE p.id = $1
-				GROUP BY p.id, p.title, p.created_at, p.content, p.author_id`, id).StructScan(&post); err != nil {
+				GROUP BY p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes`, id).StructScan(&post); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, server.ErrPostNotFound
 		}
@@ -169,19 +288,24 @@ func (s *Storage) GetPostById(ctx context.Context, id uint) (*models.Post, error
 	return &post, nil
 }
 
-func (s *Storage) GetPosts(ctx context.Context, limit int, offset int) ([]*models.Post, error) {
+func (s *Storage) GetPosts(ctx context.Context, page models.Page) ([]*models.Post, error) {
 	const op = "storage.postgres.GetPosts"
 
-	var posts []*models.Post
-	if err := s.db.SelectContext(ctx, &posts,
-		`SELECT p.id, p.title, p.created_at, p.content, p.author_id, array_agg(c.id) as comments_ids
+	after, before := pageBounds(page)
+	where, orderBy := orderedPage(page, "posts", "p", 1, 2)
+
+	posts := make([]*models.Post, 0)
+	if err := s.db.SelectContext(ctx, &posts, fmt.Sprintf(
+		`SELECT p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes, array_agg(c.id) as comments_ids
 				FROM posts p
 					LEFT JOIN comments c ON p.id = c.post_id
-				GROUP by p.id, p.title, p.created_at, p.content, p.author_id LIMIT $1 OFFSET $2`, limit, offset); err != nil {
+				WHERE %s
+				GROUP BY p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes
+				ORDER BY %s LIMIT $3`, where, orderBy), after, before, page.Limit); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return posts, nil
+	return inPageOrder(posts, page), nil
 }
 
 func (s *Storage) GetCommentById(ctx context.Context, id uint) (*models.Comment, error) {
@@ -189,11 +313,11 @@ func (s *Storage) GetCommentById(ctx context.Context, id uint) (*models.Comment,
 
 	var comment models.Comment
 	if err := s.db.QueryRowxContext(ctx,
-		`SELECT c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, array_agg(r.id) as replies_ids
+		`SELECT c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes, array_agg(r.id) as replies_ids
 				FROM comments c
 					LEFT JOIN comments r ON r.parent_comment_id = c.id
 				WHERE c.id = $1
-				GROUP BY c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id`, id).StructScan(&comment); err != nil {
+				GROUP BY c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes`, id).StructScan(&comment); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, server.ErrCommentNotFound
 		}
@@ -203,82 +327,897 @@ func (s *Storage) GetCommentById(ctx context.Context, id uint) (*models.Comment,
 	return &comment, nil
 }
 
-func (s *Storage) GetComments(ctx context.Context, limit int, offset int) ([]*models.Comment, error) {
+func (s *Storage) GetComments(ctx context.Context, page models.Page) ([]*models.Comment, error) {
 	const op = "storage.postgres.GetComments"
 
-	var comments []*models.Comment
-	if err := s.db.SelectContext(ctx, &comments,
-		`SELECT c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, array_agg(r.id) as replies_ids
+	after, before := pageBounds(page)
+
+	comments := make([]*models.Comment, 0)
+	if err := s.db.SelectContext(ctx, &comments, fmt.Sprintf(
+		`SELECT c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes, array_agg(r.id) as replies_ids
 				FROM comments c
 					LEFT JOIN comments r ON r.parent_comment_id = c.id
-				GROUP by c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id LIMIT $1 OFFSET $2`, limit, offset); err != nil {
+				WHERE ($1::int IS NULL OR c.id > $1) AND ($2::int IS NULL OR c.id < $2)
+				GROUP BY c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes
+				ORDER BY c.id %s LIMIT $3`, pageOrder(page)), after, before, page.Limit); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	return comments, nil
+	return inPageOrder(comments, page), nil
 }
 
 func (s *Storage) ToggleComments(ctx context.Context, postId uint, userId uint) (bool, error) {
 	const op = "storage.postgres.ToggleComments"
 
 	var commentsAvailable bool
-	stmt, err := s.db.PreparexContext(ctx, `UPDATE posts SET comments_available = NOT comments_available WHERE id = $1 AND author_id = $2 RETURNING comments_available`)
+	stmt, err := s.db.PreparexContext(ctx, `UPDATE posts SET comments_available = NOT comments_available WHERE id = $1 AND author_id = $2 AND deleted_at IS NULL RETURNING comments_available`)
 	if err != nil {
 		return false, fmt.Errorf("%s: %w", op, err)
 	}
 	defer stmt.Close()
 
 	if err := stmt.QueryRow(postId, userId).Scan(&commentsAvailable); err != nil {
-		return false, fmt.Errorf("%s: %w", op, err)
+		if !errors.Is(err, sql.ErrNoRows) {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+
+		// Nothing was updated, find out why.
+		post, err := s.GetPostById(ctx, postId)
+		if err != nil {
+			return false, err
+		}
+		if post.DeletedAt != nil {
+			return false, server.ErrPostNotFound
+		}
+		return false, server.ErrUnauthorized
 	}
 
 	return commentsAvailable, nil
 }
 
-func (s *Storage) GetPostsFromUser(ctx context.Context, userId uint) ([]*models.Post, error) {
-	const op = "storage.postgres.GetPostsFromUser"
+// UpdatePost replaces title and content of the post, keeping the
+// previous version as a revision.
+func (s *Storage) UpdatePost(ctx context.Context, id uint, userId uint, title string, content string) (*models.Post, error) {
+	const op = "storage.postgres.UpdatePost"
+
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var authorId uint
+	if err := tx.QueryRowxContext(ctx, "SELECT author_id FROM posts WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&authorId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, server.ErrPostNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if authorId != userId {
+		return nil, server.ErrUnauthorized
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO post_revisions (post_id, title, content, created_at)
+				SELECT id, title, content, COALESCE(edited_at, created_at)
+				FROM posts
+				WHERE id = $1`, id); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE posts SET title = $1, content = $2, edited_at = CURRENT_TIMESTAMP WHERE id = $3",
+		title, content, id); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.GetPostById(ctx, id)
+}
+
+// UpdateComment replaces content of the comment, keeping the previous
+// version as a revision.
+func (s *Storage) UpdateComment(ctx context.Context, id uint, userId uint, content string) (*models.Comment, error) {
+	const op = "storage.postgres.UpdateComment"
 
-	var posts []*models.Post
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var authorId uint
+	if err := tx.QueryRowxContext(ctx, "SELECT author_id FROM comments WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&authorId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, server.ErrCommentNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if authorId != userId {
+		return nil, server.ErrUnauthorized
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO comment_revisions (comment_id, content, created_at)
+				SELECT id, content, COALESCE(edited_at, created_at)
+				FROM comments
+				WHERE id = $1`, id); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE comments SET content = $1, edited_at = CURRENT_TIMESTAMP WHERE id = $2",
+		content, id); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.GetCommentById(ctx, id)
+}
+
+// DeletePost marks the post as deleted and disables comments on it.
+// Deleting a deleted post keeps the original deletion time.
+func (s *Storage) DeletePost(ctx context.Context, id uint) error {
+	const op = "storage.postgres.DeletePost"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE posts SET deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP), comments_available = FALSE WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return server.ErrPostNotFound
+	}
+
+	return nil
+}
+
+// DeleteComment marks the comment as deleted. The row is kept, so its
+// replies stay in place. Deleting a deleted comment keeps the original
+// deletion time.
+func (s *Storage) DeleteComment(ctx context.Context, id uint) error {
+	const op = "storage.postgres.DeleteComment"
+
+	res, err := s.db.ExecContext(ctx,
+		"UPDATE comments SET deleted_at = COALESCE(deleted_at, CURRENT_TIMESTAMP) WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return server.ErrCommentNotFound
+	}
+
+	return nil
+}
+
+// VotePost sets the vote of the user on the post, or retracts it if
+// value is 0, and returns the post with updated counters. Deleted posts
+// can't be voted on.
+func (s *Storage) VotePost(ctx context.Context, postId uint, userId uint, value int) (*models.Post, error) {
+	const op = "storage.postgres.VotePost"
+
+	if errs := validation.Vote(value); errs != nil {
+		return nil, errs
+	}
+
+	if err := s.vote(ctx, "posts", "post_votes", "post_id", postId, userId, value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, server.ErrPostNotFound
+		}
+		if domainErr := domainError(err); domainErr != nil {
+			return nil, domainErr
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.GetPostById(ctx, postId)
+}
+
+// VoteComment sets the vote of the user on the comment, or retracts it
+// if value is 0, and returns the comment with updated counters. Deleted
+// comments can't be voted on.
+func (s *Storage) VoteComment(ctx context.Context, commentId uint, userId uint, value int) (*models.Comment, error) {
+	const op = "storage.postgres.VoteComment"
+
+	if errs := validation.Vote(value); errs != nil {
+		return nil, errs
+	}
+
+	if err := s.vote(ctx, "comments", "comment_votes", "comment_id", commentId, userId, value); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, server.ErrCommentNotFound
+		}
+		if domainErr := domainError(err); domainErr != nil {
+			return nil, domainErr
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.GetCommentById(ctx, commentId)
+}
+
+// vote stores a vote in votesTable, whose triggers update counters of
+// the target in table. It returns sql.ErrNoRows if there's no such
+// target or it's deleted.
+func (s *Storage) vote(ctx context.Context, table, votesTable, column string, targetId uint, userId uint, value int) error {
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The target stays locked until the vote is stored, so it can't be
+	// deleted in between. Triggers update the same row, and a share lock
+	// would deadlock two concurrent voters upgrading it.
+	var id uint
+	if err := tx.QueryRowxContext(ctx,
+		fmt.Sprintf("SELECT id FROM %s WHERE id = $1 AND deleted_at IS NULL FOR NO KEY UPDATE", table), targetId).Scan(&id); err != nil {
+		return err
+	}
+
+	if value == 0 {
+		_, err = tx.ExecContext(ctx,
+			fmt.Sprintf("DELETE FROM %s WHERE %s = $1 AND user_id = $2", votesTable, column), targetId, userId)
+	} else {
+		// Repeating the same vote doesn't touch the row, so counters stay put.
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(
+			`INSERT INTO %[1]s (%[2]s, user_id, value) VALUES ($1, $2, $3)
+					ON CONFLICT (%[2]s, user_id) DO UPDATE SET value = EXCLUDED.value
+					WHERE %[1]s.value <> EXCLUDED.value`, votesTable, column), targetId, userId, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetPostVotes returns votes of the user on posts in postIds.
+func (s *Storage) GetPostVotes(ctx context.Context, userId uint, postIds []uint) ([]*models.Vote, error) {
+	const op = "storage.postgres.GetPostVotes"
+
+	votes := make([]*models.Vote, 0)
+	if err := s.db.SelectContext(ctx, &votes,
+		"SELECT post_id AS target_id, user_id, value FROM post_votes WHERE user_id = $1 AND post_id = ANY($2)",
+		userId, pq.Array(postIds)); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return votes, nil
+}
+
+// GetCommentVotes returns votes of the user on comments in commentIds.
+func (s *Storage) GetCommentVotes(ctx context.Context, userId uint, commentIds []uint) ([]*models.Vote, error) {
+	const op = "storage.postgres.GetCommentVotes"
+
+	votes := make([]*models.Vote, 0)
+	if err := s.db.SelectContext(ctx, &votes,
+		"SELECT comment_id AS target_id, user_id, value FROM comment_votes WHERE user_id = $1 AND comment_id = ANY($2)",
+		userId, pq.Array(commentIds)); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return votes, nil
+}
+
+func (s *Storage) GetPostsFromUser(ctx context.Context, userId uint, page models.Page) ([]*models.Post, error) {
+	return s.GetPostsByUserIds(ctx, []uint{userId}, page)
+}
+
+func (s *Storage) GetReplies(ctx context.Context, commentId uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	return s.GetRepliesByCommentIds(ctx, []uint{commentId}, page, includeDeleted)
+}
+
+func (s *Storage) GetCommentsForPost(ctx context.Context, postId uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	return s.GetCommentsByPostIds(ctx, []uint{postId}, page, includeDeleted)
+}
+
+func (s *Storage) GetUsersByIds(ctx context.Context, ids []uint) ([]*models.User, error) {
+	const op = "storage.postgres.GetUsersByIds"
+
+	users := make([]*models.User, 0)
+	if err := s.db.SelectContext(ctx, &users, "SELECT id, username, email, role, followers_count FROM users WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return users, nil
+}
+
+func (s *Storage) GetPostsByIds(ctx context.Context, ids []uint) ([]*models.Post, error) {
+	const op = "storage.postgres.GetPostsByIds"
+
+	posts := make([]*models.Post, 0)
 	if err := s.db.SelectContext(ctx, &posts,
-		`SELECT p.id, p.title, p.created_at, p.content, p.author_id, array_agg(c.id) as comments_ids
+		`SELECT p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes, array_agg(c.id) as comments_ids
 				FROM posts p
 					LEFT JOIN comments c ON p.id = c.post_id
-				WHERE p.author_id = $1
-				GROUP BY p.id, p.title, p.created_at, p.content, p.author_id`, userId); err != nil {
+				WHERE p.id = ANY($1)
+				GROUP BY p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes`, pq.Array(ids)); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return posts, nil
 }
 
-func (s *Storage) GetReplies(ctx context.Context, commentId uint) ([]*models.Comment, error) {
-	const op = "storage.postgres.GetReplies"
+func (s *Storage) GetCommentsByIds(ctx context.Context, ids []uint) ([]*models.Comment, error) {
+	const op = "storage.postgres.GetCommentsByIds"
 
-	var comments []*models.Comment
+	comments := make([]*models.Comment, 0)
 	if err := s.db.SelectContext(ctx, &comments,
-		`SELECT c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, array_agg(r.id) as replies_ids
+		`SELECT c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes, array_agg(r.id) as replies_ids
 				FROM comments c
 					LEFT JOIN comments r ON r.parent_comment_id = c.id
-				WHERE c.parent_comment_id = $1
-				GROUP BY c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id`, commentId); err != nil {
+				WHERE c.id = ANY($1)
+				GROUP BY c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes`, pq.Array(ids)); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return comments, nil
 }
 
-func (s *Storage) GetCommentsForPost(ctx context.Context, postId uint) ([]*models.Comment, error) {
-	const op = "storage.postgres.GetCommentsForPost"
+// GetPostsByUserIds returns a page of posts for every user in userIds.
+func (s *Storage) GetPostsByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Post, error) {
+	const op = "storage.postgres.GetPostsByUserIds"
 
-	var comments []*models.Comment
-	if err := s.db.SelectContext(ctx, &comments,
-		`SELECT c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, array_agg(r.id) as replies_ids
-				FROM comments c
-					LEFT JOIN comments r ON r.parent_comment_id = c.id
-				WHERE c.post_id = $1
-				GROUP BY c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id`, postId); err != nil {
+	after, before := pageBounds(page)
+
+	posts := make([]*models.Post, 0)
+	if err := s.db.SelectContext(ctx, &posts, fmt.Sprintf(
+		`SELECT id, title, created_at, content, author_id, comments_available, edited_at, deleted_at, upvotes, downvotes, comments_ids
+				FROM (SELECT p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes, array_agg(c.id) as comments_ids,
+							ROW_NUMBER() OVER (PARTITION BY p.author_id ORDER BY p.id %s) AS n
+						FROM posts p
+							LEFT JOIN comments c ON p.id = c.post_id
+						WHERE p.author_id = ANY($1) AND ($2::int IS NULL OR p.id > $2) AND ($3::int IS NULL OR p.id < $3)
+						GROUP BY p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes) t
+				WHERE n <= $4
+				ORDER BY %s`, pageOrder(page), groupOrder(page, "author_id")), pq.Array(userIds), after, before, page.Limit); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return posts, nil
+}
+
+// GetCommentsByPostIds returns a page of comments for every post in postIds.
+// Deleted comments are skipped unless includeDeleted is set.
+func (s *Storage) GetCommentsByPostIds(ctx context.Context, postIds []uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	const op = "storage.postgres.GetCommentsByPostIds"
+
+	after, before := pageBounds(page)
+	where, orderBy := orderedPage(page, "comments", "c", 2, 3)
+
+	comments := make([]*models.Comment, 0)
+	if err := s.db.SelectContext(ctx, &comments, fmt.Sprintf(
+		`SELECT id, content, created_at, author_id, post_id, parent_comment_id, edited_at, deleted_at, upvotes, downvotes, replies_ids
+				FROM (SELECT c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes, array_agg(r.id) as replies_ids,
+							ROW_NUMBER() OVER (PARTITION BY c.post_id ORDER BY %s) AS n
+						FROM comments c
+							LEFT JOIN comments r ON r.parent_comment_id = c.id
+						WHERE c.post_id = ANY($1) AND %s
+							AND ($5 OR c.deleted_at IS NULL)
+						GROUP BY c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes) t
+				WHERE n <= $4
+				ORDER BY %s`, orderBy, where, groupOrder(page, "post_id")), pq.Array(postIds), after, before, page.Limit, includeDeleted); err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return comments, nil
 }
+
+// GetRepliesByCommentIds returns a page of replies for every comment in commentIds.
+// Deleted replies are skipped unless includeDeleted is set.
+func (s *Storage) GetRepliesByCommentIds(ctx context.Context, commentIds []uint, page models.Page, includeDeleted bool) ([]*models.Comment, error) {
+	const op = "storage.postgres.GetRepliesByCommentIds"
+
+	after, before := pageBounds(page)
+	where, orderBy := orderedPage(page, "comments", "c", 2, 3)
+
+	comments := make([]*models.Comment, 0)
+	if err := s.db.SelectContext(ctx, &comments, fmt.Sprintf(
+		`SELECT id, content, created_at, author_id, post_id, parent_comment_id, edited_at, deleted_at, upvotes, downvotes, replies_ids
+				FROM (SELECT c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes, array_agg(r.id) as replies_ids,
+							ROW_NUMBER() OVER (PARTITION BY c.parent_comment_id ORDER BY %s) AS n
+						FROM comments c
+							LEFT JOIN comments r ON r.parent_comment_id = c.id
+						WHERE c.parent_comment_id = ANY($1) AND %s
+							AND ($5 OR c.deleted_at IS NULL)
+						GROUP BY c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes) t
+				WHERE n <= $4
+				ORDER BY %s`, orderBy, where, groupOrder(page, "parent_comment_id")), pq.Array(commentIds), after, before, page.Limit, includeDeleted); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return comments, nil
+}
+
+// CreateHub creates a hub with a unique slug.
+func (s *Storage) CreateHub(ctx context.Context, slug string, title string, description string) (*models.Hub, error) {
+	const op = "storage.postgres.CreateHub"
+
+	if errs := validation.Hub(slug, title, description); errs != nil {
+		return nil, errs
+	}
+
+	var hub models.Hub
+	if err := s.db.QueryRowxContext(ctx,
+		`INSERT INTO hubs (slug, title, description) VALUES ($1, $2, $3)
+				RETURNING id, slug, title, description, created_at, subscribers_count`, slug, title, description).StructScan(&hub); err != nil {
+		if domainErr := domainError(err); domainErr != nil {
+			return nil, domainErr
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &hub, nil
+}
+
+func (s *Storage) GetHubById(ctx context.Context, id uint) (*models.Hub, error) {
+	const op = "storage.postgres.GetHubById"
+
+	var hub models.Hub
+	if err := s.db.QueryRowxContext(ctx,
+		"SELECT id, slug, title, description, created_at, subscribers_count FROM hubs WHERE id = $1", id).StructScan(&hub); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, server.ErrHubNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &hub, nil
+}
+
+func (s *Storage) GetHubBySlug(ctx context.Context, slug string) (*models.Hub, error) {
+	const op = "storage.postgres.GetHubBySlug"
+
+	var hub models.Hub
+	if err := s.db.QueryRowxContext(ctx,
+		"SELECT id, slug, title, description, created_at, subscribers_count FROM hubs WHERE slug = $1", slug).StructScan(&hub); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, server.ErrHubNotFound
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &hub, nil
+}
+
+// SubscribeHub subscribes the user to the hub, unless they already are,
+// and returns the hub with the updated counter.
+func (s *Storage) SubscribeHub(ctx context.Context, hubId uint, userId uint) (*models.Hub, error) {
+	const op = "storage.postgres.SubscribeHub"
+
+	if _, err := s.db.ExecContext(ctx,
+		"INSERT INTO hub_subscriptions (hub_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", hubId, userId); err != nil {
+		if domainErr := domainError(err); domainErr != nil {
+			return nil, domainErr
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.GetHubById(ctx, hubId)
+}
+
+// UnsubscribeHub unsubscribes the user from the hub, if they are
+// subscribed, and returns the hub with the updated counter.
+func (s *Storage) UnsubscribeHub(ctx context.Context, hubId uint, userId uint) (*models.Hub, error) {
+	const op = "storage.postgres.UnsubscribeHub"
+
+	if _, err := s.db.ExecContext(ctx,
+		"DELETE FROM hub_subscriptions WHERE hub_id = $1 AND user_id = $2", hubId, userId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.GetHubById(ctx, hubId)
+}
+
+// GetPostsFromHub returns a page of posts published to the hub.
+func (s *Storage) GetPostsFromHub(ctx context.Context, hubId uint, page models.Page) ([]*models.Post, error) {
+	const op = "storage.postgres.GetPostsFromHub"
+
+	after, before := pageBounds(page)
+	where, orderBy := orderedPage(page, "posts", "p", 1, 2)
+
+	posts := make([]*models.Post, 0)
+	if err := s.db.SelectContext(ctx, &posts, fmt.Sprintf(
+		`SELECT p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes, array_agg(c.id) as comments_ids
+				FROM post_hubs h
+					JOIN posts p ON p.id = h.post_id
+					LEFT JOIN comments c ON p.id = c.post_id
+				WHERE h.hub_id = $4 AND %s
+				GROUP BY p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes
+				ORDER BY %s LIMIT $3`, where, orderBy), after, before, page.Limit, hubId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return inPageOrder(posts, page), nil
+}
+
+// FollowUser makes the follower follow the user, unless they already do,
+// and returns the user with the updated counter.
+func (s *Storage) FollowUser(ctx context.Context, userId uint, followerId uint) (*models.User, error) {
+	const op = "storage.postgres.FollowUser"
+
+	if _, err := s.db.ExecContext(ctx,
+		"INSERT INTO follows (follower_id, followee_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", followerId, userId); err != nil {
+		if domainErr := domainError(err); domainErr != nil {
+			return nil, domainErr
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.GetUserById(ctx, userId)
+}
+
+// UnfollowUser makes the follower stop following the user, if they do,
+// and returns the user with the updated counter.
+func (s *Storage) UnfollowUser(ctx context.Context, userId uint, followerId uint) (*models.User, error) {
+	const op = "storage.postgres.UnfollowUser"
+
+	if _, err := s.db.ExecContext(ctx,
+		"DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2", followerId, userId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return s.GetUserById(ctx, userId)
+}
+
+// GetFollowers returns a page of users following the user, by ID.
+func (s *Storage) GetFollowers(ctx context.Context, userId uint, page models.Page) ([]*models.User, error) {
+	const op = "storage.postgres.GetFollowers"
+
+	after, before := pageBounds(page)
+
+	users := make([]*models.User, 0)
+	if err := s.db.SelectContext(ctx, &users, fmt.Sprintf(
+		`SELECT u.id, u.username, u.email, u.role, u.followers_count
+				FROM follows f
+					JOIN users u ON u.id = f.follower_id
+				WHERE f.followee_id = $4 AND ($1::int IS NULL OR f.follower_id > $1) AND ($2::int IS NULL OR f.follower_id < $2)
+				ORDER BY f.follower_id %s LIMIT $3`, pageOrder(page)), after, before, page.Limit, userId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return inPageOrder(users, page), nil
+}
+
+// GetFollowing returns a page of users the user follows, by ID.
+func (s *Storage) GetFollowing(ctx context.Context, userId uint, page models.Page) ([]*models.User, error) {
+	const op = "storage.postgres.GetFollowing"
+
+	after, before := pageBounds(page)
+
+	users := make([]*models.User, 0)
+	if err := s.db.SelectContext(ctx, &users, fmt.Sprintf(
+		`SELECT u.id, u.username, u.email, u.role, u.followers_count
+				FROM follows f
+					JOIN users u ON u.id = f.followee_id
+				WHERE f.follower_id = $4 AND ($1::int IS NULL OR f.followee_id > $1) AND ($2::int IS NULL OR f.followee_id < $2)
+				ORDER BY f.followee_id %s LIMIT $3`, pageOrder(page)), after, before, page.Limit, userId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return inPageOrder(users, page), nil
+}
+
+// GetFollowersByUserIds returns a page of followers for every user in userIds.
+func (s *Storage) GetFollowersByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Follow, error) {
+	const op = "storage.postgres.GetFollowersByUserIds"
+
+	follows, err := s.getFollowsByUserIds(ctx, "followee_id", "follower_id", userIds, page)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return follows, nil
+}
+
+// GetFollowingByUserIds returns a page of followed users for every user in userIds.
+func (s *Storage) GetFollowingByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Follow, error) {
+	const op = "storage.postgres.GetFollowingByUserIds"
+
+	follows, err := s.getFollowsByUserIds(ctx, "follower_id", "followee_id", userIds, page)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return follows, nil
+}
+
+// getFollowsByUserIds returns a page of users in the other column of
+// follows for every user in userIds, found in the target column.
+func (s *Storage) getFollowsByUserIds(ctx context.Context, target, other string, userIds []uint, page models.Page) ([]*models.Follow, error) {
+	after, before := pageBounds(page)
+
+	follows := make([]*models.Follow, 0)
+	err := s.db.SelectContext(ctx, &follows, fmt.Sprintf(
+		`SELECT target_id, id, username, email, role, followers_count
+				FROM (SELECT f.%[1]s AS target_id, u.id, u.username, u.email, u.role, u.followers_count,
+							ROW_NUMBER() OVER (PARTITION BY f.%[1]s ORDER BY f.%[2]s %[3]s) AS n
+						FROM follows f
+							JOIN users u ON u.id = f.%[2]s
+						WHERE f.%[1]s = ANY($1) AND ($2::int IS NULL OR f.%[2]s > $2) AND ($3::int IS NULL OR f.%[2]s < $3)) t
+				WHERE n <= $4
+				ORDER BY %[4]s`, target, other, pageOrder(page), groupOrder(page, "target_id")), pq.Array(userIds), after, before, page.Limit)
+	return follows, err
+}
+
+// GetFeed returns a page of posts by the users the user follows and
+// published to the hubs they are subscribed to, skipping deleted ones.
+// A post of the feed page is on the page of its author or of one of its
+// hubs too, so only those pages are fetched, every one with an index
+// scan, and then merged.
+func (s *Storage) GetFeed(ctx context.Context, userId uint, page models.Page) ([]*models.Post, error) {
+	const op = "storage.postgres.GetFeed"
+
+	after, before := pageBounds(page)
+	where, orderBy := orderedPage(page, "posts", "p", 1, 2)
+
+	posts := make([]*models.Post, 0)
+	if err := s.db.SelectContext(ctx, &posts, fmt.Sprintf(
+		`WITH feed AS (SELECT a.id
+						FROM follows f
+							CROSS JOIN LATERAL (SELECT p.id
+												FROM posts p
+												WHERE p.author_id = f.followee_id AND p.deleted_at IS NULL AND %[1]s
+												ORDER BY %[2]s
+												LIMIT $3) a
+						WHERE f.follower_id = $4
+						UNION
+						SELECT h.id
+						FROM hub_subscriptions s
+							CROSS JOIN LATERAL (SELECT p.id
+												FROM post_hubs ph
+													JOIN posts p ON p.id = ph.post_id
+												WHERE ph.hub_id = s.hub_id AND p.deleted_at IS NULL AND %[1]s
+												ORDER BY %[2]s
+												LIMIT $3) h
+						WHERE s.user_id = $4)
+				SELECT p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes, array_agg(c.id) as comments_ids
+				FROM feed
+					JOIN posts p ON p.id = feed.id
+					LEFT JOIN comments c ON p.id = c.post_id
+				GROUP BY p.id, p.title, p.created_at, p.content, p.author_id, p.comments_available, p.edited_at, p.deleted_at, p.upvotes, p.downvotes
+				ORDER BY %[2]s LIMIT $3`, where, orderBy), after, before, page.Limit, userId); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return inPageOrder(posts, page), nil
+}
+
+// GetCommentTree loads a part of a comment thread in pre-order. Every level
+// is fetched with an index scan limited per parent, and the materialized
+// path gives both the ordering and the depth of comments.
+func (s *Storage) GetCommentTree(ctx context.Context, query models.TreeQuery) (*models.CommentTree, error) {
+	const op = "storage.postgres.GetCommentTree"
+
+	after := nullableID(query.After)
+
+	nodes := make([]*models.CommentTreeNode, 0)
+	if err := s.db.SelectContext(ctx, &nodes,
+		`WITH RECURSIVE tree AS (SELECT f.id, 1 AS level
+								FROM (SELECT id
+									FROM comments
+									WHERE post_id = $1
+										AND (($2::int IS NULL AND parent_comment_id IS NULL) OR parent_comment_id = $2)
+										AND ($3::int IS NULL OR id > $3)
+									ORDER BY id
+									LIMIT $4) f
+								UNION ALL
+								SELECT r.id, t.level + 1
+								FROM tree t
+									CROSS JOIN LATERAL (SELECT id
+														FROM comments
+														WHERE parent_comment_id = t.id
+														ORDER BY id
+														LIMIT $4) r
+								WHERE t.level < $5)
+				SELECT c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes, array_agg(r.id) as replies_ids,
+					cardinality(c.path) - 1 AS depth, count(r.id) AS child_count
+				FROM tree t
+					JOIN comments c ON c.id = t.id
+					LEFT JOIN comments r ON r.parent_comment_id = c.id
+				GROUP BY c.id, c.content, c.created_at, c.author_id, c.post_id, c.parent_comment_id, c.edited_at, c.deleted_at, c.upvotes, c.downvotes, c.path
+				ORDER BY c.path`, query.PostID, query.RootID, after, query.Limit, query.MaxDepth); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var remaining int
+	if err := s.db.QueryRowxContext(ctx,
+		`SELECT count(*)
+				FROM comments
+				WHERE post_id = $1
+					AND (($2::int IS NULL AND parent_comment_id IS NULL) OR parent_comment_id = $2)
+					AND ($3::int IS NULL OR id > $3)`, query.PostID, query.RootID, after).Scan(&remaining); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &models.CommentTree{Nodes: nodes, Remaining: remaining}, nil
+}
+
+// GetPostRevisionsByPostIds returns revisions of every post in postIds, oldest first.
+func (s *Storage) GetPostRevisionsByPostIds(ctx context.Context, postIds []uint) ([]*models.PostRevision, error) {
+	const op = "storage.postgres.GetPostRevisionsByPostIds"
+
+	revisions := make([]*models.PostRevision, 0)
+	if err := s.db.SelectContext(ctx, &revisions,
+		`SELECT id, post_id, title, content, created_at
+				FROM post_revisions
+				WHERE post_id = ANY($1)
+				ORDER BY id`, pq.Array(postIds)); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revisions, nil
+}
+
+// GetCommentRevisionsByCommentIds returns revisions of every comment in commentIds, oldest first.
+func (s *Storage) GetCommentRevisionsByCommentIds(ctx context.Context, commentIds []uint) ([]*models.CommentRevision, error) {
+	const op = "storage.postgres.GetCommentRevisionsByCommentIds"
+
+	revisions := make([]*models.CommentRevision, 0)
+	if err := s.db.SelectContext(ctx, &revisions,
+		`SELECT id, comment_id, content, created_at
+				FROM comment_revisions
+				WHERE comment_id = ANY($1)
+				ORDER BY id`, pq.Array(commentIds)); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return revisions, nil
+}
+
+// headlineOptions make ts_headline snippets look like those of the
+// in-memory storage.
+const headlineOptions = "StartSel=<b>, StopSel=</b>, MaxWords=20, MinWords=10"
+
+// Search finds posts, comments and users matching the query, best matches
+// first. Texts are matched with both English and Russian stemming, as
+// content is mixed, and usernames as they are. Deleted posts and
+// comments are skipped.
+func (s *Storage) Search(ctx context.Context, query models.SearchQuery) ([]*models.SearchHit, error) {
+	const op = "storage.postgres.Search"
+
+	if errs := validation.Search(query.Text); errs != nil {
+		return nil, errs
+	}
+
+	types := make([]string, len(query.Types))
+	for i, t := range query.Types {
+		types[i] = string(t)
+	}
+
+	hits := make([]*models.SearchHit, 0)
+	if err := s.db.SelectContext(ctx, &hits,
+		`WITH q AS (SELECT websearch_to_tsquery('english', $1) || websearch_to_tsquery('russian', $1) AS text,
+							websearch_to_tsquery('simple', $1) AS name),
+					hits AS (SELECT 'post' AS type, p.id, ts_rank_cd(p.search, q.text) AS rank
+							FROM posts p, q
+							WHERE (cardinality($2::text[]) = 0 OR 'post' = ANY($2)) AND p.deleted_at IS NULL AND p.search @@ q.text
+							UNION ALL
+							SELECT 'comment', c.id, ts_rank_cd(c.search, q.text)
+							FROM comments c, q
+							WHERE (cardinality($2::text[]) = 0 OR 'comment' = ANY($2)) AND c.deleted_at IS NULL AND c.search @@ q.text
+							UNION ALL
+							SELECT 'user', u.id, ts_rank_cd(u.search, q.name)
+							FROM users u, q
+							WHERE (cardinality($2::text[]) = 0 OR 'user' = ANY($2)) AND u.search @@ q.name
+							ORDER BY rank DESC, type, id
+							LIMIT $3 OFFSET $4)
+				SELECT h.type, h.id, h.rank,
+					CASE h.type
+						WHEN 'post' THEN (SELECT ts_headline('russian', html_escape(p.title || ' ' || p.content), q.text, $5) FROM posts p WHERE p.id = h.id)
+						WHEN 'comment' THEN (SELECT ts_headline('russian', html_escape(c.content), q.text, $5) FROM comments c WHERE c.id = h.id)
+						ELSE (SELECT ts_headline('simple', html_escape(u.username), q.name, $5) FROM users u WHERE u.id = h.id)
+					END AS snippet
+				FROM hits h, q
+				ORDER BY h.rank DESC, h.type, h.id`, query.Text, pq.Array(types), query.Limit, query.Offset, headlineOptions); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return hits, nil
+}
+
+func (s *Storage) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	const op = "storage.postgres.CreateRefreshToken"
+
+	if _, err := s.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (token_hash, user_id, family, expires_at) VALUES ($1, $2, $3, $4)",
+		token.Hash, token.UserID, token.Family, token.ExpiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseRefreshToken marks the token as used and returns it. If the token
+// was already used, it's returned along with server.ErrTokenReused.
+func (s *Storage) UseRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error) {
+	const op = "storage.postgres.UseRefreshToken"
+
+	var token models.RefreshToken
+	err := s.db.QueryRowxContext(ctx,
+		`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP
+				WHERE token_hash = $1 AND used_at IS NULL
+				RETURNING token_hash, user_id, family, expires_at`, hash).StructScan(&token)
+	if err == nil {
+		return &token, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.db.QueryRowxContext(ctx,
+		"SELECT token_hash, user_id, family, expires_at FROM refresh_tokens WHERE token_hash = $1", hash).StructScan(&token); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, server.ErrInvalidToken
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &token, server.ErrTokenReused
+}
+
+func (s *Storage) RevokeRefreshTokens(ctx context.Context, family string) error {
+	const op = "storage.postgres.RevokeRefreshTokens"
+
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE family = $1", family); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// GetSessionVersion returns the version session tokens of the user must
+// carry to be valid.
+func (s *Storage) GetSessionVersion(ctx context.Context, userId uint) (uint, error) {
+	const op = "storage.postgres.GetSessionVersion"
+
+	var version uint
+	if err := s.db.QueryRowxContext(ctx, "SELECT session_version FROM users WHERE id = $1", userId).Scan(&version); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, server.ErrUserNotFound
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return version, nil
+}
+
+// RevokeSessions bumps the session version of the user, so that tokens
+// issued before are no longer valid.
+func (s *Storage) RevokeSessions(ctx context.Context, userId uint) error {
+	const op = "storage.postgres.RevokeSessions"
+
+	res, err := s.db.ExecContext(ctx, "UPDATE users SET session_version = session_version + 1 WHERE id = $1", userId)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if n == 0 {
+		return server.ErrUserNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package postgres_test
+
+import (
+	"context"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"github.com/rmntim/ozon-task/internal/storage/postgres"
+	"github.com/rmntim/ozon-task/internal/storage/storagetest"
+	"os"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newStorage(t)
+	})
+}
+
+func TestMigrationVersion(t *testing.T) {
+	s := newStorage(t)
+
+	version, dirty, err := s.MigrationVersion(context.Background())
+	if err != nil {
+		t.Fatal("migration version should be read:", err)
+	}
+	if version < 8 || dirty {
+		t.Error("all migrations should be applied cleanly, got version", version)
+	}
+}
+
+// newStorage connects to the database from TEST_DATABASE_* variables,
+// skipping the test if there's none.
+func newStorage(t *testing.T) *postgres.Storage {
+	t.Helper()
+
+	address := os.Getenv("TEST_DATABASE_ADDRESS")
+	if address == "" {
+		t.Skip("TEST_DATABASE_ADDRESS is not set")
+	}
+
+	s, err := postgres.New(
+		os.Getenv("TEST_DATABASE_USER"),
+		os.Getenv("TEST_DATABASE_PASSWORD"),
+		address,
+		os.Getenv("TEST_DATABASE_NAME"),
+	)
+	if err != nil {
+		t.Fatal("postgres storage should be created:", err)
+	}
+	t.Cleanup(func() {
+		if err := s.Close(); err != nil {
+			t.Error("postgres storage should be closed:", err)
+		}
+	})
+
+	// Migrations are looked up relative to the project root.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir("../../.."); err != nil {
+		t.Fatal(err)
+	}
+	err = s.Migrate()
+	if err := os.Chdir(wd); err != nil {
+		t.Fatal(err)
+	}
+	if err != nil {
+		t.Fatal("migrations should be applied:", err)
+	}
+
+	return s
+}
@@ -0,0 +1,169 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/rmntim/ozon-task/internal/lib/logger/sl"
+	"github.com/rmntim/ozon-task/internal/lib/pubsub"
+	"log/slog"
+	"time"
+)
+
+const (
+	minReconnectInterval = 10 * time.Second
+	maxReconnectInterval = time.Minute
+	// pingInterval is how often an idle listener checks its connection.
+	pingInterval = 90 * time.Second
+	// loadTimeout bounds loading of a single event object.
+	loadTimeout = 5 * time.Second
+	// loadWorkers is how many event objects are loaded at once.
+	loadWorkers = 8
+	// loadQueueSize is how many events wait for every worker. Events
+	// arriving while the queue is full are dropped.
+	loadQueueSize = 64
+	// notifyTimeout bounds sending of a single notification.
+	notifyTimeout = 5 * time.Second
+)
+
+// Relay carries subscription events between server instances through
+// LISTEN/NOTIFY. Payloads of notifications are limited, so only topic
+// and ID of an event are sent, and every instance loads the object
+// itself before delivering it to local subscribers.
+type Relay struct {
+	storage  *Storage
+	listener *pq.Listener
+	log      *slog.Logger
+	handlers map[string]func(ctx context.Context, n notification)
+}
+
+type notification struct {
+	Topic string `json:"topic"`
+	ID    uint   `json:"id"`
+}
+
+// NewRelay opens a connection dedicated to listening for notifications.
+func (s *Storage) NewRelay(log *slog.Logger) *Relay {
+	listener := pq.NewListener(s.url, minReconnectInterval, maxReconnectInterval,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Error("event listener connection failed", sl.Err(err))
+			}
+		})
+
+	return &Relay{
+		storage:  s,
+		listener: listener,
+		log:      log,
+		handlers: make(map[string]func(ctx context.Context, n notification)),
+	}
+}
+
+// Forward makes broker publish events through channel. id and load
+// convert event objects to IDs and back. It must be called before Run.
+func Forward[T any](
+	r *Relay,
+	channel string,
+	broker *pubsub.Broker[T],
+	id func(T) uint,
+	load func(ctx context.Context, id uint) (T, error),
+) error {
+	const op = "storage.postgres.Forward"
+
+	if err := r.listener.Listen(channel); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	r.handlers[channel] = func(ctx context.Context, n notification) {
+		ctx, cancel := context.WithTimeout(ctx, loadTimeout)
+		defer cancel()
+
+		event, err := load(ctx, n.ID)
+		if err != nil {
+			r.log.Error("failed to load event", slog.String("topic", n.Topic), sl.Err(err))
+			return
+		}
+		broker.Deliver(n.Topic, event)
+	}
+
+	broker.ForwardTo(&forwarder[T]{relay: r, channel: channel, broker: broker, id: id})
+
+	return nil
+}
+
+// Run dispatches notifications until ctx is done or the relay is closed.
+// Event objects are loaded by workers, so that a slow load doesn't hold
+// up receiving notifications. Events of one topic keep their order.
+func (r *Relay) Run(ctx context.Context) {
+	loads := newWorkers(loadWorkers, loadQueueSize)
+	defer loads.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case n, ok := <-r.listener.Notify:
+			if !ok {
+				return
+			}
+			if n == nil {
+				// Notifications sent while the connection was down are lost.
+				r.log.Warn("event listener reconnected, some events might be missed")
+				continue
+			}
+			r.dispatch(ctx, loads, n)
+		case <-time.After(pingInterval):
+			go r.listener.Ping()
+		}
+	}
+}
+
+func (r *Relay) Close() error {
+	return r.listener.Close()
+}
+
+func (r *Relay) dispatch(ctx context.Context, loads *workers, n *pq.Notification) {
+	handle, ok := r.handlers[n.Channel]
+	if !ok {
+		return
+	}
+
+	var payload notification
+	if err := json.Unmarshal([]byte(n.Extra), &payload); err != nil {
+		r.log.Error("malformed event", slog.String("channel", n.Channel), sl.Err(err))
+		return
+	}
+
+	load := func() {
+		// Events left in queues on shutdown can't be loaded anyway.
+		if ctx.Err() == nil {
+			handle(ctx, payload)
+		}
+	}
+	if !loads.Submit(n.Channel+"/"+payload.Topic, load) {
+		r.log.Warn("too many events to load, event dropped", slog.String("topic", payload.Topic))
+	}
+}
+
+type forwarder[T any] struct {
+	relay   *Relay
+	channel string
+	broker  *pubsub.Broker[T]
+	id      func(T) uint
+}
+
+// Forward notifies every instance, including this one. If that fails,
+// the event is at least delivered to local subscribers.
+func (f *forwarder[T]) Forward(topic string, event T) {
+	payload, err := json.Marshal(notification{Topic: topic, ID: f.id(event)})
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+		_, err = f.relay.storage.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", f.channel, string(payload))
+	}
+	if err != nil {
+		f.relay.log.Error("failed to notify about event", slog.String("topic", topic), sl.Err(err))
+		f.broker.Deliver(topic, event)
+	}
+}
@@ -0,0 +1,59 @@
+package postgres_test
+
+import (
+	"context"
+	"github.com/rmntim/ozon-task/internal/lib/pubsub"
+	"github.com/rmntim/ozon-task/internal/lib/random"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/storage/postgres"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestRelay(t *testing.T) {
+	first, second := newStorage(t), newStorage(t)
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Two relays stand for two server instances sharing the database.
+	publisher := pubsub.New[*models.Post](1, pubsub.Drop)
+	subscriber := pubsub.New[*models.Post](1, pubsub.Drop)
+	for _, r := range []struct {
+		storage *postgres.Storage
+		broker  *pubsub.Broker[*models.Post]
+	}{{first, publisher}, {second, subscriber}} {
+		relay := r.storage.NewRelay(log)
+		t.Cleanup(func() { relay.Close() })
+		if err := postgres.Forward(relay, "test_post_events", r.broker,
+			func(p *models.Post) uint { return p.ID }, r.storage.GetPostById); err != nil {
+			t.Fatal("relay should listen:", err)
+		}
+		go relay.Run(ctx)
+	}
+
+	events := subscriber.Subscribe(ctx, "post.created")
+
+	name := random.NewRandomString(16)
+	user, err := first.CreateUser(ctx, name, name+"@example.com", "password")
+	if err != nil {
+		t.Fatal("user should be created:", err)
+	}
+	post, err := first.CreatePost(ctx, "title", "content", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created:", err)
+	}
+
+	publisher.Publish("post.created", post)
+
+	select {
+	case got := <-events:
+		if got.ID != post.ID {
+			t.Error("other instance should receive the published post")
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("event should be relayed to other instance")
+	}
+}
@@ -0,0 +1,56 @@
+package postgres
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// workers run jobs on a fixed number of goroutines, so that a slow job
+// only holds up the jobs queued behind it. Jobs with the same key run
+// on the same goroutine, one after another, so they keep their order.
+type workers struct {
+	queues []chan func()
+	wg     sync.WaitGroup
+}
+
+// newWorkers starts n goroutines, each with a queue of size jobs.
+func newWorkers(n, size int) *workers {
+	w := &workers{queues: make([]chan func(), n)}
+	for i := range w.queues {
+		queue := make(chan func(), size)
+		w.queues[i] = queue
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for job := range queue {
+				job()
+			}
+		}()
+	}
+	return w
+}
+
+// Submit queues the job without blocking. It reports false if the
+// queue of the key is full and the job was dropped.
+func (w *workers) Submit(key string, job func()) bool {
+	select {
+	case w.queues[w.shard(key)] <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close waits for queued jobs to finish. Submit must not be called after.
+func (w *workers) Close() {
+	for _, queue := range w.queues {
+		close(queue)
+	}
+	w.wg.Wait()
+}
+
+func (w *workers) shard(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(w.queues)))
+}
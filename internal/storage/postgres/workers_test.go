@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkers(t *testing.T) {
+	w := newWorkers(2, 1)
+
+	// Keys of both workers, so that one can be blocked while the other runs.
+	slow, fast := "slow", ""
+	for i := 0; fast == ""; i++ {
+		if key := strconv.Itoa(i); w.shard(key) != w.shard(slow) {
+			fast = key
+		}
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	if !w.Submit(slow, func() {
+		close(started)
+		<-release
+	}) {
+		t.Fatal("job should be queued")
+	}
+	<-started
+
+	done := make(chan struct{})
+	if !w.Submit(fast, func() { close(done) }) {
+		t.Fatal("job should be queued")
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("job of another worker should not wait for a slow one")
+	}
+
+	var mu sync.Mutex
+	var order []int
+	for i := 0; i < 2; i++ {
+		ok := w.Submit(slow, func() {
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, i)
+		})
+		if i == 0 && !ok {
+			t.Fatal("job should be queued")
+		}
+		if i == 1 && ok {
+			t.Error("job should be dropped when the queue is full")
+		}
+	}
+
+	close(release)
+	w.Close()
+	if !slices.Equal(order, []int{0}) {
+		t.Error("queued jobs should run before Close returns, got", order)
+	}
+}
@@ -11,23 +11,64 @@ import (
 
 type Storage interface {
 	CreateUser(ctx context.Context, username string, email string, password string) (*models.User, error)
-	CreatePost(ctx context.Context, title string, content string, authorId uint) (*models.Post, error)
+	CreatePost(ctx context.Context, title string, content string, authorId uint, hubIds []uint) (*models.Post, error)
 	CreateComment(ctx context.Context, content string, authorId uint, postId uint, parentCommentId *uint) (*models.Comment, error)
 	GetUserById(ctx context.Context, id uint) (*models.User, error)
-	GetUsers(ctx context.Context, limit int, offset int) ([]*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
+	SetUserRole(ctx context.Context, userId uint, role models.Role) error
+	GetUsers(ctx context.Context, page models.Page) ([]*models.User, error)
 	GetPostById(ctx context.Context, id uint) (*models.Post, error)
-	GetPosts(ctx context.Context, limit int, offset int) ([]*models.Post, error)
+	GetPosts(ctx context.Context, page models.Page) ([]*models.Post, error)
 	GetCommentById(ctx context.Context, id uint) (*models.Comment, error)
-	GetComments(ctx context.Context, limit int, offset int) ([]*models.Comment, error)
+	GetComments(ctx context.Context, page models.Page) ([]*models.Comment, error)
 	ToggleComments(ctx context.Context, postId uint, userId uint) (bool, error)
-	GetPostsFromUser(ctx context.Context, userId uint) ([]*models.Post, error)
-	GetReplies(ctx context.Context, commentId uint) ([]*models.Comment, error)
-	GetCommentsForPost(ctx context.Context, postId uint) ([]*models.Comment, error)
+	UpdatePost(ctx context.Context, id uint, userId uint, title string, content string) (*models.Post, error)
+	UpdateComment(ctx context.Context, id uint, userId uint, content string) (*models.Comment, error)
+	DeletePost(ctx context.Context, id uint) error
+	DeleteComment(ctx context.Context, id uint) error
+	VotePost(ctx context.Context, postId uint, userId uint, value int) (*models.Post, error)
+	VoteComment(ctx context.Context, commentId uint, userId uint, value int) (*models.Comment, error)
+	GetPostVotes(ctx context.Context, userId uint, postIds []uint) ([]*models.Vote, error)
+	GetCommentVotes(ctx context.Context, userId uint, commentIds []uint) ([]*models.Vote, error)
+	GetPostsFromUser(ctx context.Context, userId uint, page models.Page) ([]*models.Post, error)
+	GetReplies(ctx context.Context, commentId uint, page models.Page, includeDeleted bool) ([]*models.Comment, error)
+	GetCommentsForPost(ctx context.Context, postId uint, page models.Page, includeDeleted bool) ([]*models.Comment, error)
+	GetUsersByIds(ctx context.Context, ids []uint) ([]*models.User, error)
+	GetPostsByIds(ctx context.Context, ids []uint) ([]*models.Post, error)
+	GetCommentsByIds(ctx context.Context, ids []uint) ([]*models.Comment, error)
+	GetPostsByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Post, error)
+	GetCommentsByPostIds(ctx context.Context, postIds []uint, page models.Page, includeDeleted bool) ([]*models.Comment, error)
+	GetRepliesByCommentIds(ctx context.Context, commentIds []uint, page models.Page, includeDeleted bool) ([]*models.Comment, error)
+	CreateHub(ctx context.Context, slug string, title string, description string) (*models.Hub, error)
+	GetHubById(ctx context.Context, id uint) (*models.Hub, error)
+	GetHubBySlug(ctx context.Context, slug string) (*models.Hub, error)
+	SubscribeHub(ctx context.Context, hubId uint, userId uint) (*models.Hub, error)
+	UnsubscribeHub(ctx context.Context, hubId uint, userId uint) (*models.Hub, error)
+	GetPostsFromHub(ctx context.Context, hubId uint, page models.Page) ([]*models.Post, error)
+	FollowUser(ctx context.Context, userId uint, followerId uint) (*models.User, error)
+	UnfollowUser(ctx context.Context, userId uint, followerId uint) (*models.User, error)
+	GetFollowers(ctx context.Context, userId uint, page models.Page) ([]*models.User, error)
+	GetFollowing(ctx context.Context, userId uint, page models.Page) ([]*models.User, error)
+	GetFollowersByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Follow, error)
+	GetFollowingByUserIds(ctx context.Context, userIds []uint, page models.Page) ([]*models.Follow, error)
+	GetFeed(ctx context.Context, userId uint, page models.Page) ([]*models.Post, error)
+	GetCommentTree(ctx context.Context, query models.TreeQuery) (*models.CommentTree, error)
+	Search(ctx context.Context, query models.SearchQuery) ([]*models.SearchHit, error)
+	GetPostRevisionsByPostIds(ctx context.Context, postIds []uint) ([]*models.PostRevision, error)
+	GetCommentRevisionsByCommentIds(ctx context.Context, commentIds []uint) ([]*models.CommentRevision, error)
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	UseRefreshToken(ctx context.Context, hash string) (*models.RefreshToken, error)
+	RevokeRefreshTokens(ctx context.Context, family string) error
+	GetSessionVersion(ctx context.Context, userId uint) (uint, error)
+	RevokeSessions(ctx context.Context, userId uint) error
+	Ping(ctx context.Context) error
+	Close() error
 }
 
 // New creates new storage instance, depending on storage type.
-func New(storageType string, dbCfg *config.DBConfig) (Storage, error) {
-	switch storageType {
+// Persistent `memory` storage must be run and closed, see inmemory.Open.
+func New(cfg *config.Config, dbCfg *config.DBConfig) (Storage, error) {
+	switch cfg.Storage {
 	case "postgres":
 		db, err := postgres.New(dbCfg.Username, dbCfg.Password, dbCfg.Address, dbCfg.Database)
 		if err != nil {
@@ -38,7 +79,15 @@ func New(storageType string, dbCfg *config.DBConfig) (Storage, error) {
 		}
 		return db, nil
 	case "memory":
-		return inmemory.New(), nil
+		if cfg.Snapshot.Path == "" {
+			return inmemory.New(), nil
+		}
+		return inmemory.Open(inmemory.Options{
+			Path:             cfg.Snapshot.Path,
+			Format:           cfg.Snapshot.Format,
+			SnapshotInterval: cfg.Snapshot.Interval,
+			SyncInterval:     cfg.Snapshot.SyncInterval,
+		})
 	}
-	return nil, fmt.Errorf("unknown storage type: %s", storageType)
+	return nil, fmt.Errorf("unknown storage type: %s", cfg.Storage)
 }
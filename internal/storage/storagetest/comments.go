@@ -0,0 +1,352 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"slices"
+	"testing"
+)
+
+func testComments(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	post := createPost(t, db, user)
+
+	comment, err := db.CreateComment(ctx, "content", user.ID, post.ID, nil)
+	if err != nil {
+		t.Fatal("comment should be created:", err)
+	}
+	if comment.Content != "content" || comment.AuthorID != user.ID || comment.PostID != post.ID || comment.ParentCommentID != nil {
+		t.Error("comment should have the given fields")
+	}
+
+	reply, err := db.CreateComment(ctx, "reply", user.ID, post.ID, &comment.ID)
+	if err != nil {
+		t.Fatal("reply should be created:", err)
+	}
+	if reply.ParentCommentID == nil || *reply.ParentCommentID != comment.ID {
+		t.Error("reply should point at its parent")
+	}
+
+	got, err := db.GetCommentById(ctx, comment.ID)
+	if err != nil {
+		t.Fatal("comment should be found:", err)
+	}
+	if !sameComment(got, comment) {
+		t.Error("found comment should be the created one")
+	}
+	if !slices.Equal(sorted(got.RepliesIDs), []uint{reply.ID}) {
+		t.Error("comment should list its replies, got:", got.RepliesIDs)
+	}
+
+	withComments, err := db.GetPostById(ctx, post.ID)
+	if err != nil {
+		t.Fatal("post should be found:", err)
+	}
+	if !slices.Equal(sorted(withComments.CommentsIDs), []uint{comment.ID, reply.ID}) {
+		t.Error("post should list all its comments, got:", withComments.CommentsIDs)
+	}
+
+	if _, err := db.GetCommentById(ctx, missingID); !errors.Is(err, server.ErrCommentNotFound) {
+		t.Error("missing comment should not be found, got:", err)
+	}
+
+	comments, err := db.GetCommentsByIds(ctx, []uint{reply.ID, missingID, comment.ID})
+	if err != nil {
+		t.Fatal("comments should be found:", err)
+	}
+	found := ids(comments, commentID)
+	slices.Sort(found)
+	if !slices.Equal(found, []uint{comment.ID, reply.ID}) {
+		t.Error("only existing comments should be found, got:", found)
+	}
+}
+
+func testCommentsPage(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	post := createPost(t, db, user)
+	first, _, last := createComment(t, db, user, post, nil), createComment(t, db, user, post, nil), createComment(t, db, user, post, nil)
+
+	comments, err := db.GetComments(ctx, window(first.ID, last.ID, 1, false))
+	if err != nil {
+		t.Fatal("comments should be found:", err)
+	}
+	if !slices.Equal(ids(comments, commentID), []uint{first.ID}) {
+		t.Error("page should start right after the cursor")
+	}
+
+	comments, err = db.GetComments(ctx, window(first.ID, last.ID, 1, true))
+	if err != nil {
+		t.Fatal("comments should be found:", err)
+	}
+	if !slices.Equal(ids(comments, commentID), []uint{last.ID}) {
+		t.Error("page from end should end right before the cursor")
+	}
+}
+
+func testCommentsByPostIds(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	post, other, empty := createPost(t, db, user), createPost(t, db, user), createPost(t, db, user)
+
+	first := createComment(t, db, user, post, nil)
+	reply := createComment(t, db, user, post, first)
+	deleted := createComment(t, db, user, post, nil)
+	otherComment := createComment(t, db, user, other, nil)
+	if err := db.DeleteComment(ctx, deleted.ID); err != nil {
+		t.Fatal("comment should be deleted:", err)
+	}
+
+	comments, err := db.GetCommentsForPost(ctx, post.ID, models.Page{Limit: 10}, true)
+	if err != nil {
+		t.Fatal("comments should be found:", err)
+	}
+	if !slices.Equal(ids(comments, commentID), []uint{first.ID, reply.ID, deleted.ID}) {
+		t.Error("all comments of the post should be found in order")
+	}
+
+	comments, err = db.GetCommentsForPost(ctx, post.ID, models.Page{Limit: 10}, false)
+	if err != nil {
+		t.Fatal("comments should be found:", err)
+	}
+	if !slices.Equal(ids(comments, commentID), []uint{first.ID, reply.ID}) {
+		t.Error("deleted comments should be skipped")
+	}
+
+	comments, err = db.GetCommentsByPostIds(ctx, []uint{post.ID, other.ID, empty.ID}, models.Page{Limit: 1}, true)
+	if err != nil {
+		t.Fatal("comments should be found:", err)
+	}
+	if !slices.Equal(ids(comments, commentID), []uint{first.ID, otherComment.ID}) {
+		t.Error("page should be applied to every post separately")
+	}
+
+	comments, err = db.GetCommentsForPost(ctx, post.ID, models.Page{Limit: 1, FromEnd: true, Before: models.Cursor{ID: deleted.ID, Valid: true}}, true)
+	if err != nil {
+		t.Fatal("comments should be found:", err)
+	}
+	if !slices.Equal(ids(comments, commentID), []uint{reply.ID}) {
+		t.Error("page from end should end right before the cursor")
+	}
+}
+
+func testRepliesByCommentIds(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	post := createPost(t, db, user)
+
+	parent, other, childless := createComment(t, db, user, post, nil), createComment(t, db, user, post, nil), createComment(t, db, user, post, nil)
+	first := createComment(t, db, user, post, parent)
+	createComment(t, db, user, post, first)
+	deleted := createComment(t, db, user, post, parent)
+	otherReply := createComment(t, db, user, post, other)
+	if err := db.DeleteComment(ctx, deleted.ID); err != nil {
+		t.Fatal("comment should be deleted:", err)
+	}
+
+	replies, err := db.GetReplies(ctx, parent.ID, models.Page{Limit: 10}, true)
+	if err != nil {
+		t.Fatal("replies should be found:", err)
+	}
+	if !slices.Equal(ids(replies, commentID), []uint{first.ID, deleted.ID}) {
+		t.Error("only direct replies should be found in order")
+	}
+
+	replies, err = db.GetReplies(ctx, parent.ID, models.Page{Limit: 10}, false)
+	if err != nil {
+		t.Fatal("replies should be found:", err)
+	}
+	if !slices.Equal(ids(replies, commentID), []uint{first.ID}) {
+		t.Error("deleted replies should be skipped")
+	}
+
+	replies, err = db.GetRepliesByCommentIds(ctx, []uint{parent.ID, other.ID, childless.ID}, models.Page{Limit: 1}, true)
+	if err != nil {
+		t.Fatal("replies should be found:", err)
+	}
+	if !slices.Equal(ids(replies, commentID), []uint{first.ID, otherReply.ID}) {
+		t.Error("page should be applied to every comment separately")
+	}
+}
+
+func testCreateCommentErrors(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	post := createPost(t, db, user)
+	other := createPost(t, db, user)
+	parent := createComment(t, db, user, other, nil)
+
+	if _, err := db.CreateComment(ctx, "content", missingID, post.ID, nil); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("comment of missing user should be rejected, got:", err)
+	}
+
+	if _, err := db.CreateComment(ctx, "content", user.ID, missingID, nil); !errors.Is(err, server.ErrPostNotFound) {
+		t.Error("comment on missing post should be rejected, got:", err)
+	}
+
+	missingParent := uint(missingID)
+	if _, err := db.CreateComment(ctx, "content", user.ID, post.ID, &missingParent); !errors.Is(err, server.ErrCommentNotFound) {
+		t.Error("reply to missing comment should be rejected, got:", err)
+	}
+
+	if _, err := db.CreateComment(ctx, "content", user.ID, post.ID, &parent.ID); !errors.Is(err, server.ErrParentCommentMismatch) {
+		t.Error("reply to comment of another post should be rejected, got:", err)
+	}
+
+	if _, err := db.ToggleComments(ctx, post.ID, user.ID); err != nil {
+		t.Fatal("comments should be toggled:", err)
+	}
+	if _, err := db.CreateComment(ctx, "content", user.ID, post.ID, nil); !errors.Is(err, server.ErrCommentsDisabled) {
+		t.Error("comment on post with disabled comments should be rejected, got:", err)
+	}
+
+	if err := db.DeletePost(ctx, other.ID); err != nil {
+		t.Fatal("post should be deleted:", err)
+	}
+	if _, err := db.CreateComment(ctx, "content", user.ID, other.ID, nil); !errors.Is(err, server.ErrCommentsDisabled) {
+		t.Error("comment on deleted post should be rejected, got:", err)
+	}
+}
+
+func testCommentTree(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	post := createPost(t, db, user)
+
+	// a
+	// ├ b
+	// │ └ c
+	// └ d
+	// e
+	a := createComment(t, db, user, post, nil)
+	b := createComment(t, db, user, post, a)
+	c := createComment(t, db, user, post, b)
+	d := createComment(t, db, user, post, a)
+	e := createComment(t, db, user, post, nil)
+
+	type node struct {
+		id         uint
+		depth      int
+		childCount int
+	}
+	nodes := func(tree *models.CommentTree) []node {
+		res := make([]node, len(tree.Nodes))
+		for i, n := range tree.Nodes {
+			res[i] = node{n.ID, n.Depth, n.ChildCount}
+		}
+		return res
+	}
+
+	tree, err := db.GetCommentTree(ctx, models.TreeQuery{PostID: post.ID, MaxDepth: 10, Limit: 10})
+	if err != nil {
+		t.Fatal("tree should be loaded:", err)
+	}
+	if !slices.Equal(nodes(tree), []node{{a.ID, 0, 2}, {b.ID, 1, 1}, {c.ID, 2, 0}, {d.ID, 1, 0}, {e.ID, 0, 0}}) {
+		t.Error("whole thread should be loaded in pre-order, got:", nodes(tree))
+	}
+	if tree.Remaining != 2 {
+		t.Error("all first-level comments should be counted")
+	}
+
+	tree, err = db.GetCommentTree(ctx, models.TreeQuery{PostID: post.ID, MaxDepth: 2, Limit: 1})
+	if err != nil {
+		t.Fatal("tree should be loaded:", err)
+	}
+	if !slices.Equal(nodes(tree), []node{{a.ID, 0, 2}, {b.ID, 1, 1}}) {
+		t.Error("tree should be limited in depth and width, got:", nodes(tree))
+	}
+
+	tree, err = db.GetCommentTree(ctx, models.TreeQuery{PostID: post.ID, RootID: &a.ID, After: models.Cursor{ID: b.ID, Valid: true}, MaxDepth: 10, Limit: 10})
+	if err != nil {
+		t.Fatal("tree should be loaded:", err)
+	}
+	if !slices.Equal(nodes(tree), []node{{d.ID, 1, 0}}) || tree.Remaining != 1 {
+		t.Error("replies of the root after the cursor should be loaded, got:", nodes(tree))
+	}
+}
+
+func testUpdateComment(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user, other := createUser(t, db), createUser(t, db)
+	post := createPost(t, db, user)
+	comment := createComment(t, db, user, post, nil)
+
+	updated, err := db.UpdateComment(ctx, comment.ID, user.ID, "new content")
+	if err != nil {
+		t.Fatal("comment should be updated:", err)
+	}
+	if updated.Content != "new content" || updated.EditedAt == nil {
+		t.Error("comment should be edited")
+	}
+
+	revisions, err := db.GetCommentRevisionsByCommentIds(ctx, []uint{comment.ID, missingID})
+	if err != nil {
+		t.Fatal("revisions should be found:", err)
+	}
+	if len(revisions) != 1 || revisions[0].Content != "content" || revisions[0].CommentID != comment.ID {
+		t.Error("previous version should be kept")
+	}
+
+	if _, err := db.UpdateComment(ctx, comment.ID, other.ID, "content"); !errors.Is(err, server.ErrUnauthorized) {
+		t.Error("only author should update the comment, got:", err)
+	}
+
+	if _, err := db.UpdateComment(ctx, missingID, user.ID, "content"); !errors.Is(err, server.ErrCommentNotFound) {
+		t.Error("missing comment should not be updated, got:", err)
+	}
+
+	if err := db.DeleteComment(ctx, comment.ID); err != nil {
+		t.Fatal("comment should be deleted:", err)
+	}
+	if _, err := db.UpdateComment(ctx, comment.ID, user.ID, "content"); !errors.Is(err, server.ErrCommentNotFound) {
+		t.Error("deleted comment should not be updated, got:", err)
+	}
+}
+
+func testDeleteComment(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	post := createPost(t, db, user)
+	comment := createComment(t, db, user, post, nil)
+	reply := createComment(t, db, user, post, comment)
+
+	if err := db.DeleteComment(ctx, comment.ID); err != nil {
+		t.Fatal("comment should be deleted:", err)
+	}
+
+	deleted, err := db.GetCommentById(ctx, comment.ID)
+	if err != nil {
+		t.Fatal("deleted comment should still be found:", err)
+	}
+	if deleted.DeletedAt == nil {
+		t.Error("deleted comment should be marked")
+	}
+
+	if err := db.DeleteComment(ctx, comment.ID); err != nil {
+		t.Fatal("deleting deleted comment should succeed:", err)
+	}
+	if again, err := db.GetCommentById(ctx, comment.ID); err != nil || !again.DeletedAt.Equal(*deleted.DeletedAt) {
+		t.Error("deletion time should be kept")
+	}
+
+	if got, err := db.GetCommentById(ctx, reply.ID); err != nil || got.DeletedAt != nil {
+		t.Error("replies should be kept")
+	}
+
+	if err := db.DeleteComment(ctx, missingID); !errors.Is(err, server.ErrCommentNotFound) {
+		t.Error("missing comment should not be deleted, got:", err)
+	}
+}
+
+// sameComment compares fields both storages fill the same way.
+func sameComment(a, b *models.Comment) bool {
+	return a.ID == b.ID &&
+		a.Content == b.Content &&
+		a.AuthorID == b.AuthorID &&
+		a.PostID == b.PostID &&
+		a.CreatedAt.Equal(b.CreatedAt)
+}
@@ -0,0 +1,207 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"slices"
+	"testing"
+)
+
+func testFollows(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user, first, second := createUser(t, db), createUser(t, db), createUser(t, db)
+
+	steps := []struct {
+		follow    bool
+		follower  *models.User
+		followers int
+	}{
+		{true, first, 1},
+		{true, first, 1},
+		{true, second, 2},
+		{false, first, 1},
+		{false, first, 1},
+	}
+	for _, step := range steps {
+		change := db.UnfollowUser
+		if step.follow {
+			change = db.FollowUser
+		}
+		got, err := change(ctx, user.ID, step.follower.ID)
+		if err != nil {
+			t.Fatal("following should be changed:", err)
+		}
+		if got.ID != user.ID || got.FollowersCount != step.followers {
+			t.Errorf("user should have %d followers, got %d", step.followers, got.FollowersCount)
+		}
+	}
+
+	if got, err := db.GetUserById(ctx, user.ID); err != nil || got.FollowersCount != 1 {
+		t.Error("found user should have the followers counted, got:", err)
+	}
+	if got, err := db.GetFollowers(ctx, user.ID, models.Page{Limit: 10}); err != nil || !slices.Equal(ids(got, userID), []uint{second.ID}) {
+		t.Error("follower should be found, got:", err)
+	}
+	if got, err := db.GetFollowing(ctx, second.ID, models.Page{Limit: 10}); err != nil || !slices.Equal(ids(got, userID), []uint{user.ID}) {
+		t.Error("followed user should be found, got:", err)
+	}
+
+	if _, err := db.FollowUser(ctx, missingID, user.ID); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("missing user should not be followed, got:", err)
+	}
+	if _, err := db.FollowUser(ctx, user.ID, missingID); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("missing user should not follow, got:", err)
+	}
+	if _, err := db.UnfollowUser(ctx, missingID, user.ID); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("missing user should not be unfollowed, got:", err)
+	}
+	if _, err := db.FollowUser(ctx, user.ID, user.ID); !errors.Is(err, server.ErrSelfFollow) {
+		t.Error("user should not follow themselves, got:", err)
+	}
+}
+
+func testFollowPages(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	others := []*models.User{createUser(t, db), createUser(t, db), createUser(t, db)}
+	for _, other := range others {
+		if _, err := db.FollowUser(ctx, user.ID, other.ID); err != nil {
+			t.Fatal("user should be followed:", err)
+		}
+		if _, err := db.FollowUser(ctx, other.ID, user.ID); err != nil {
+			t.Fatal("user should be followed:", err)
+		}
+	}
+	want := ids(others, userID)
+
+	lists := []struct {
+		name string
+		get  func(ctx context.Context, userId uint, page models.Page) ([]*models.User, error)
+	}{
+		{"followers", db.GetFollowers},
+		{"following", db.GetFollowing},
+	}
+	for _, list := range lists {
+		name := list.name
+		page := func(page models.Page) []uint {
+			t.Helper()
+			users, err := list.get(ctx, user.ID, page)
+			if err != nil {
+				t.Fatal(name, "should be found:", err)
+			}
+			return ids(users, userID)
+		}
+
+		if got := page(models.Page{Limit: 2}); !slices.Equal(got, want[:2]) {
+			t.Error("first page of", name, "should be found, got", got)
+		}
+		if got := page(models.Page{Limit: 2, After: models.Cursor{ID: want[0], Valid: true}}); !slices.Equal(got, want[1:]) {
+			t.Error("page of", name, "should be bounded by the cursor, got", got)
+		}
+		if got := page(models.Page{Limit: 1, Before: models.Cursor{ID: want[2], Valid: true}, FromEnd: true}); !slices.Equal(got, want[1:2]) {
+			t.Error("page of", name, "from the end should be closest to before cursor, got", got)
+		}
+	}
+}
+
+func testFollowsByUserIds(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user, other, idle := createUser(t, db), createUser(t, db), createUser(t, db)
+	first, second, third := createUser(t, db), createUser(t, db), createUser(t, db)
+	for _, follow := range []struct{ user, follower *models.User }{
+		{user, first}, {user, second}, {user, third}, {other, first},
+	} {
+		if _, err := db.FollowUser(ctx, follow.user.ID, follow.follower.ID); err != nil {
+			t.Fatal("user should be followed:", err)
+		}
+	}
+
+	pairs := func(follows []*models.Follow) [][2]uint {
+		res := make([][2]uint, len(follows))
+		for i, f := range follows {
+			res[i] = [2]uint{f.TargetID, f.ID}
+		}
+		return res
+	}
+
+	follows, err := db.GetFollowersByUserIds(ctx, []uint{user.ID, other.ID, idle.ID}, models.Page{Limit: 2})
+	if err != nil {
+		t.Fatal("followers should be found:", err)
+	}
+	if got := pairs(follows); !slices.Equal(got, [][2]uint{{user.ID, first.ID}, {user.ID, second.ID}, {other.ID, first.ID}}) {
+		t.Error("page of followers should be applied to every user separately, got", got)
+	}
+
+	follows, err = db.GetFollowingByUserIds(ctx, []uint{first.ID, idle.ID}, models.Page{Limit: 1, FromEnd: true})
+	if err != nil {
+		t.Fatal("followed users should be found:", err)
+	}
+	if got := pairs(follows); !slices.Equal(got, [][2]uint{{first.ID, other.ID}}) {
+		t.Error("page of followed users from end should hold the last one, got", got)
+	}
+}
+
+func testFeed(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	reader, author, other := createUser(t, db), createUser(t, db), createUser(t, db)
+	hub := createHub(t, db)
+
+	create := func(author *models.User, hubIds ...uint) *models.Post {
+		t.Helper()
+		post, err := db.CreatePost(ctx, "title", "content", author.ID, hubIds)
+		if err != nil {
+			t.Fatal("post should be created:", err)
+		}
+		return post
+	}
+	byAuthor := create(author)
+	create(other)
+	inHub := create(other, hub.ID)
+	both := create(author, hub.ID)
+	create(reader)
+	for _, deleted := range []*models.Post{create(author), create(other, hub.ID)} {
+		if err := db.DeletePost(ctx, deleted.ID); err != nil {
+			t.Fatal("post should be deleted:", err)
+		}
+	}
+
+	feed := func(page models.Page) []uint {
+		t.Helper()
+		posts, err := db.GetFeed(ctx, reader.ID, page)
+		if err != nil {
+			t.Fatal("feed should be found:", err)
+		}
+		return ids(posts, postID)
+	}
+
+	if got := feed(models.Page{Limit: 10, Order: models.OrderNew}); len(got) != 0 {
+		t.Error("feed should be empty until the user follows anyone, got", got)
+	}
+
+	if _, err := db.FollowUser(ctx, author.ID, reader.ID); err != nil {
+		t.Fatal("user should be followed:", err)
+	}
+	if _, err := db.SubscribeHub(ctx, hub.ID, reader.ID); err != nil {
+		t.Fatal("hub should be subscribed to:", err)
+	}
+
+	if got := feed(models.Page{Limit: 10, Order: models.OrderNew}); !slices.Equal(got, []uint{both.ID, inHub.ID, byAuthor.ID}) {
+		t.Error("posts of followed users and subscribed hubs should be found once, newest first, got", got)
+	}
+	if got := feed(models.Page{Limit: 1, Order: models.OrderNew}); !slices.Equal(got, []uint{both.ID}) {
+		t.Error("deleted posts should not take up the feed page, got", got)
+	}
+	if got := feed(models.Page{Limit: 1, After: models.Cursor{ID: both.ID, Valid: true}, Order: models.OrderNew}); !slices.Equal(got, []uint{inHub.ID}) {
+		t.Error("page of the feed should be bounded by the cursor, got", got)
+	}
+
+	if _, err := db.UnfollowUser(ctx, author.ID, reader.ID); err != nil {
+		t.Fatal("user should be unfollowed:", err)
+	}
+	if got := feed(models.Page{Limit: 10, Order: models.OrderNew}); !slices.Equal(got, []uint{both.ID, inHub.ID}) {
+		t.Error("posts of unfollowed users should only be found in subscribed hubs, got", got)
+	}
+}
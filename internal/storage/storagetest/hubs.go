@@ -0,0 +1,161 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/lib/random"
+	"github.com/rmntim/ozon-task/internal/lib/validation"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func testHubs(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	slug := uniqueSlug()
+
+	hub, err := db.CreateHub(ctx, slug, "Go", "All about Go")
+	if err != nil {
+		t.Fatal("hub should be created:", err)
+	}
+	if hub.Slug != slug || hub.Title != "Go" || hub.Description != "All about Go" || hub.SubscribersCount != 0 {
+		t.Error("hub should have the given fields and no subscribers")
+	}
+
+	if _, err := db.CreateHub(ctx, slug, "Other", ""); !errors.Is(err, server.ErrHubSlugTaken) {
+		t.Error("slug should be unique, got:", err)
+	}
+	var errs validation.Errors
+	if _, err := db.CreateHub(ctx, "Not a slug", "Other", ""); !errors.As(err, &errs) {
+		t.Error("invalid slug should be rejected, got:", err)
+	}
+
+	got, err := db.GetHubBySlug(ctx, slug)
+	if err != nil {
+		t.Fatal("hub should be found by slug:", err)
+	}
+	if got.ID != hub.ID || got.Title != hub.Title || !got.CreatedAt.Equal(hub.CreatedAt) {
+		t.Error("found hub should be the created one")
+	}
+	if got, err := db.GetHubById(ctx, hub.ID); err != nil || got.Slug != slug {
+		t.Error("hub should be found by ID, got:", err)
+	}
+
+	if _, err := db.GetHubBySlug(ctx, uniqueSlug()); !errors.Is(err, server.ErrHubNotFound) {
+		t.Error("missing hub should not be found by slug, got:", err)
+	}
+	if _, err := db.GetHubById(ctx, missingID); !errors.Is(err, server.ErrHubNotFound) {
+		t.Error("missing hub should not be found by ID, got:", err)
+	}
+}
+
+func testHubSubscriptions(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	hub := createHub(t, db)
+	user, other := createUser(t, db), createUser(t, db)
+
+	steps := []struct {
+		subscribe   bool
+		user        *models.User
+		subscribers int
+	}{
+		{true, user, 1},
+		{true, user, 1},
+		{true, other, 2},
+		{false, user, 1},
+		{false, user, 1},
+	}
+	for _, step := range steps {
+		change := db.UnsubscribeHub
+		if step.subscribe {
+			change = db.SubscribeHub
+		}
+		got, err := change(ctx, hub.ID, step.user.ID)
+		if err != nil {
+			t.Fatal("subscription should be changed:", err)
+		}
+		if got.SubscribersCount != step.subscribers {
+			t.Errorf("hub should have %d subscribers, got %d", step.subscribers, got.SubscribersCount)
+		}
+	}
+
+	if _, err := db.SubscribeHub(ctx, missingID, user.ID); !errors.Is(err, server.ErrHubNotFound) {
+		t.Error("missing hub should not be subscribed to, got:", err)
+	}
+	if _, err := db.UnsubscribeHub(ctx, missingID, user.ID); !errors.Is(err, server.ErrHubNotFound) {
+		t.Error("missing hub should not be unsubscribed from, got:", err)
+	}
+	if _, err := db.SubscribeHub(ctx, hub.ID, missingID); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("missing user should not subscribe, got:", err)
+	}
+}
+
+func testHubPosts(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user, voter := createUser(t, db), createUser(t, db)
+	hub, other := createHub(t, db), createHub(t, db)
+
+	create := func(hubIds ...uint) *models.Post {
+		t.Helper()
+		post, err := db.CreatePost(ctx, "title", "content", user.ID, hubIds)
+		if err != nil {
+			t.Fatal("post should be created:", err)
+		}
+		return post
+	}
+	first, second, elsewhere, third := create(hub.ID, other.ID, hub.ID), create(hub.ID), create(other.ID), create(hub.ID)
+	create()
+
+	get := func(hub *models.Hub, page models.Page) []uint {
+		t.Helper()
+		posts, err := db.GetPostsFromHub(ctx, hub.ID, page)
+		if err != nil {
+			t.Fatal("posts should be found:", err)
+		}
+		return ids(posts, postID)
+	}
+
+	if got := get(hub, models.Page{Limit: 10}); !slices.Equal(got, []uint{first.ID, second.ID, third.ID}) {
+		t.Error("only posts of the hub should be found, got", got)
+	}
+	if got := get(other, models.Page{Limit: 10}); !slices.Equal(got, []uint{first.ID, elsewhere.ID}) {
+		t.Error("post should be found in every hub it's published to, got", got)
+	}
+	if got := get(hub, models.Page{Limit: 2, After: models.Cursor{ID: first.ID, Valid: true}, Order: models.OrderNew}); len(got) != 0 {
+		t.Error("page should be bounded by the cursor, got", got)
+	}
+	if got := get(hub, models.Page{Limit: 1, Before: models.Cursor{ID: third.ID, Valid: true}, FromEnd: true}); !slices.Equal(got, []uint{second.ID}) {
+		t.Error("page from the end should be closest to before cursor, got", got)
+	}
+
+	if _, err := db.VotePost(ctx, second.ID, voter.ID, 1); err != nil {
+		t.Fatal("post should be voted on:", err)
+	}
+	if got := get(hub, models.Page{Limit: 10, Order: models.OrderTop}); !slices.Equal(got, []uint{second.ID, third.ID, first.ID}) {
+		t.Error("voted post should move in the hub, got", got)
+	}
+
+	if _, err := db.CreatePost(ctx, "title", "content", user.ID, []uint{hub.ID, missingID}); !errors.Is(err, server.ErrHubNotFound) {
+		t.Error("post should not be published to a missing hub, got:", err)
+	}
+	if got := get(hub, models.Page{Limit: 10}); len(got) != 3 {
+		t.Error("post with a missing hub should not be created, got", got)
+	}
+}
+
+func createHub(t *testing.T, db storage.Storage) *models.Hub {
+	t.Helper()
+	hub, err := db.CreateHub(context.Background(), uniqueSlug(), "title", "description")
+	if err != nil {
+		t.Fatal("hub should be created:", err)
+	}
+	return hub
+}
+
+// uniqueSlug returns a slug no other test uses.
+func uniqueSlug() string {
+	return strings.ToLower(random.NewRandomString(16))
+}
@@ -0,0 +1,134 @@
+package storagetest
+
+import (
+	"context"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"slices"
+	"testing"
+)
+
+func testPostOrders(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	first, second, third := createPost(t, db, user), createPost(t, db, user), createPost(t, db, user)
+
+	// Posts of other tests may come before and after, so the page is
+	// bounded by IDs, which are cursors of orders by ID.
+	newest := models.Cursor{ID: third.ID + 1, Valid: true}
+	posts, err := db.GetPosts(ctx, models.Page{Limit: 2, After: newest, Order: models.OrderNew})
+	if err != nil {
+		t.Fatal("posts should be found:", err)
+	}
+	if !slices.Equal(ids(posts, postID), []uint{third.ID, second.ID}) {
+		t.Error("newest posts should be found first")
+	}
+
+	posts, err = db.GetPosts(ctx, models.Page{Limit: 1, After: newest, Before: models.Cursor{ID: first.ID, Valid: true}, FromEnd: true, Order: models.OrderNew})
+	if err != nil {
+		t.Fatal("posts should be found:", err)
+	}
+	if !slices.Equal(ids(posts, postID), []uint{second.ID}) {
+		t.Error("page from the end should be closest to before cursor in the order")
+	}
+}
+
+func testCommentOrders(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	author := createUser(t, db)
+	voters := []*models.User{createUser(t, db), createUser(t, db), createUser(t, db), createUser(t, db)}
+	post := createPost(t, db, author)
+
+	// a has one upvote, b three, c is split and d has no votes.
+	a, b, c, d := createComment(t, db, author, post, nil), createComment(t, db, author, post, nil),
+		createComment(t, db, author, post, nil), createComment(t, db, author, post, nil)
+	vote := func(comment *models.Comment, values ...int) {
+		t.Helper()
+		for i, value := range values {
+			if _, err := db.VoteComment(ctx, comment.ID, voters[i].ID, value); err != nil {
+				t.Fatal("comment should be voted on:", err)
+			}
+		}
+	}
+	vote(a, 1)
+	vote(b, 1, 1, 1)
+	vote(c, 1, -1)
+
+	get := func(page models.Page, includeDeleted bool) []uint {
+		t.Helper()
+		comments, err := db.GetCommentsForPost(ctx, post.ID, page, includeDeleted)
+		if err != nil {
+			t.Fatal("comments should be found:", err)
+		}
+		return ids(comments, commentID)
+	}
+
+	orders := []struct {
+		order models.Order
+		want  []*models.Comment
+	}{
+		{models.OrderOld, []*models.Comment{a, b, c, d}},
+		{models.OrderNew, []*models.Comment{d, c, b, a}},
+		{models.OrderTop, []*models.Comment{b, a, d, c}},
+		{models.OrderHot, []*models.Comment{b, d, c, a}},
+		{models.OrderControversial, []*models.Comment{c, d, b, a}},
+		{models.OrderBest, []*models.Comment{b, a, c, d}},
+	}
+	for _, tt := range orders {
+		if got := get(models.Page{Limit: 10, Order: tt.order}, true); !slices.Equal(got, ids(tt.want, commentID)) {
+			t.Errorf("comments in order %d should be %v, got %v", tt.order, ids(tt.want, commentID), got)
+		}
+	}
+
+	at := func(c *models.Comment) models.Cursor { return models.Cursor{ID: c.ID, Valid: true} }
+	if got := get(models.Page{Limit: 2, After: at(a), Order: models.OrderTop}, true); !slices.Equal(got, []uint{d.ID, c.ID}) {
+		t.Error("page should continue after the rank of the cursor, got", got)
+	}
+	if got := get(models.Page{Limit: 1, Before: at(d), FromEnd: true, Order: models.OrderTop}, true); !slices.Equal(got, []uint{a.ID}) {
+		t.Error("page from the end should be closest to before cursor in the order, got", got)
+	}
+	if got := get(models.Page{Limit: 2, After: models.Cursor{ID: missingID, Valid: true}, Order: models.OrderTop}, true); len(got) != 0 {
+		t.Error("cursor of a missing comment should select nothing, got", got)
+	}
+
+	vote(d, 1, 1, 1, 1)
+	if got := get(models.Page{Limit: 10, Order: models.OrderTop}, true); !slices.Equal(got, []uint{d.ID, b.ID, a.ID, c.ID}) {
+		t.Error("voted comment should move in the order, got", got)
+	}
+
+	if err := db.DeleteComment(ctx, c.ID); err != nil {
+		t.Fatal("comment should be deleted:", err)
+	}
+	if got := get(models.Page{Limit: 10, Order: models.OrderControversial}, false); !slices.Equal(got, []uint{d.ID, b.ID, a.ID}) {
+		t.Error("deleted comments should be skipped, got", got)
+	}
+}
+
+func testReplyOrders(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user, voter := createUser(t, db), createUser(t, db)
+	post := createPost(t, db, user)
+	parent, other := createComment(t, db, user, post, nil), createComment(t, db, user, post, nil)
+
+	liked, unvoted := createComment(t, db, user, post, parent), createComment(t, db, user, post, parent)
+	otherReply := createComment(t, db, user, post, other)
+	if _, err := db.VoteComment(ctx, liked.ID, voter.ID, 1); err != nil {
+		t.Fatal("comment should be voted on:", err)
+	}
+
+	replies, err := db.GetRepliesByCommentIds(ctx, []uint{parent.ID, other.ID}, models.Page{Limit: 10, Order: models.OrderTop}, true)
+	if err != nil {
+		t.Fatal("replies should be found:", err)
+	}
+	if !slices.Equal(ids(replies, commentID), []uint{liked.ID, unvoted.ID, otherReply.ID}) {
+		t.Error("replies of every comment should be in the order, got", ids(replies, commentID))
+	}
+
+	replies, err = db.GetReplies(ctx, parent.ID, models.Page{Limit: 10, Order: models.OrderNew}, true)
+	if err != nil {
+		t.Fatal("replies should be found:", err)
+	}
+	if !slices.Equal(ids(replies, commentID), []uint{unvoted.ID, liked.ID}) {
+		t.Error("newest replies should be found first, got", ids(replies, commentID))
+	}
+}
@@ -0,0 +1,236 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"slices"
+	"testing"
+)
+
+func testPosts(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+
+	post, err := db.CreatePost(ctx, "title", "content", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created:", err)
+	}
+	if post.Title != "title" || post.Content != "content" || post.AuthorID != user.ID {
+		t.Error("post should have the given fields")
+	}
+	if !post.CommentsAvailable || post.EditedAt != nil || post.DeletedAt != nil {
+		t.Error("new post should be open for comments, never edited nor deleted")
+	}
+
+	got, err := db.GetPostById(ctx, post.ID)
+	if err != nil {
+		t.Fatal("post should be found:", err)
+	}
+	if !samePost(got, post) {
+		t.Error("found post should be the created one")
+	}
+
+	if _, err := db.GetPostById(ctx, missingID); !errors.Is(err, server.ErrPostNotFound) {
+		t.Error("missing post should not be found, got:", err)
+	}
+
+	other := createPost(t, db, user)
+	posts, err := db.GetPostsByIds(ctx, []uint{other.ID, missingID, post.ID})
+	if err != nil {
+		t.Fatal("posts should be found:", err)
+	}
+	found := ids(posts, postID)
+	slices.Sort(found)
+	if !slices.Equal(found, []uint{post.ID, other.ID}) {
+		t.Error("only existing posts should be found, got:", found)
+	}
+}
+
+func testPostsPage(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	first, _, last := createPost(t, db, user), createPost(t, db, user), createPost(t, db, user)
+
+	posts, err := db.GetPosts(ctx, window(first.ID, last.ID, 1, false))
+	if err != nil {
+		t.Fatal("posts should be found:", err)
+	}
+	if !slices.Equal(ids(posts, postID), []uint{first.ID}) {
+		t.Error("page should start right after the cursor")
+	}
+
+	posts, err = db.GetPosts(ctx, window(first.ID, last.ID, 1, true))
+	if err != nil {
+		t.Fatal("posts should be found:", err)
+	}
+	if !slices.Equal(ids(posts, postID), []uint{last.ID}) {
+		t.Error("page from end should end right before the cursor")
+	}
+}
+
+func testPostsByUserIds(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user, other, idle := createUser(t, db), createUser(t, db), createUser(t, db)
+	first, second, third := createPost(t, db, user), createPost(t, db, user), createPost(t, db, user)
+	otherPost := createPost(t, db, other)
+
+	posts, err := db.GetPostsFromUser(ctx, user.ID, models.Page{Limit: 10})
+	if err != nil {
+		t.Fatal("posts should be found:", err)
+	}
+	if !slices.Equal(ids(posts, postID), []uint{first.ID, second.ID, third.ID}) {
+		t.Error("all posts of the user should be found in order")
+	}
+
+	posts, err = db.GetPostsByUserIds(ctx, []uint{user.ID, other.ID, idle.ID}, models.Page{Limit: 2})
+	if err != nil {
+		t.Fatal("posts should be found:", err)
+	}
+	if !slices.Equal(ids(posts, postID), []uint{first.ID, second.ID, otherPost.ID}) {
+		t.Error("page should be applied to every user separately")
+	}
+
+	posts, err = db.GetPostsFromUser(ctx, user.ID, models.Page{Limit: 1, After: models.Cursor{ID: first.ID, Valid: true}})
+	if err != nil {
+		t.Fatal("posts should be found:", err)
+	}
+	if !slices.Equal(ids(posts, postID), []uint{second.ID}) {
+		t.Error("page should start right after the cursor")
+	}
+
+	posts, err = db.GetPostsFromUser(ctx, user.ID, models.Page{Limit: 1, FromEnd: true})
+	if err != nil {
+		t.Fatal("posts should be found:", err)
+	}
+	if !slices.Equal(ids(posts, postID), []uint{third.ID}) {
+		t.Error("page from end should hold the last post")
+	}
+}
+
+func testCreatePostMissingAuthor(t *testing.T, db storage.Storage) {
+	if _, err := db.CreatePost(context.Background(), "title", "content", missingID, nil); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("post of missing user should be rejected, got:", err)
+	}
+}
+
+func testToggleComments(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user, other := createUser(t, db), createUser(t, db)
+	post := createPost(t, db, user)
+
+	available, err := db.ToggleComments(ctx, post.ID, user.ID)
+	if err != nil {
+		t.Fatal("comments should be toggled:", err)
+	}
+	if available {
+		t.Error("comments should be disabled")
+	}
+	if got, err := db.GetPostById(ctx, post.ID); err != nil || got.CommentsAvailable {
+		t.Error("post should have comments disabled")
+	}
+
+	if available, err := db.ToggleComments(ctx, post.ID, user.ID); err != nil || !available {
+		t.Error("comments should be enabled again")
+	}
+
+	if _, err := db.ToggleComments(ctx, post.ID, other.ID); !errors.Is(err, server.ErrUnauthorized) {
+		t.Error("only author should toggle comments, got:", err)
+	}
+
+	if _, err := db.ToggleComments(ctx, missingID, user.ID); !errors.Is(err, server.ErrPostNotFound) {
+		t.Error("comments of missing post should not be toggled, got:", err)
+	}
+
+	if err := db.DeletePost(ctx, post.ID); err != nil {
+		t.Fatal("post should be deleted:", err)
+	}
+	if _, err := db.ToggleComments(ctx, post.ID, user.ID); !errors.Is(err, server.ErrPostNotFound) {
+		t.Error("comments of deleted post should not be toggled, got:", err)
+	}
+}
+
+func testUpdatePost(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user, other := createUser(t, db), createUser(t, db)
+	post := createPost(t, db, user)
+
+	updated, err := db.UpdatePost(ctx, post.ID, user.ID, "new title", "new content")
+	if err != nil {
+		t.Fatal("post should be updated:", err)
+	}
+	if updated.Title != "new title" || updated.Content != "new content" || updated.EditedAt == nil {
+		t.Error("post should be edited")
+	}
+
+	if _, err := db.UpdatePost(ctx, post.ID, user.ID, "newer title", "newer content"); err != nil {
+		t.Fatal("post should be updated again:", err)
+	}
+
+	revisions, err := db.GetPostRevisionsByPostIds(ctx, []uint{post.ID, missingID})
+	if err != nil {
+		t.Fatal("revisions should be found:", err)
+	}
+	if len(revisions) != 2 || revisions[0].Title != "title" || revisions[1].Title != "new title" {
+		t.Fatal("previous versions should be kept oldest first")
+	}
+	if revisions[0].PostID != post.ID || !revisions[0].CreatedAt.Equal(post.CreatedAt) {
+		t.Error("first revision should be the created post")
+	}
+
+	if _, err := db.UpdatePost(ctx, post.ID, other.ID, "title", "content"); !errors.Is(err, server.ErrUnauthorized) {
+		t.Error("only author should update the post, got:", err)
+	}
+
+	if _, err := db.UpdatePost(ctx, missingID, user.ID, "title", "content"); !errors.Is(err, server.ErrPostNotFound) {
+		t.Error("missing post should not be updated, got:", err)
+	}
+
+	if err := db.DeletePost(ctx, post.ID); err != nil {
+		t.Fatal("post should be deleted:", err)
+	}
+	if _, err := db.UpdatePost(ctx, post.ID, user.ID, "title", "content"); !errors.Is(err, server.ErrPostNotFound) {
+		t.Error("deleted post should not be updated, got:", err)
+	}
+}
+
+func testDeletePost(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	post := createPost(t, db, user)
+
+	if err := db.DeletePost(ctx, post.ID); err != nil {
+		t.Fatal("post should be deleted:", err)
+	}
+
+	deleted, err := db.GetPostById(ctx, post.ID)
+	if err != nil {
+		t.Fatal("deleted post should still be found:", err)
+	}
+	if deleted.DeletedAt == nil || deleted.CommentsAvailable {
+		t.Error("deleted post should be marked and closed for comments")
+	}
+
+	if err := db.DeletePost(ctx, post.ID); err != nil {
+		t.Fatal("deleting deleted post should succeed:", err)
+	}
+	if again, err := db.GetPostById(ctx, post.ID); err != nil || !again.DeletedAt.Equal(*deleted.DeletedAt) {
+		t.Error("deletion time should be kept")
+	}
+
+	if err := db.DeletePost(ctx, missingID); !errors.Is(err, server.ErrPostNotFound) {
+		t.Error("missing post should not be deleted, got:", err)
+	}
+}
+
+// samePost compares fields both storages fill the same way.
+func samePost(a, b *models.Post) bool {
+	return a.ID == b.ID &&
+		a.Title == b.Title &&
+		a.Content == b.Content &&
+		a.AuthorID == b.AuthorID &&
+		a.CreatedAt.Equal(b.CreatedAt) &&
+		a.CommentsAvailable == b.CommentsAvailable
+}
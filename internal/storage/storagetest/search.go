@@ -0,0 +1,134 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/lib/random"
+	"github.com/rmntim/ozon-task/internal/lib/validation"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func testSearch(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	word, other := uniqueWord(), uniqueWord()
+
+	inTitle, err := db.CreatePost(ctx, word+" in title", "content", user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created:", err)
+	}
+	inContent, err := db.CreatePost(ctx, "title", "content mentions "+word, user.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created:", err)
+	}
+	comment, err := db.CreateComment(ctx, "Кошки любят "+word+" и "+other, user.ID, inTitle.ID, nil)
+	if err != nil {
+		t.Fatal("comment should be created:", err)
+	}
+	deleted, err := db.CreateComment(ctx, word, user.ID, inTitle.ID, nil)
+	if err != nil {
+		t.Fatal("comment should be created:", err)
+	}
+	if err := db.DeleteComment(ctx, deleted.ID); err != nil {
+		t.Fatal("comment should be deleted:", err)
+	}
+
+	search := func(query models.SearchQuery) []*models.SearchHit {
+		t.Helper()
+		hits, err := db.Search(ctx, query)
+		if err != nil {
+			t.Fatal("search should succeed:", err)
+		}
+		return hits
+	}
+
+	hits := search(models.SearchQuery{Text: word, Limit: 10})
+	want := []string{hitKey(models.SearchPost, inTitle.ID), hitKey(models.SearchPost, inContent.ID), hitKey(models.SearchComment, comment.ID)}
+	if got := hitKeys(hits); len(got) == 0 || got[0] != want[0] || !slices.Equal(sortedKeys(got), sortedKeys(want)) {
+		t.Error("posts and comments with the word should be found, title matches first, got", got)
+	}
+	for _, hit := range hits {
+		if hit.Rank <= 0 || !strings.Contains(hit.Snippet, "<b>"+word+"</b>") {
+			t.Errorf("hit should be ranked and have the word highlighted, got %v %q", hit.Rank, hit.Snippet)
+		}
+	}
+
+	hits = search(models.SearchQuery{Text: word + " " + other, Limit: 10})
+	if !slices.Equal(hitKeys(hits), []string{hitKey(models.SearchComment, comment.ID)}) {
+		t.Error("only items with every word should be found, got", hitKeys(hits))
+	}
+
+	hits = search(models.SearchQuery{Text: "кошки " + other, Limit: 10})
+	if !slices.Equal(hitKeys(hits), []string{hitKey(models.SearchComment, comment.ID)}) {
+		t.Error("russian words should be found, got", hitKeys(hits))
+	}
+
+	hits = search(models.SearchQuery{Text: word, Types: []models.SearchType{models.SearchPost}, Limit: 1, Offset: 1})
+	if !slices.Equal(hitKeys(hits), []string{hitKey(models.SearchPost, inContent.ID)}) {
+		t.Error("search should be limited to types and paged, got", hitKeys(hits))
+	}
+
+	hits = search(models.SearchQuery{Text: user.Username, Types: []models.SearchType{models.SearchUser}, Limit: 10})
+	if !slices.Equal(hitKeys(hits), []string{hitKey(models.SearchUser, user.ID)}) {
+		t.Error("user should be found by username, got", hitKeys(hits))
+	}
+
+	var errs validation.Errors
+	if _, err := db.Search(ctx, models.SearchQuery{Text: " ", Limit: 10}); !errors.As(err, &errs) {
+		t.Error("empty query should be rejected, got", err)
+	}
+}
+
+func testSearchEscaping(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	word := uniqueWord()
+	post := createPost(t, db, user)
+
+	if _, err := db.CreateComment(ctx, "<i>"+word+"</i> & more", user.ID, post.ID, nil); err != nil {
+		t.Fatal("comment should be created:", err)
+	}
+
+	hits, err := db.Search(ctx, models.SearchQuery{Text: word, Limit: 10})
+	if err != nil {
+		t.Fatal("search should succeed:", err)
+	}
+	if len(hits) != 1 || !strings.Contains(hits[0].Snippet, "&lt;i&gt;<b>"+word+"</b>&lt;/i&gt; &amp; more") {
+		t.Error("snippet should be HTML-escaped, got", hits)
+	}
+}
+
+// uniqueWord returns a word no other test uses, so that tests can search
+// a storage that isn't empty.
+func uniqueWord() string {
+	return "w" + strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, random.NewRandomString(16))
+}
+
+func hitKeys(hits []*models.SearchHit) []string {
+	keys := make([]string, len(hits))
+	for i, hit := range hits {
+		keys[i] = hitKey(hit.Type, hit.ID)
+	}
+	return keys
+}
+
+func sortedKeys(keys []string) []string {
+	keys = slices.Clone(keys)
+	slices.Sort(keys)
+	return keys
+}
+
+func hitKey(t models.SearchType, id uint) string {
+	return string(t) + ":" + strconv.FormatUint(uint64(id), 10)
+}
@@ -0,0 +1,141 @@
+// Package storagetest is a suite every storage.Storage implementation
+// must pass, so that storages are interchangeable.
+package storagetest
+
+import (
+	"context"
+	"github.com/rmntim/ozon-task/internal/lib/random"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"slices"
+	"testing"
+)
+
+// missingID is an ID no test creates anything with.
+const missingID = 1 << 30
+
+// Run runs the suite. newStorage may return the same storage for every
+// test, as tests don't rely on it being empty.
+func Run(t *testing.T, newStorage func(t *testing.T) storage.Storage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, db storage.Storage)
+	}{
+		{"Users", testUsers},
+		{"UsersPage", testUsersPage},
+		{"CreateUserTaken", testCreateUserTaken},
+		{"SetUserRole", testSetUserRole},
+		{"Posts", testPosts},
+		{"PostsPage", testPostsPage},
+		{"PostOrders", testPostOrders},
+		{"PostsByUserIds", testPostsByUserIds},
+		{"CreatePostMissingAuthor", testCreatePostMissingAuthor},
+		{"ToggleComments", testToggleComments},
+		{"UpdatePost", testUpdatePost},
+		{"DeletePost", testDeletePost},
+		{"Comments", testComments},
+		{"CommentsPage", testCommentsPage},
+		{"CommentsByPostIds", testCommentsByPostIds},
+		{"RepliesByCommentIds", testRepliesByCommentIds},
+		{"CommentOrders", testCommentOrders},
+		{"ReplyOrders", testReplyOrders},
+		{"CreateCommentErrors", testCreateCommentErrors},
+		{"CommentTree", testCommentTree},
+		{"UpdateComment", testUpdateComment},
+		{"DeleteComment", testDeleteComment},
+		{"VotePost", testVotePost},
+		{"VoteComment", testVoteComment},
+		{"VoteErrors", testVoteErrors},
+		{"Hubs", testHubs},
+		{"HubSubscriptions", testHubSubscriptions},
+		{"HubPosts", testHubPosts},
+		{"Follows", testFollows},
+		{"FollowPages", testFollowPages},
+		{"FollowsByUserIds", testFollowsByUserIds},
+		{"Feed", testFeed},
+		{"Search", testSearch},
+		{"SearchEscaping", testSearchEscaping},
+		{"RefreshTokens", testRefreshTokens},
+		{"SessionVersions", testSessionVersions},
+		{"Ping", testPing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+func testPing(t *testing.T, db storage.Storage) {
+	if err := db.Ping(context.Background()); err != nil {
+		t.Error("storage should be reachable:", err)
+	}
+}
+
+// createUser creates a user with a random name, so that tests can run
+// against a storage that isn't empty.
+func createUser(t *testing.T, db storage.Storage) *models.User {
+	t.Helper()
+	name := random.NewRandomString(16)
+	user, err := db.CreateUser(context.Background(), name, name+"@example.com", "password")
+	if err != nil {
+		t.Fatal("user should be created:", err)
+	}
+	return user
+}
+
+func createPost(t *testing.T, db storage.Storage, author *models.User) *models.Post {
+	t.Helper()
+	post, err := db.CreatePost(context.Background(), "title", "content", author.ID, nil)
+	if err != nil {
+		t.Fatal("post should be created:", err)
+	}
+	return post
+}
+
+func createComment(t *testing.T, db storage.Storage, author *models.User, post *models.Post, parent *models.Comment) *models.Comment {
+	t.Helper()
+	var parentId *uint
+	if parent != nil {
+		parentId = &parent.ID
+	}
+	comment, err := db.CreateComment(context.Background(), "content", author.ID, post.ID, parentId)
+	if err != nil {
+		t.Fatal("comment should be created:", err)
+	}
+	return comment
+}
+
+// window is a page of everything from first to last. Other tests may
+// add items to a shared storage in between, so only the edges of the
+// window are certain.
+func window(first, last uint, limit int, fromEnd bool) models.Page {
+	return models.Page{
+		Limit:   limit,
+		After:   models.Cursor{ID: first - 1, Valid: first > 0},
+		Before:  models.Cursor{ID: last + 1, Valid: true},
+		FromEnd: fromEnd,
+	}
+}
+
+// ids returns IDs of items in their order.
+func ids[T any](items []T, id func(T) uint) []uint {
+	res := make([]uint, len(items))
+	for i, item := range items {
+		res[i] = id(item)
+	}
+	return res
+}
+
+// sorted returns a sorted copy of ids, as Postgres aggregates them in
+// no particular order.
+func sorted(ids models.IDArray) []uint {
+	res := slices.Clone([]uint(ids))
+	slices.Sort(res)
+	return res
+}
+
+func userID(u *models.User) uint       { return u.ID }
+func postID(p *models.Post) uint       { return p.ID }
+func commentID(c *models.Comment) uint { return c.ID }
@@ -0,0 +1,84 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/lib/random"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"testing"
+	"time"
+)
+
+func testRefreshTokens(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+
+	family := random.NewRandomString(16)
+	token := &models.RefreshToken{
+		Hash:   random.NewRandomString(64),
+		UserID: user.ID,
+		Family: family,
+		// Postgres keeps microseconds without time zone.
+		ExpiresAt: time.Now().UTC().Add(time.Hour).Truncate(time.Microsecond),
+	}
+	if err := db.CreateRefreshToken(ctx, token); err != nil {
+		t.Fatal("token should be created:", err)
+	}
+
+	used, err := db.UseRefreshToken(ctx, token.Hash)
+	if err != nil {
+		t.Fatal("token should be used:", err)
+	}
+	if used.Hash != token.Hash || used.UserID != user.ID || used.Family != family || !used.ExpiresAt.Equal(token.ExpiresAt) {
+		t.Error("used token should be the created one")
+	}
+
+	reused, err := db.UseRefreshToken(ctx, token.Hash)
+	if !errors.Is(err, server.ErrTokenReused) {
+		t.Error("token should be used only once, got:", err)
+	}
+	if reused == nil || reused.Family != family {
+		t.Error("reused token should be returned, so that its family can be revoked")
+	}
+
+	if _, err := db.UseRefreshToken(ctx, "missing"+token.Hash); !errors.Is(err, server.ErrInvalidToken) {
+		t.Error("missing token should be invalid, got:", err)
+	}
+
+	sibling := *token
+	sibling.Hash = random.NewRandomString(64)
+	if err := db.CreateRefreshToken(ctx, &sibling); err != nil {
+		t.Fatal("token should be created:", err)
+	}
+	if err := db.RevokeRefreshTokens(ctx, family); err != nil {
+		t.Fatal("tokens should be revoked:", err)
+	}
+	if _, err := db.UseRefreshToken(ctx, sibling.Hash); !errors.Is(err, server.ErrInvalidToken) {
+		t.Error("revoked token should be invalid, got:", err)
+	}
+}
+
+func testSessionVersions(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+
+	before, err := db.GetSessionVersion(ctx, user.ID)
+	if err != nil {
+		t.Fatal("session version should be found:", err)
+	}
+	if err := db.RevokeSessions(ctx, user.ID); err != nil {
+		t.Fatal("sessions should be revoked:", err)
+	}
+	if after, err := db.GetSessionVersion(ctx, user.ID); err != nil || after == before {
+		t.Error("session version should change on revocation, got:", err)
+	}
+
+	if _, err := db.GetSessionVersion(ctx, missingID); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("missing user should have no session version, got:", err)
+	}
+	if err := db.RevokeSessions(ctx, missingID); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("sessions of missing user should not be revoked, got:", err)
+	}
+}
@@ -0,0 +1,120 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/lib/password"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"slices"
+	"testing"
+)
+
+func testUsers(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+
+	user := createUser(t, db)
+	if user.Role != models.RoleUser {
+		t.Error("new user should have user role")
+	}
+
+	got, err := db.GetUserById(ctx, user.ID)
+	if err != nil {
+		t.Fatal("user should be found:", err)
+	}
+	if got.ID != user.ID || got.Username != user.Username || got.Email != user.Email || got.Role != user.Role {
+		t.Error("found user should be the created one")
+	}
+	if got.PasswordHash != nil {
+		t.Error("password hash should only be returned by username")
+	}
+
+	got, err = db.GetUserByUsername(ctx, user.Username)
+	if err != nil {
+		t.Fatal("user should be found by username:", err)
+	}
+	if got.ID != user.ID || !password.Check(got.PasswordHash, "password") {
+		t.Error("user should be returned with password hash")
+	}
+
+	if _, err := db.GetUserById(ctx, missingID); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("missing user should not be found, got:", err)
+	}
+	if _, err := db.GetUserByUsername(ctx, "missing"+user.Username); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("missing username should not be found, got:", err)
+	}
+
+	other := createUser(t, db)
+	users, err := db.GetUsersByIds(ctx, []uint{other.ID, missingID, user.ID})
+	if err != nil {
+		t.Fatal("users should be found:", err)
+	}
+	found := ids(users, userID)
+	slices.Sort(found)
+	if !slices.Equal(found, []uint{user.ID, other.ID}) {
+		t.Error("only existing users should be found, got:", found)
+	}
+}
+
+func testUsersPage(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	first, _, last := createUser(t, db), createUser(t, db), createUser(t, db)
+
+	users, err := db.GetUsers(ctx, window(first.ID, last.ID, 1, false))
+	if err != nil {
+		t.Fatal("users should be found:", err)
+	}
+	if !slices.Equal(ids(users, userID), []uint{first.ID}) {
+		t.Error("page should start right after the cursor")
+	}
+
+	users, err = db.GetUsers(ctx, window(first.ID, last.ID, 1, true))
+	if err != nil {
+		t.Fatal("users should be found:", err)
+	}
+	if !slices.Equal(ids(users, userID), []uint{last.ID}) {
+		t.Error("page from end should end right before the cursor")
+	}
+
+	users, err = db.GetUsers(ctx, window(last.ID+1, last.ID+1, 10, false))
+	if err != nil {
+		t.Fatal("empty page should be returned:", err)
+	}
+	if users == nil || len(users) != 0 {
+		t.Error("empty page should be an empty slice")
+	}
+}
+
+func testCreateUserTaken(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+
+	if _, err := db.CreateUser(ctx, user.Username, "other"+user.Email, "password"); !errors.Is(err, server.ErrUsernameTaken) {
+		t.Error("duplicate username should be rejected, got:", err)
+	}
+
+	if _, err := db.CreateUser(ctx, "other"+user.Username, user.Email, "password"); !errors.Is(err, server.ErrEmailTaken) {
+		t.Error("duplicate email should be rejected, got:", err)
+	}
+}
+
+func testSetUserRole(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+
+	if err := db.SetUserRole(ctx, user.ID, models.RoleModerator); err != nil {
+		t.Fatal("role should be set:", err)
+	}
+	got, err := db.GetUserById(ctx, user.ID)
+	if err != nil {
+		t.Fatal("user should be found:", err)
+	}
+	if got.Role != models.RoleModerator {
+		t.Error("user should have the new role")
+	}
+
+	if err := db.SetUserRole(ctx, missingID, models.RoleAdmin); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("role of missing user should not be set, got:", err)
+	}
+}
@@ -0,0 +1,133 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"github.com/rmntim/ozon-task/internal/models"
+	"github.com/rmntim/ozon-task/internal/server"
+	"github.com/rmntim/ozon-task/internal/storage"
+	"testing"
+)
+
+func testVotePost(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	author, voter, other := createUser(t, db), createUser(t, db), createUser(t, db)
+	post := createPost(t, db, author)
+
+	if post.Upvotes != 0 || post.Downvotes != 0 {
+		t.Error("new post should have no votes")
+	}
+
+	steps := []struct {
+		user               *models.User
+		value              int
+		upvotes, downvotes int
+	}{
+		{voter, 1, 1, 0},
+		{other, -1, 1, 1},
+		{voter, 1, 1, 1},
+		{voter, -1, 0, 2},
+		{other, 0, 0, 1},
+		{other, 0, 0, 1},
+	}
+	for _, step := range steps {
+		voted, err := db.VotePost(ctx, post.ID, step.user.ID, step.value)
+		if err != nil {
+			t.Fatal("post should be voted on:", err)
+		}
+		if voted.Upvotes != step.upvotes || voted.Downvotes != step.downvotes {
+			t.Errorf("post should have %d upvotes and %d downvotes, got %d and %d",
+				step.upvotes, step.downvotes, voted.Upvotes, voted.Downvotes)
+		}
+	}
+
+	got, err := db.GetPostById(ctx, post.ID)
+	if err != nil {
+		t.Fatal("post should be found:", err)
+	}
+	if got.Upvotes != 0 || got.Downvotes != 1 || got.Score() != -1 {
+		t.Error("found post should have the counters of the last vote")
+	}
+
+	votes, err := db.GetPostVotes(ctx, voter.ID, []uint{post.ID, missingID})
+	if err != nil {
+		t.Fatal("votes should be found:", err)
+	}
+	if len(votes) != 1 || votes[0].TargetID != post.ID || votes[0].UserID != voter.ID || votes[0].Value != -1 {
+		t.Error("only the vote of the user should be found, got:", votes)
+	}
+
+	votes, err = db.GetPostVotes(ctx, other.ID, []uint{post.ID})
+	if err != nil {
+		t.Fatal("votes should be found:", err)
+	}
+	if len(votes) != 0 {
+		t.Error("retracted vote should not be found, got:", votes)
+	}
+}
+
+func testVoteComment(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	author, voter := createUser(t, db), createUser(t, db)
+	post := createPost(t, db, author)
+	comment := createComment(t, db, author, post, nil)
+
+	if _, err := db.VoteComment(ctx, comment.ID, voter.ID, -1); err != nil {
+		t.Fatal("comment should be voted on:", err)
+	}
+	voted, err := db.VoteComment(ctx, comment.ID, author.ID, 1)
+	if err != nil {
+		t.Fatal("comment should be voted on:", err)
+	}
+	if voted.Upvotes != 1 || voted.Downvotes != 1 || voted.Score() != 0 {
+		t.Error("comment should count votes of every user")
+	}
+
+	votes, err := db.GetCommentVotes(ctx, voter.ID, []uint{comment.ID})
+	if err != nil {
+		t.Fatal("votes should be found:", err)
+	}
+	if len(votes) != 1 || votes[0].TargetID != comment.ID || votes[0].Value != -1 {
+		t.Error("vote of the user should be found, got:", votes)
+	}
+
+	if p, err := db.GetPostById(ctx, post.ID); err != nil || p.Upvotes != 0 || p.Downvotes != 0 {
+		t.Error("votes on comments should not count for the post")
+	}
+}
+
+func testVoteErrors(t *testing.T, db storage.Storage) {
+	ctx := context.Background()
+	user := createUser(t, db)
+	post := createPost(t, db, user)
+	comment := createComment(t, db, user, post, nil)
+
+	if _, err := db.VotePost(ctx, missingID, user.ID, 1); !errors.Is(err, server.ErrPostNotFound) {
+		t.Error("missing post should not be voted on, got:", err)
+	}
+	if _, err := db.VotePost(ctx, post.ID, missingID, 1); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("missing user should not vote, got:", err)
+	}
+	if _, err := db.VoteComment(ctx, missingID, user.ID, 1); !errors.Is(err, server.ErrCommentNotFound) {
+		t.Error("missing comment should not be voted on, got:", err)
+	}
+	if _, err := db.VoteComment(ctx, comment.ID, missingID, 1); !errors.Is(err, server.ErrUserNotFound) {
+		t.Error("missing user should not vote, got:", err)
+	}
+	if _, err := db.VotePost(ctx, post.ID, user.ID, 2); err == nil {
+		t.Error("vote of 2 should be rejected")
+	}
+
+	if err := db.DeleteComment(ctx, comment.ID); err != nil {
+		t.Fatal("comment should be deleted:", err)
+	}
+	if _, err := db.VoteComment(ctx, comment.ID, user.ID, 1); !errors.Is(err, server.ErrCommentNotFound) {
+		t.Error("deleted comment should not be voted on, got:", err)
+	}
+	if err := db.DeletePost(ctx, post.ID); err != nil {
+		t.Fatal("post should be deleted:", err)
+	}
+	if _, err := db.VotePost(ctx, post.ID, user.ID, 1); !errors.Is(err, server.ErrPostNotFound) {
+		t.Error("deleted post should not be voted on, got:", err)
+	}
+}
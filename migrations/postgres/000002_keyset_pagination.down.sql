@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_comments_parent_comment_id_id;
+DROP INDEX IF EXISTS idx_comments_post_id_id;
+DROP INDEX IF EXISTS idx_posts_author_id_id;
@@ -0,0 +1,3 @@
+CREATE INDEX idx_posts_author_id_id ON posts (author_id, id);
+CREATE INDEX idx_comments_post_id_id ON comments (post_id, id);
+CREATE INDEX idx_comments_parent_comment_id_id ON comments (parent_comment_id, id);
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS comment_path ON comments;
+DROP FUNCTION IF EXISTS set_comment_path();
+DROP INDEX IF EXISTS idx_comments_post_id_path;
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS path;
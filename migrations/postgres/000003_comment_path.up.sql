@@ -0,0 +1,38 @@
+ALTER TABLE comments
+    ADD COLUMN path INTEGER[];
+
+WITH RECURSIVE paths AS (SELECT id, ARRAY [id] AS path
+                         FROM comments
+                         WHERE parent_comment_id IS NULL
+                         UNION ALL
+                         SELECT c.id, p.path || c.id
+                         FROM comments c
+                                  JOIN paths p ON c.parent_comment_id = p.id)
+UPDATE comments c
+SET path = paths.path
+FROM paths
+WHERE c.id = paths.id;
+
+ALTER TABLE comments
+    ALTER COLUMN path SET NOT NULL;
+
+CREATE INDEX idx_comments_post_id_path ON comments (post_id, path);
+
+CREATE FUNCTION set_comment_path() RETURNS trigger AS
+$set_comment_path$
+BEGIN
+    IF NEW.parent_comment_id IS NULL THEN
+        NEW.path := ARRAY [NEW.id];
+    ELSE
+        SELECT path || NEW.id INTO NEW.path FROM comments WHERE id = NEW.parent_comment_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$set_comment_path$ LANGUAGE plpgsql;
+
+CREATE TRIGGER comment_path
+    BEFORE INSERT
+    ON comments
+    FOR EACH ROW
+EXECUTE PROCEDURE set_comment_path();
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens
+(
+    token_hash VARCHAR(64) PRIMARY KEY,
+    user_id    INTEGER     NOT NULL,
+    family     VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP   NOT NULL,
+    used_at    TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users
+);
+
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens (family);
@@ -0,0 +1,27 @@
+ALTER TABLE posts
+    ADD COLUMN edited_at TIMESTAMP;
+
+ALTER TABLE comments
+    ADD COLUMN edited_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS post_revisions
+(
+    id         SERIAL PRIMARY KEY,
+    post_id    INTEGER      NOT NULL,
+    title      VARCHAR(255) NOT NULL,
+    content    TEXT         NOT NULL,
+    created_at TIMESTAMP    NOT NULL,
+    FOREIGN KEY (post_id) REFERENCES posts
+);
+
+CREATE TABLE IF NOT EXISTS comment_revisions
+(
+    id         SERIAL PRIMARY KEY,
+    comment_id INTEGER       NOT NULL,
+    content    VARCHAR(2000) NOT NULL,
+    created_at TIMESTAMP     NOT NULL,
+    FOREIGN KEY (comment_id) REFERENCES comments
+);
+
+CREATE INDEX idx_post_revisions_post_id_id ON post_revisions (post_id, id);
+CREATE INDEX idx_comment_revisions_comment_id_id ON comment_revisions (comment_id, id);
@@ -0,0 +1,13 @@
+UPDATE users
+SET role = 'user'
+WHERE role = 'moderator';
+
+ALTER TABLE users
+    DROP CONSTRAINT users_role_check,
+    ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'admin'));
+
+ALTER TABLE comments
+    DROP COLUMN deleted_at;
+
+ALTER TABLE posts
+    DROP COLUMN deleted_at;
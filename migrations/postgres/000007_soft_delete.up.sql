@@ -0,0 +1,9 @@
+ALTER TABLE posts
+    ADD COLUMN deleted_at TIMESTAMP;
+
+ALTER TABLE comments
+    ADD COLUMN deleted_at TIMESTAMP;
+
+ALTER TABLE users
+    DROP CONSTRAINT users_role_check,
+    ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'moderator', 'admin'));
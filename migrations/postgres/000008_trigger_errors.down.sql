@@ -0,0 +1,31 @@
+CREATE OR REPLACE FUNCTION check_post_for_comments() RETURNS trigger AS
+$check_post_for_comments$
+DECLARE
+    post_comments_available BOOLEAN;
+BEGIN
+    SELECT comments_available INTO post_comments_available FROM posts WHERE id = NEW.post_id;
+
+    IF NOT post_comments_available THEN
+        RAISE EXCEPTION 'Post with ID % does not allow comments', NEW.post_id;
+    END IF;
+
+    RETURN NEW;
+END;
+$check_post_for_comments$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION check_comment_same_post_as_parent() RETURNS trigger AS
+$check_comment_same_post_as_parent$
+DECLARE
+    post_id INTEGER;
+BEGIN
+    IF NEW.parent_comment_id IS NOT NULL THEN
+        SELECT post_id INTO post_id FROM comments WHERE id = NEW.parent_comment_id;
+
+        IF NEW.post_id <> post_id THEN
+            RAISE EXCEPTION 'Parent comment with ID % does not belong to post with ID %', NEW.parent_comment_id, NEW.post_id;
+        END IF;
+    END IF;
+
+    RETURN NEW;
+END;
+$check_comment_same_post_as_parent$ LANGUAGE plpgsql;
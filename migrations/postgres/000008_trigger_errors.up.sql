@@ -0,0 +1,49 @@
+-- Triggers raise errors with own SQLSTATE codes, so that the storage can
+-- tell them apart without parsing messages:
+--   OZ001 - comments are disabled on the post
+--   OZ002 - parent comment belongs to another post
+--   OZ003 - parent comment doesn't exist
+
+CREATE OR REPLACE FUNCTION check_post_for_comments() RETURNS trigger AS
+$check_post_for_comments$
+DECLARE
+    post_comments_available BOOLEAN;
+BEGIN
+    SELECT comments_available INTO post_comments_available FROM posts WHERE id = NEW.post_id;
+
+    -- Missing post is reported by the foreign key.
+    IF NOT post_comments_available THEN
+        RAISE EXCEPTION 'Post with ID % does not allow comments', NEW.post_id
+            USING ERRCODE = 'OZ001';
+    END IF;
+
+    RETURN NEW;
+END;
+$check_post_for_comments$ LANGUAGE plpgsql;
+
+-- parent_post_id used to be called post_id, same as the column, which made
+-- the query fail on every reply with an ambiguous column reference.
+CREATE OR REPLACE FUNCTION check_comment_same_post_as_parent() RETURNS trigger AS
+$check_comment_same_post_as_parent$
+DECLARE
+    parent_post_id INTEGER;
+BEGIN
+    IF NEW.parent_comment_id IS NOT NULL THEN
+        SELECT c.post_id INTO parent_post_id FROM comments c WHERE c.id = NEW.parent_comment_id;
+
+        -- Checked here rather than by the foreign key, as comment_path
+        -- trigger leaves path NULL for a missing parent.
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'Parent comment with ID % does not exist', NEW.parent_comment_id
+                USING ERRCODE = 'OZ003';
+        END IF;
+
+        IF NEW.post_id <> parent_post_id THEN
+            RAISE EXCEPTION 'Parent comment with ID % does not belong to post with ID %', NEW.parent_comment_id, NEW.post_id
+                USING ERRCODE = 'OZ002';
+        END IF;
+    END IF;
+
+    RETURN NEW;
+END;
+$check_comment_same_post_as_parent$ LANGUAGE plpgsql;
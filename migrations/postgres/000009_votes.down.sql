@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS comment_votes;
+DROP TABLE IF EXISTS post_votes;
+
+DROP FUNCTION IF EXISTS count_comment_vote();
+DROP FUNCTION IF EXISTS count_post_vote();
+
+ALTER TABLE comments
+    DROP COLUMN downvotes,
+    DROP COLUMN upvotes;
+
+ALTER TABLE posts
+    DROP COLUMN downvotes,
+    DROP COLUMN upvotes;
@@ -0,0 +1,85 @@
+ALTER TABLE posts
+    ADD COLUMN upvotes   INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN downvotes INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE comments
+    ADD COLUMN upvotes   INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN downvotes INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS post_votes
+(
+    post_id INTEGER  NOT NULL,
+    user_id INTEGER  NOT NULL,
+    value   SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts,
+    FOREIGN KEY (user_id) REFERENCES users
+);
+
+CREATE TABLE IF NOT EXISTS comment_votes
+(
+    comment_id INTEGER  NOT NULL,
+    user_id    INTEGER  NOT NULL,
+    value      SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+    PRIMARY KEY (comment_id, user_id),
+    FOREIGN KEY (comment_id) REFERENCES comments,
+    FOREIGN KEY (user_id) REFERENCES users
+);
+
+-- Counters are kept next to posts and comments, so that reading them
+-- doesn't aggregate votes. Updating the row also serializes concurrent
+-- votes on the same post or comment.
+
+CREATE FUNCTION count_post_vote() RETURNS trigger AS
+$count_post_vote$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE posts
+        SET upvotes   = upvotes - (OLD.value = 1)::int,
+            downvotes = downvotes - (OLD.value = -1)::int
+        WHERE id = OLD.post_id;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE posts
+        SET upvotes   = upvotes + (NEW.value = 1)::int,
+            downvotes = downvotes + (NEW.value = -1)::int
+        WHERE id = NEW.post_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$count_post_vote$ LANGUAGE plpgsql;
+
+CREATE TRIGGER post_vote_count
+    AFTER INSERT OR UPDATE OR DELETE
+    ON post_votes
+    FOR EACH ROW
+EXECUTE PROCEDURE count_post_vote();
+
+CREATE FUNCTION count_comment_vote() RETURNS trigger AS
+$count_comment_vote$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE comments
+        SET upvotes   = upvotes - (OLD.value = 1)::int,
+            downvotes = downvotes - (OLD.value = -1)::int
+        WHERE id = OLD.comment_id;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE comments
+        SET upvotes   = upvotes + (NEW.value = 1)::int,
+            downvotes = downvotes + (NEW.value = -1)::int
+        WHERE id = NEW.comment_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$count_comment_vote$ LANGUAGE plpgsql;
+
+CREATE TRIGGER comment_vote_count
+    AFTER INSERT OR UPDATE OR DELETE
+    ON comment_votes
+    FOR EACH ROW
+EXECUTE PROCEDURE count_comment_vote();
@@ -0,0 +1,15 @@
+ALTER TABLE comments
+    DROP COLUMN confidence,
+    DROP COLUMN controversy,
+    DROP COLUMN hot,
+    DROP COLUMN score;
+
+ALTER TABLE posts
+    DROP COLUMN confidence,
+    DROP COLUMN controversy,
+    DROP COLUMN hot,
+    DROP COLUMN score;
+
+DROP FUNCTION IF EXISTS confidence_rank(INTEGER, INTEGER);
+DROP FUNCTION IF EXISTS controversy_rank(INTEGER, INTEGER);
+DROP FUNCTION IF EXISTS hot_rank(INTEGER, INTEGER, TIMESTAMP);
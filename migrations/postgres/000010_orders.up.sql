@@ -0,0 +1,70 @@
+-- Ranks of posts and comments in ranked orders, the same as models.Rank.
+-- They only change with vote counters, so they are stored and indexed
+-- rather than computed by every query.
+CREATE FUNCTION hot_rank(upvotes INTEGER, downvotes INTEGER, created_at TIMESTAMP) RETURNS DOUBLE PRECISION
+    LANGUAGE SQL
+    IMMUTABLE
+    PARALLEL SAFE
+AS
+$$
+SELECT sign((upvotes - downvotes)::DOUBLE PRECISION) * log(greatest(abs(upvotes - downvotes), 1)::DOUBLE PRECISION)
+           + (extract(EPOCH FROM created_at)::DOUBLE PRECISION - 1134028003) / 45000
+$$;
+
+CREATE FUNCTION controversy_rank(upvotes INTEGER, downvotes INTEGER) RETURNS DOUBLE PRECISION
+    LANGUAGE SQL
+    IMMUTABLE
+    PARALLEL SAFE
+AS
+$$
+SELECT CASE
+           WHEN upvotes <= 0 OR downvotes <= 0 THEN 0
+           ELSE power((upvotes + downvotes)::DOUBLE PRECISION,
+                      least(upvotes, downvotes)::DOUBLE PRECISION / greatest(upvotes, downvotes))
+           END
+$$;
+
+-- Lower bound of the Wilson score interval of the upvote ratio at the
+-- 95% confidence level.
+CREATE FUNCTION confidence_rank(upvotes INTEGER, downvotes INTEGER) RETURNS DOUBLE PRECISION
+    LANGUAGE SQL
+    IMMUTABLE
+    PARALLEL SAFE
+AS
+$$
+SELECT CASE
+           WHEN n = 0 THEN 0
+           ELSE (p + z * z / (2 * n) - z * sqrt((p * (1 - p) + z * z / (4 * n)) / n)) / (1 + z * z / n)
+           END
+FROM (SELECT (upvotes + downvotes)::DOUBLE PRECISION                       AS n,
+             upvotes::DOUBLE PRECISION / greatest(upvotes + downvotes, 1) AS p,
+             1.96::DOUBLE PRECISION                                       AS z) t
+$$;
+
+ALTER TABLE posts
+    ADD COLUMN score       INTEGER GENERATED ALWAYS AS (upvotes - downvotes) STORED,
+    ADD COLUMN hot         DOUBLE PRECISION GENERATED ALWAYS AS (hot_rank(upvotes, downvotes, created_at)) STORED,
+    ADD COLUMN controversy DOUBLE PRECISION GENERATED ALWAYS AS (controversy_rank(upvotes, downvotes)) STORED,
+    ADD COLUMN confidence  DOUBLE PRECISION GENERATED ALWAYS AS (confidence_rank(upvotes, downvotes)) STORED;
+
+ALTER TABLE comments
+    ADD COLUMN score       INTEGER GENERATED ALWAYS AS (upvotes - downvotes) STORED,
+    ADD COLUMN hot         DOUBLE PRECISION GENERATED ALWAYS AS (hot_rank(upvotes, downvotes, created_at)) STORED,
+    ADD COLUMN controversy DOUBLE PRECISION GENERATED ALWAYS AS (controversy_rank(upvotes, downvotes)) STORED,
+    ADD COLUMN confidence  DOUBLE PRECISION GENERATED ALWAYS AS (confidence_rank(upvotes, downvotes)) STORED;
+
+-- Pages in ranked orders are scanned backwards by (rank, id).
+CREATE INDEX idx_posts_score_id ON posts (score, id);
+CREATE INDEX idx_posts_hot_id ON posts (hot, id);
+CREATE INDEX idx_posts_controversy_id ON posts (controversy, id);
+CREATE INDEX idx_posts_confidence_id ON posts (confidence, id);
+
+CREATE INDEX idx_comments_post_id_score_id ON comments (post_id, score, id);
+CREATE INDEX idx_comments_post_id_hot_id ON comments (post_id, hot, id);
+CREATE INDEX idx_comments_post_id_controversy_id ON comments (post_id, controversy, id);
+CREATE INDEX idx_comments_post_id_confidence_id ON comments (post_id, confidence, id);
+
+CREATE INDEX idx_comments_parent_comment_id_score_id ON comments (parent_comment_id, score, id);
+CREATE INDEX idx_comments_parent_comment_id_hot_id ON comments (parent_comment_id, hot, id);
+CREATE INDEX idx_comments_parent_comment_id_controversy_id ON comments (parent_comment_id, controversy, id);
+CREATE INDEX idx_comments_parent_comment_id_confidence_id ON comments (parent_comment_id, confidence, id);
@@ -0,0 +1,10 @@
+DROP FUNCTION IF EXISTS html_escape(TEXT);
+
+ALTER TABLE users
+    DROP COLUMN search;
+
+ALTER TABLE comments
+    DROP COLUMN search;
+
+ALTER TABLE posts
+    DROP COLUMN search;
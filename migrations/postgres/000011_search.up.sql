@@ -0,0 +1,29 @@
+-- Content is written both in English and in Russian, so texts are
+-- indexed with both configurations and queries match either of them.
+-- Usernames aren't words of any language and are indexed as they are.
+ALTER TABLE posts
+    ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('russian', title), 'A') ||
+        setweight(to_tsvector('english', content), 'B') || setweight(to_tsvector('russian', content), 'B')) STORED;
+
+ALTER TABLE comments
+    ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('english', content) || to_tsvector('russian', content)) STORED;
+
+ALTER TABLE users
+    ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (to_tsvector('simple', username)) STORED;
+
+CREATE INDEX idx_posts_search ON posts USING GIN (search);
+CREATE INDEX idx_comments_search ON comments USING GIN (search);
+CREATE INDEX idx_users_search ON users USING GIN (search);
+
+-- Snippets are HTML with matched words in <b> tags, so the text around
+-- them is escaped first.
+CREATE FUNCTION html_escape(value TEXT) RETURNS TEXT
+    LANGUAGE SQL
+    IMMUTABLE
+    PARALLEL SAFE
+AS
+$$
+SELECT replace(replace(replace(value, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')
+$$;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS hub_subscriptions;
+DROP TABLE IF EXISTS post_hubs;
+DROP TABLE IF EXISTS hubs;
+
+DROP FUNCTION IF EXISTS count_hub_subscription();
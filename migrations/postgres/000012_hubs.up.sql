@@ -0,0 +1,52 @@
+CREATE TABLE IF NOT EXISTS hubs
+(
+    id                SERIAL PRIMARY KEY,
+    slug              VARCHAR(50)   NOT NULL UNIQUE,
+    title             VARCHAR(100)  NOT NULL,
+    description       VARCHAR(1000) NOT NULL DEFAULT '',
+    created_at        TIMESTAMP     NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    subscribers_count INTEGER       NOT NULL DEFAULT 0
+);
+
+-- Posts of a hub are paged by ID straight from the primary key.
+CREATE TABLE IF NOT EXISTS post_hubs
+(
+    hub_id  INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    PRIMARY KEY (hub_id, post_id),
+    FOREIGN KEY (hub_id) REFERENCES hubs,
+    FOREIGN KEY (post_id) REFERENCES posts
+);
+
+CREATE INDEX idx_post_hubs_post_id ON post_hubs (post_id);
+
+CREATE TABLE IF NOT EXISTS hub_subscriptions
+(
+    hub_id  INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY (hub_id, user_id),
+    FOREIGN KEY (hub_id) REFERENCES hubs,
+    FOREIGN KEY (user_id) REFERENCES users
+);
+
+CREATE INDEX idx_hub_subscriptions_user_id ON hub_subscriptions (user_id);
+
+-- The counter is kept next to the hub, same as vote counters.
+CREATE FUNCTION count_hub_subscription() RETURNS trigger AS
+$count_hub_subscription$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE hubs SET subscribers_count = subscribers_count + 1 WHERE id = NEW.hub_id;
+    ELSE
+        UPDATE hubs SET subscribers_count = subscribers_count - 1 WHERE id = OLD.hub_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$count_hub_subscription$ LANGUAGE plpgsql;
+
+CREATE TRIGGER hub_subscription_count
+    AFTER INSERT OR DELETE
+    ON hub_subscriptions
+    FOR EACH ROW
+EXECUTE PROCEDURE count_hub_subscription();
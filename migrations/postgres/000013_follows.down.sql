@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS follows;
+
+DROP FUNCTION IF EXISTS count_follow();
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS followers_count;
@@ -0,0 +1,35 @@
+ALTER TABLE users
+    ADD COLUMN followers_count INTEGER NOT NULL DEFAULT 0;
+
+-- Users a user follows are paged by ID straight from the primary key,
+-- and their followers from the reverse index.
+CREATE TABLE IF NOT EXISTS follows
+(
+    follower_id INTEGER NOT NULL,
+    followee_id INTEGER NOT NULL,
+    PRIMARY KEY (follower_id, followee_id),
+    FOREIGN KEY (follower_id) REFERENCES users,
+    FOREIGN KEY (followee_id) REFERENCES users,
+    CONSTRAINT follows_not_self CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX idx_follows_followee_id_follower_id ON follows (followee_id, follower_id);
+
+CREATE FUNCTION count_follow() RETURNS trigger AS
+$count_follow$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET followers_count = followers_count + 1 WHERE id = NEW.followee_id;
+    ELSE
+        UPDATE users SET followers_count = followers_count - 1 WHERE id = OLD.followee_id;
+    END IF;
+
+    RETURN NULL;
+END;
+$count_follow$ LANGUAGE plpgsql;
+
+CREATE TRIGGER follow_count
+    AFTER INSERT OR DELETE
+    ON follows
+    FOR EACH ROW
+EXECUTE PROCEDURE count_follow();